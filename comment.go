@@ -0,0 +1,85 @@
+package csb
+
+import (
+	"context"
+	"time"
+)
+
+// Comment represents a written report comment from engage.
+type Comment struct {
+	// PK of the comment.
+	ID int `json:"id"`
+
+	// Links to student.
+	StudentID int `json:"student_id"`
+
+	// Subject the comment was written for.
+	Subject Subject `json:"subject"`
+	// Teacher is the name of the teacher who wrote the comment, as spelled by engage.
+	Teacher string `json:"teacher"`
+	// Reporting period the comment was written at.
+	Period Period `json:"period"`
+	// Text of the comment.
+	Text string `json:"text"`
+	// Timestamps.
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+func (c *Comment) Validate() error {
+	if c.StudentID == 0 {
+		return Errorf(EINVALID, "validate: comment missing student id field")
+	}
+	if c.Subject == "" {
+		return Errorf(EINVALID, "validate: comment missing subject field")
+	}
+
+	ok, err := c.Period.Full()
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return Errorf(EINVALID, "validate: expecting full period")
+	}
+
+	if c.Text == "" {
+		return Errorf(EINVALID, "validate: expecting text field")
+	}
+	return nil
+}
+
+// Key returns the natural key of the comment: comments of a student are unique per subject
+// and full period.
+func (c *Comment) Key() string {
+	return (&Mark{StudentID: c.StudentID, Subject: c.Subject, Period: c.Period}).Key()
+}
+
+// CommentService represents a report comment service.
+type CommentService interface {
+	// FindComments finds the comments with the appropiate filter.
+	//
+	// returns EINVALID if the search query is invalid.
+	FindComments(ctx context.Context, filter CommentFilter) ([]*Comment, error)
+
+	// RefreshComments refreshes the comments for a particular student over the exam period
+	// span provided, it returns the amount of comments added or changed.
+	//
+	// returns any error in the exchange.
+	RefreshComments(ctx context.Context, pid int, from, to Period) (int, error)
+}
+
+// CommentFilter represents a filter to bulk get comments.
+type CommentFilter struct {
+	// PID filters on the student id.
+	PID *int `json:"pid"`
+	// Periods filters on the POPULATED period fields on the period fields.
+	Periods []Period `json:"periods"`
+	// Subjects filters on the comments subjects.
+	Subjects []Subject `json:"subjects"`
+	// Query is a full text search query on the comment texts, matching comments are ordered
+	// by relevance.
+	//
+	// Full text search needs sqlite built with fts5 (the sqlite_fts5 build tag), without it the
+	// comments holding every word of the query match, in the default order.
+	Query *string `json:"query"`
+}
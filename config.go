@@ -1,16 +1,60 @@
 package csb
 
+import (
+	"encoding/json"
+	"io"
+)
+
 // Config represents the structure of a json config file.
 type Config struct {
 	HTTP   httpConfig   `json:"http"`   // HTTP related configs.
 	Sqlite sqliteConfig `json:"sqlite"` // Sqlite related configs.
 	Engage engageConfig `json:"engage"` // Engage related configs.
+
+	Grading   gradingConfig   `json:"grading"`   // Grading related configs.
+	Scheduler schedulerConfig `json:"scheduler"` // Scheduler related configs.
+}
+
+// schedulerConfig holds all the config fields related to the recurring transactions.
+type schedulerConfig struct {
+	// Schedules are the recurring transactions published to the work queue.
+	Schedules []Schedule `json:"schedules"`
+	// Location is the IANA time zone the cron expressions are evaluated in, "Europe/Bucharest".
+	// Defaults to the local time zone.
+	Location string `json:"location"`
+}
+
+// gradingConfig holds all the config fields related to grading.
+type gradingConfig struct {
+	// Scales are custom grade scales or new boundary tables for the built in scales, registered
+	// by ReadConfig.
+	//
+	// A scale without grades adds its tables to the existing scale with the same name.
+	Scales []GradeScale `json:"scales"`
 }
 
 // engageConfig holds all the config fields related to engage.
 type engageConfig struct {
-	// Token used for engage auth.
+	// Token used for engage auth, the raw cookie header of a logged in session.
+	//
+	// Ignored if Username is set.
 	Token string `json:"token"`
+	// Username and Password are the credentials of the engage account used to log in and
+	// renew the session automatically.
+	Username string `json:"username"`
+	Password string `json:"password"`
+	// LoginURL overrides the url of the engage login form. Defaults to the school's engage
+	// login form.
+	LoginURL string `json:"login_url"`
+	// BaseURL overrides the url of the engage services, used to point the api at a fake
+	// engage server. Defaults to the school's engage portal.
+	BaseURL string `json:"base_url"`
+	// RequestsPerSecond is the budget of requests per second sent to engage, shared by all
+	// services. Defaults to engage.DefaultRate.
+	RequestsPerSecond float64 `json:"requests_per_second"`
+	// Burst is the amount of requests which can be sent to engage at once.
+	// Defaults to engage.DefaultBurst.
+	Burst int `json:"burst"`
 	// Fallback indicates wether failed queries to the database should fallback to engage.
 	Fallback bool `json:"fallback"`
 }
@@ -29,6 +73,23 @@ type sqliteConfig struct {
 	//
 	// :memory: isnt allowed.
 	DSN string `json:"dsn"`
-	// MigrationsPath is the path to the migrations folder.
+	// MigrationsPath optionally overrides the migrations embedded in the binary with a
+	// migrate source url.
 	MigrationsPath string `json:"migrations_path"`
 }
+
+// ReadConfig decodes a json config file from r and registers its grade scales so that they can
+// be looked up by name.
+//
+// returns EINVALID if the config isnt valid json or one of its grade scales isnt valid.
+func ReadConfig(r io.Reader) (Config, error) {
+	var conf Config
+	if err := json.NewDecoder(r).Decode(&conf); err != nil {
+		return Config{}, Errorf(EINVALID, "read config: %v", err)
+	}
+
+	if err := RegisterGradeScales(conf.Grading.Scales); err != nil {
+		return Config{}, err
+	}
+	return conf, nil
+}
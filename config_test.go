@@ -0,0 +1,43 @@
+package csb_test
+
+import (
+	"strings"
+	"testing"
+
+	csb "github.com/Lambels/CSB-Open-API"
+)
+
+func TestReadConfig(t *testing.T) {
+	conf, err := csb.ReadConfig(strings.NewReader(`{
+		"sqlite": {"dsn": "csb.db"},
+		"grading": {"scales": [{
+			"name": "test-config",
+			"grades": ["pass", "fail"],
+			"tables": [{"version": "default", "boundaries": {"pass": 50, "fail": 0}}]
+		}]}
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	} else if conf.Sqlite.DSN != "csb.db" {
+		t.Fatalf("unexpected config: %+v", conf)
+	}
+
+	// the scales of the config can be looked up.
+	scale, err := csb.FindGradeScale("test-config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	mark := &csb.Mark{Subject: csb.MATHEMATICS, Percentage: 55, Period: mustParsePeriod(t, "2022-23/T1/Mock")}
+	if grade, err := mark.Grade(scale); err != nil {
+		t.Fatal(err)
+	} else if grade != "pass" {
+		t.Fatalf("expected pass, got: %v", grade)
+	}
+
+	if _, err := csb.ReadConfig(strings.NewReader(`{"grading": {"scales": [{"name": "test-config-invalid"}]}}`)); csb.ErrorCode(err) != csb.EINVALID {
+		t.Fatalf("expected EINVALID, got: %v", err)
+	}
+	if _, err := csb.ReadConfig(strings.NewReader(`{`)); csb.ErrorCode(err) != csb.EINVALID {
+		t.Fatalf("expected EINVALID, got: %v", err)
+	}
+}
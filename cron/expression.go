@@ -0,0 +1,245 @@
+package cron
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	csb "github.com/Lambels/CSB-Open-API"
+)
+
+// Expression represents a parsed cron expression, each field is a bit set of the values
+// matched by the field.
+type Expression struct {
+	minute, hour, dom, month, dow uint64
+
+	// domStar and dowStar indicate wether the day fields matched every day, when both are
+	// restricted a day matches if either field matches.
+	domStar, dowStar bool
+}
+
+// bounds represents the range of values of a field and the names of the values.
+type bounds struct {
+	name     string
+	min, max int
+	names    map[string]int
+}
+
+var (
+	minuteBounds = bounds{name: "minute", min: 0, max: 59}
+	hourBounds   = bounds{name: "hour", min: 0, max: 23}
+	domBounds    = bounds{name: "day of month", min: 1, max: 31}
+	monthBounds  = bounds{name: "month", min: 1, max: 12, names: map[string]int{
+		"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6,
+		"jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12,
+	}}
+	// 7 is sunday as well.
+	dowBounds = bounds{name: "day of week", min: 0, max: 7, names: map[string]int{
+		"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6,
+	}}
+)
+
+// descriptors maps the supported descriptors to their expression.
+var descriptors = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// Parse parses the standard 5 field cron expression: minute, hour, day of month, month and
+// day of week. Fields support *, lists, ranges, steps and the english names of the months
+// and days, ie: "0 18 * * mon-fri" or "*/15 8-16 * * 1,3".
+func Parse(spec string) (*Expression, error) {
+	spec = strings.TrimSpace(spec)
+	if expr, ok := descriptors[strings.ToLower(spec)]; ok {
+		spec = expr
+	}
+
+	fields := strings.Fields(spec)
+	if len(fields) != 5 {
+		return nil, csb.Errorf(csb.EINVALID, "cron: expected 5 fields, got %v in: %q", len(fields), spec)
+	}
+
+	var (
+		e   Expression
+		err error
+	)
+	if e.minute, err = parseField(fields[0], minuteBounds); err != nil {
+		return nil, err
+	}
+	if e.hour, err = parseField(fields[1], hourBounds); err != nil {
+		return nil, err
+	}
+	if e.dom, err = parseField(fields[2], domBounds); err != nil {
+		return nil, err
+	}
+	if e.month, err = parseField(fields[3], monthBounds); err != nil {
+		return nil, err
+	}
+	if e.dow, err = parseField(fields[4], dowBounds); err != nil {
+		return nil, err
+	}
+
+	// fold sunday as 7 on sunday as 0.
+	if e.dow&(1<<7) != 0 {
+		e.dow = e.dow&^(1<<7) | 1
+	}
+	e.domStar = strings.HasPrefix(fields[2], "*")
+	e.dowStar = strings.HasPrefix(fields[4], "*")
+
+	return &e, nil
+}
+
+// parseField parses a comma separated field into a bit set.
+func parseField(field string, b bounds) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		r, err := parseRange(part, b)
+		if err != nil {
+			return 0, err
+		}
+		bits |= r
+	}
+	return bits, nil
+}
+
+// parseRange parses a single part of a field: *, a value or a range, optionally followed by
+// a step.
+func parseRange(part string, b bounds) (uint64, error) {
+	rng, stepText, hasStep := strings.Cut(part, "/")
+
+	var (
+		start, end int
+		err        error
+	)
+	switch lo, hi, isRange := strings.Cut(rng, "-"); {
+	case rng == "*":
+		start, end = b.min, b.max
+	case isRange:
+		if start, err = parseValue(lo, b); err != nil {
+			return 0, err
+		}
+		if end, err = parseValue(hi, b); err != nil {
+			return 0, err
+		}
+	default:
+		if start, err = parseValue(rng, b); err != nil {
+			return 0, err
+		}
+		end = start
+		// "5/15" runs from 5 till the end of the range.
+		if hasStep {
+			end = b.max
+		}
+	}
+	if start > end {
+		return 0, csb.Errorf(csb.EINVALID, "cron: invalid %v range: %q", b.name, part)
+	}
+
+	step := 1
+	if hasStep {
+		if step, err = strconv.Atoi(stepText); err != nil || step <= 0 {
+			return 0, csb.Errorf(csb.EINVALID, "cron: invalid %v step: %q", b.name, part)
+		}
+	}
+
+	var bits uint64
+	for i := start; i <= end; i += step {
+		bits |= 1 << uint(i)
+	}
+	return bits, nil
+}
+
+// parseValue parses a number or name of a field value.
+func parseValue(text string, b bounds) (int, error) {
+	if v, ok := b.names[strings.ToLower(text)]; ok {
+		return v, nil
+	}
+
+	v, err := strconv.Atoi(text)
+	if err != nil || v < b.min || v > b.max {
+		return 0, csb.Errorf(csb.EINVALID, "cron: invalid %v: %q", b.name, text)
+	}
+	return v, nil
+}
+
+// allHours is the hour field matching every hour.
+const allHours = 1<<24 - 1
+
+// Next returns the first time after t matched by the expression, in the location of t. The
+// zero time is returned if no time is matched in the next 5 years, ie: "0 0 30 2 *".
+//
+// The times skipped when daylight saving starts arent matched. The times repeated when it ends
+// are matched once, unless the expression runs every hour.
+func (e *Expression) Next(t time.Time) time.Time {
+	loc := t.Location()
+	start := wallClock(t)
+	// start from the next whole minute, in absolute time so that a repeated wall clock keeps
+	// its offset.
+	t = t.Add(time.Minute - time.Duration(t.Second())*time.Second - time.Duration(t.Nanosecond()))
+	yearLimit := t.Year() + 5
+
+	// each field is advanced until it matches, resetting the smaller fields. When a field
+	// wraps around the larger fields have to be checked again.
+wrap:
+	if t.Year() > yearLimit {
+		return time.Time{}
+	}
+
+	for e.month&(1<<uint(t.Month())) == 0 {
+		t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, loc)
+		if t.Month() == time.January {
+			goto wrap
+		}
+	}
+
+	for !e.dayMatches(t) {
+		t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, loc)
+		if t.Day() == 1 {
+			goto wrap
+		}
+	}
+
+	for e.hour&(1<<uint(t.Hour())) == 0 {
+		// move in absolute time, the wall clock may repeat an hour when daylight saving ends.
+		t = t.Add(time.Hour - time.Duration(t.Minute())*time.Minute)
+		if t.Hour() == 0 {
+			goto wrap
+		}
+	}
+
+	for e.minute&(1<<uint(t.Minute())) == 0 {
+		t = t.Add(time.Minute)
+		if t.Minute() == 0 {
+			goto wrap
+		}
+	}
+
+	// the wall clock went back, the time was already matched before the change.
+	if e.hour != allHours && !wallClock(t).After(start) {
+		t = t.Add(time.Minute)
+		goto wrap
+	}
+
+	return t
+}
+
+// wallClock returns the wall clock of t, regardless of its offset.
+func wallClock(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), time.UTC)
+}
+
+// dayMatches reports wether the day of t is matched by the expression.
+func (e *Expression) dayMatches(t time.Time) bool {
+	dom := e.dom&(1<<uint(t.Day())) != 0
+	dow := e.dow&(1<<uint(t.Weekday())) != 0
+
+	if e.domStar || e.dowStar {
+		return dom && dow
+	}
+	return dom || dow
+}
@@ -0,0 +1,116 @@
+package cron_test
+
+import (
+	"testing"
+	"time"
+	_ "time/tzdata"
+
+	csb "github.com/Lambels/CSB-Open-API"
+	"github.com/Lambels/CSB-Open-API/cron"
+)
+
+func TestParse(t *testing.T) {
+	for _, spec := range []string{
+		"* * * * *",
+		"0 18 * * mon-fri",
+		"*/15 8-16 * * 1,3",
+		"5/15 * 1-7 jan-jun 7",
+		"@daily",
+		"@Weekly",
+	} {
+		if _, err := cron.Parse(spec); err != nil {
+			t.Errorf("Parse(%q): %v", spec, err)
+		}
+	}
+
+	for _, spec := range []string{
+		"",
+		"* * * *",
+		"* * * * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"5-1 * * * *",
+		"*/0 * * * *",
+		"* * * foo *",
+		"@reboot",
+	} {
+		if _, err := cron.Parse(spec); csb.ErrorCode(err) != csb.EINVALID {
+			t.Errorf("Parse(%q): expected EINVALID, got: %v", spec, err)
+		}
+	}
+}
+
+func TestExpression_Next(t *testing.T) {
+	bucharest, err := time.LoadLocation("Europe/Bucharest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	utc := func(year int, month time.Month, day, hour, min int) time.Time {
+		return time.Date(year, month, day, hour, min, 0, 0, time.UTC)
+	}
+	local := func(year int, month time.Month, day, hour, min int) time.Time {
+		return time.Date(year, month, day, hour, min, 0, 0, bucharest)
+	}
+	// the wall clock of Bucharest goes from 03:00 to 04:00 on 2022-03-27 and from 04:00 back
+	// to 03:00 on 2022-10-30.
+	summer := time.FixedZone("EEST", 3*60*60)
+	winter := time.FixedZone("EET", 2*60*60)
+
+	tests := []struct {
+		name string
+		spec string
+		from time.Time
+		want time.Time
+	}{
+		{"next minute", "* * * * *", utc(2022, 5, 1, 10, 0).Add(30 * time.Second), utc(2022, 5, 1, 10, 1)},
+		{"strictly after", "0 10 * * *", utc(2022, 5, 1, 10, 0), utc(2022, 5, 2, 10, 0)},
+		{"end of hour", "0 * * * *", utc(2022, 5, 1, 23, 59), utc(2022, 5, 2, 0, 0)},
+		{"end of year", "0 0 * * *", utc(2022, 12, 31, 12, 0), utc(2023, 1, 1, 0, 0)},
+		{"steps", "*/20 8-9 * * *", utc(2022, 5, 1, 8, 45), utc(2022, 5, 1, 9, 0)},
+
+		// month ends.
+		{"skips short months", "0 0 31 * *", utc(2022, 1, 31, 12, 0), utc(2022, 3, 31, 0, 0)},
+		{"skips april", "0 0 31 * *", utc(2022, 3, 31, 12, 0), utc(2022, 5, 31, 0, 0)},
+		{"leap day", "0 12 29 2 *", utc(2022, 1, 1, 0, 0), utc(2024, 2, 29, 12, 0)},
+		{"last day of february", "0 0 28 2 *", utc(2022, 2, 28, 0, 0), utc(2023, 2, 28, 0, 0)},
+		{"monthly", "@monthly", utc(2022, 2, 28, 23, 59), utc(2022, 3, 1, 0, 0)},
+
+		// the day fields match on either when both are restricted, 2022-06-10 is a friday.
+		{"dom or dow by dow", "0 0 13 * fri", utc(2022, 6, 1, 0, 0), utc(2022, 6, 3, 0, 0)},
+		{"dom or dow by dom", "0 0 13 * fri", utc(2022, 6, 11, 0, 0), utc(2022, 6, 13, 0, 0)},
+		{"dom only", "0 0 13 * *", utc(2022, 6, 1, 0, 0), utc(2022, 6, 13, 0, 0)},
+		{"dow only", "0 0 * * fri", utc(2022, 6, 11, 0, 0), utc(2022, 6, 17, 0, 0)},
+		// a day field starting with * counts as unrestricted, 2022-07-01 is a friday.
+		{"dom star step", "0 0 */10 * fri", utc(2022, 6, 1, 0, 0), utc(2022, 7, 1, 0, 0)},
+		{"sunday as 7", "0 0 * * 7", utc(2022, 6, 1, 0, 0), utc(2022, 6, 5, 0, 0)},
+
+		// daylight saving.
+		{"skipped hour", "30 3 * * *", local(2022, 3, 26, 12, 0), local(2022, 3, 28, 3, 30)},
+		{"hourly across skipped hour", "0 * * * *", local(2022, 3, 27, 2, 30), time.Date(2022, 3, 27, 4, 0, 0, 0, summer)},
+		{"repeated hour first", "30 3 * * *", local(2022, 10, 30, 0, 0), time.Date(2022, 10, 30, 3, 30, 0, 0, summer)},
+		{"repeated hour once", "30 3 * * *", time.Date(2022, 10, 30, 3, 30, 0, 0, summer).In(bucharest), local(2022, 10, 31, 3, 30)},
+		{"hourly across repeated hour", "0 * * * *", time.Date(2022, 10, 30, 3, 30, 0, 0, summer).In(bucharest), time.Date(2022, 10, 30, 3, 0, 0, 0, winter)},
+		{"daily across change", "0 18 * * *", local(2022, 10, 29, 18, 0), local(2022, 10, 30, 18, 0)},
+
+		{"impossible", "0 0 30 2 *", utc(2022, 1, 1, 0, 0), time.Time{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			expr, err := cron.Parse(tt.spec)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got := expr.Next(tt.from)
+			if !got.Equal(tt.want) {
+				t.Fatalf("Next(%v) of %q = %v, want: %v", tt.from, tt.spec, got, tt.want)
+			} else if !got.IsZero() && got.Location() != tt.from.Location() {
+				t.Fatalf("expected location %v, got: %v", tt.from.Location(), got.Location())
+			}
+		})
+	}
+}
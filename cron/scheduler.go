@@ -0,0 +1,363 @@
+package cron
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	csb "github.com/Lambels/CSB-Open-API"
+)
+
+// Clock tells the time to the scheduler, swapped in tests to move the time by hand.
+type Clock interface {
+	// Now returns the current time.
+	Now() time.Time
+	// After returns a channel which recieves the time once d passed.
+	After(d time.Duration) <-chan time.Time
+}
+
+// realClock is the clock of the system.
+type realClock struct{}
+
+func (realClock) Now() time.Time                         { return time.Now() }
+func (realClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+
+// Option configures a scheduler.
+type Option func(*Scheduler)
+
+// WithClock sets the clock of the scheduler. Defaults to the system clock.
+func WithClock(clock Clock) Option {
+	return func(s *Scheduler) {
+		if clock != nil {
+			s.clock = clock
+		}
+	}
+}
+
+// WithLocation sets the location the cron expressions are evaluated in. Defaults to the
+// local time zone.
+func WithLocation(loc *time.Location) Option {
+	return func(s *Scheduler) {
+		if loc != nil {
+			s.loc = loc
+		}
+	}
+}
+
+// Entry represents the record of a schedule.
+type Entry struct {
+	Schedule csb.Schedule `json:"schedule"`
+
+	// LastRun is the time the schedule last published a transaction, the zero time if it
+	// never ran.
+	LastRun time.Time `json:"last_run"`
+	// NextRun is the time the schedule runs next, the zero time if it never runs again.
+	NextRun time.Time `json:"next_run"`
+	// LastTransaction is the id of the last published transaction.
+	LastTransaction int64 `json:"last_transaction"`
+	// LastStatus is the latest status of the last published transaction.
+	LastStatus csb.Status `json:"last_status"`
+	// Running indicates wether the last published transaction didnt finish yet.
+	Running bool `json:"running"`
+	// Skipped counts the runs skipped because the previous run didnt finish yet.
+	Skipped int `json:"skipped"`
+	// Error is the error of the last failed publish.
+	Error error `json:"error"`
+}
+
+// entry is the internal state of a schedule.
+type entry struct {
+	Entry
+	expr *Expression
+}
+
+// Scheduler publishes the transactions of the schedules on the work queue when their cron
+// expression matches.
+//
+// A schedule doesent overlap with itself: a run is skipped while the transaction of the
+// previous run didnt finish yet.
+type Scheduler struct {
+	queue csb.WorkQueue
+	clock Clock
+	loc   *time.Location
+
+	// ctx is the context of the published transactions, cancelled by Close.
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	// mu guards entries.
+	mu      sync.Mutex
+	entries []*entry
+
+	// wake wakes up the scheduler when the schedules change.
+	wake chan struct{}
+	wg   sync.WaitGroup
+	once sync.Once
+}
+
+// NewScheduler creates a new scheduler publishing on queue, it returns EINVALID if any of the
+// schedules are invalid.
+func NewScheduler(queue csb.WorkQueue, schedules []csb.Schedule, opts ...Option) (*Scheduler, error) {
+	s := &Scheduler{
+		queue: queue,
+		clock: realClock{},
+		loc:   time.Local,
+		wake:  make(chan struct{}, 1),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	s.ctx, s.cancel = context.WithCancel(context.Background())
+
+	for _, schedule := range schedules {
+		if err := s.add(schedule); err != nil {
+			return nil, err
+		}
+	}
+
+	return s, nil
+}
+
+// NewSchedulerFromConfig creates a new scheduler publishing the schedules of the scheduler
+// config on queue, the cron expressions are evaluated in the configured location. The options
+// are applied after the config.
+//
+// returns EINVALID if the location is unknown or any of the schedules are invalid.
+func NewSchedulerFromConfig(queue csb.WorkQueue, conf csb.Config, opts ...Option) (*Scheduler, error) {
+	if name := conf.Scheduler.Location; name != "" {
+		loc, err := time.LoadLocation(name)
+		if err != nil {
+			return nil, csb.Errorf(csb.EINVALID, "scheduler: invalid location: %v", name)
+		}
+		opts = append([]Option{WithLocation(loc)}, opts...)
+	}
+
+	return NewScheduler(queue, conf.Scheduler.Schedules, opts...)
+}
+
+// Start starts the scheduler in the background.
+func (s *Scheduler) Start() {
+	s.wg.Add(1)
+	go s.run()
+}
+
+// Add adds a schedule to the scheduler, it returns EINVALID if the schedule is invalid and
+// ECONFLICT if a schedule with the same name exists.
+func (s *Scheduler) Add(schedule csb.Schedule) error {
+	if err := s.add(schedule); err != nil {
+		return err
+	}
+
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+func (s *Scheduler) add(schedule csb.Schedule) error {
+	if err := schedule.Validate(); err != nil {
+		return err
+	}
+	expr, err := Parse(schedule.Spec)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, e := range s.entries {
+		if e.Schedule.Name == schedule.Name {
+			return csb.Errorf(csb.ECONFLICT, "scheduler: schedule already exists: %v", schedule.Name)
+		}
+	}
+
+	e := &entry{
+		Entry: Entry{Schedule: schedule},
+		expr:  expr,
+	}
+	e.NextRun = expr.Next(s.now())
+	s.entries = append(s.entries, e)
+
+	return nil
+}
+
+// Remove removes the schedule with name = name, the transaction of a running schedule is
+// left to finish. It returns ENOTFOUND if the schedule doesent exist.
+func (s *Scheduler) Remove(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, e := range s.entries {
+		if e.Schedule.Name == name {
+			s.entries = append(s.entries[:i], s.entries[i+1:]...)
+			return nil
+		}
+	}
+	return csb.Errorf(csb.ENOTFOUND, "scheduler: no schedule was found with name: %v", name)
+}
+
+// Entries returns the records of the schedules, ordered by the next run.
+func (s *Scheduler) Entries() []Entry {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entries := make([]Entry, 0, len(s.entries))
+	for _, e := range s.entries {
+		entries = append(entries, e.Entry)
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		// never running entries go last.
+		if entries[i].NextRun.IsZero() || entries[j].NextRun.IsZero() {
+			return !entries[i].NextRun.IsZero()
+		}
+		return entries[i].NextRun.Before(entries[j].NextRun)
+	})
+	return entries
+}
+
+// Entry returns the record of the schedule with name = name, it returns ENOTFOUND if the
+// schedule doesent exist.
+func (s *Scheduler) Entry(name string) (Entry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, e := range s.entries {
+		if e.Schedule.Name == name {
+			return e.Entry, nil
+		}
+	}
+	return Entry{}, csb.Errorf(csb.ENOTFOUND, "scheduler: no schedule was found with name: %v", name)
+}
+
+// Close stops the scheduler and cancels the context of the published transactions which
+// didnt finish yet.
+func (s *Scheduler) Close() error {
+	s.once.Do(s.cancel)
+	s.wg.Wait()
+	return nil
+}
+
+// run waits for the next due schedule and runs the due schedules until the scheduler is
+// closed.
+func (s *Scheduler) run() {
+	defer s.wg.Done()
+
+	for {
+		var after <-chan time.Time
+		if next := s.next(); !next.IsZero() {
+			after = s.clock.After(next.Sub(s.now()))
+		}
+
+		select {
+		case <-after:
+			s.runDue()
+		case <-s.wake:
+		case <-s.ctx.Done():
+			return
+		}
+	}
+}
+
+// next returns the earliest next run, the zero time if no schedule runs again.
+func (s *Scheduler) next() time.Time {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var next time.Time
+	for _, e := range s.entries {
+		if !e.NextRun.IsZero() && (next.IsZero() || e.NextRun.Before(next)) {
+			next = e.NextRun
+		}
+	}
+	return next
+}
+
+// runDue runs the schedules whose next run passed.
+func (s *Scheduler) runDue() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	for _, e := range s.entries {
+		if e.NextRun.IsZero() || e.NextRun.After(now) {
+			continue
+		}
+		// runs missed while the scheduler was busy collapse in a single run.
+		e.NextRun = e.expr.Next(now)
+
+		if e.Running {
+			e.Skipped++
+			continue
+		}
+		s.publish(e, now)
+	}
+}
+
+// publish publishes the transaction of the schedule and watches it, s.mu must be held.
+func (s *Scheduler) publish(e *entry, now time.Time) {
+	transaction := &csb.Transaction{
+		Data:     e.Schedule.Data,
+		Priority: e.Schedule.Priority,
+		Key:      e.Schedule.Key,
+		Retry:    e.Schedule.Retry,
+		Ctx:      s.ctx,
+	}
+	e.LastRun = now
+	if err := s.queue.Publish(transaction); err != nil {
+		e.Error = err
+		return
+	}
+	e.Error = nil
+	e.LastTransaction = transaction.Id
+	e.LastStatus = csb.Status{State: csb.Queued}
+
+	// subscribe in the background, the work queue may block while s.mu is held.
+	e.Running = true
+	s.wg.Add(1)
+	go s.watch(e, transaction.Id)
+}
+
+// watch records the statuses of the transaction until it finishes.
+func (s *Scheduler) watch(e *entry, id int64) {
+	defer s.wg.Done()
+
+	sub, err := s.queue.Subscribe(s.ctx, id)
+	// the transaction already finished and was forgotten or the work queue is closed.
+	if err != nil || sub == nil {
+		s.mu.Lock()
+		e.Running = false
+		if csb.ErrorCode(err) != csb.ENOTFOUND {
+			e.Error = err
+		}
+		s.mu.Unlock()
+		return
+	}
+	defer sub.Close()
+
+	for {
+		select {
+		case status, ok := <-sub.C():
+			s.mu.Lock()
+			if !ok {
+				e.Running = false
+				s.mu.Unlock()
+				return
+			}
+			e.LastStatus = status
+			s.mu.Unlock()
+		case <-s.ctx.Done():
+			s.mu.Lock()
+			e.Running = false
+			s.mu.Unlock()
+			return
+		}
+	}
+}
+
+// now returns the current time in the location of the scheduler.
+func (s *Scheduler) now() time.Time {
+	return s.clock.Now().In(s.loc)
+}
@@ -0,0 +1,298 @@
+package cron_test
+
+import (
+	"encoding/json"
+	"sync"
+	"testing"
+	"time"
+
+	csb "github.com/Lambels/CSB-Open-API"
+	"github.com/Lambels/CSB-Open-API/cron"
+	"github.com/Lambels/CSB-Open-API/inmem"
+)
+
+// timeout bounds every wait of the tests.
+const timeout = 5 * time.Second
+
+// fakeClock is a clock moved by hand.
+type fakeClock struct {
+	mu      sync.Mutex
+	now     time.Time
+	waiters []waiter
+}
+
+type waiter struct {
+	at time.Time
+	c  chan time.Time
+}
+
+func newFakeClock(now time.Time) *fakeClock {
+	return &fakeClock{now: now}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) After(d time.Duration) <-chan time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	w := waiter{at: c.now.Add(d), c: make(chan time.Time, 1)}
+	if d <= 0 {
+		w.c <- c.now
+		return w.c
+	}
+	c.waiters = append(c.waiters, w)
+	return w.c
+}
+
+// Advance moves the clock by d and fires the waiters which are due.
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.now = c.now.Add(d)
+	waiters := c.waiters[:0]
+	for _, w := range c.waiters {
+		if w.at.After(c.now) {
+			waiters = append(waiters, w)
+			continue
+		}
+		w.c <- c.now
+	}
+	c.waiters = waiters
+}
+
+// eventually polls the entry of the schedule until ok reports true.
+func eventually(t *testing.T, s *cron.Scheduler, name string, ok func(cron.Entry) bool) cron.Entry {
+	t.Helper()
+
+	deadline := time.Now().Add(timeout)
+	for {
+		e, err := s.Entry(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ok(e) {
+			return e
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("entry didnt reach the expected state: %+v", e)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestScheduler_Overlap(t *testing.T) {
+	start := time.Date(2022, 5, 2, 10, 0, 0, 0, time.UTC)
+	clock := newFakeClock(start)
+
+	started := make(chan *csb.Transaction, 10)
+	release := make(chan struct{})
+	queue := inmem.NewWorkQueue(func(transaction *csb.Transaction) error {
+		started <- transaction
+		<-release
+		return nil
+	})
+	defer queue.Close()
+
+	s, err := cron.NewScheduler(queue, []csb.Schedule{{
+		Name:     "refresh",
+		Spec:     "* * * * *",
+		Data:     json.RawMessage(`{"refresh":"marks"}`),
+		Priority: csb.PRIORITY_HIGH,
+		Key:      "refresh",
+	}}, cron.WithClock(clock), cron.WithLocation(time.UTC))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Start()
+	defer s.Close()
+
+	e, err := s.Entry("refresh")
+	if err != nil {
+		t.Fatal(err)
+	} else if !e.LastRun.IsZero() || !e.NextRun.Equal(start.Add(time.Minute)) {
+		t.Fatalf("expected no last run and next run at %v, got: %+v", start.Add(time.Minute), e)
+	}
+
+	clock.Advance(time.Minute)
+	var transaction *csb.Transaction
+	select {
+	case transaction = <-started:
+	case <-time.After(timeout):
+		t.Fatal("expected the schedule to publish a transaction")
+	}
+	if transaction.Priority != csb.PRIORITY_HIGH || transaction.Key != "refresh" {
+		t.Fatalf("expected the priority and key of the schedule, got: %+v", transaction)
+	}
+
+	e = eventually(t, s, "refresh", func(e cron.Entry) bool { return e.Running })
+	if !e.LastRun.Equal(start.Add(time.Minute)) || !e.NextRun.Equal(start.Add(2*time.Minute)) {
+		t.Fatalf("expected last run at %v and next run at %v, got: %+v", start.Add(time.Minute), start.Add(2*time.Minute), e)
+	} else if e.LastTransaction != transaction.Id {
+		t.Fatalf("expected last transaction %v, got: %v", transaction.Id, e.LastTransaction)
+	}
+
+	// the runs overlapping the running transaction are skipped.
+	clock.Advance(time.Minute)
+	eventually(t, s, "refresh", func(e cron.Entry) bool { return e.Skipped == 1 })
+	clock.Advance(time.Minute)
+	e = eventually(t, s, "refresh", func(e cron.Entry) bool { return e.Skipped == 2 })
+	if !e.LastRun.Equal(start.Add(time.Minute)) || !e.NextRun.Equal(start.Add(4*time.Minute)) {
+		t.Fatalf("expected last run at %v and next run at %v, got: %+v", start.Add(time.Minute), start.Add(4*time.Minute), e)
+	}
+
+	release <- struct{}{}
+	e = eventually(t, s, "refresh", func(e cron.Entry) bool { return !e.Running })
+	if e.LastStatus.State != csb.Done || e.LastStatus.Error != nil {
+		t.Fatalf("expected done status, got: %+v", e.LastStatus)
+	}
+
+	// runs missed while the scheduler was busy collapse in a single run.
+	clock.Advance(3 * time.Minute)
+	select {
+	case <-started:
+	case <-time.After(timeout):
+		t.Fatal("expected the schedule to publish a transaction")
+	}
+	e = eventually(t, s, "refresh", func(e cron.Entry) bool { return e.Running })
+	if !e.LastRun.Equal(start.Add(6*time.Minute)) || !e.NextRun.Equal(start.Add(7*time.Minute)) || e.Skipped != 2 {
+		t.Fatalf("expected last run at %v and next run at %v, got: %+v", start.Add(6*time.Minute), start.Add(7*time.Minute), e)
+	}
+	release <- struct{}{}
+}
+
+func TestScheduler_Close(t *testing.T) {
+	clock := newFakeClock(time.Date(2022, 5, 2, 10, 0, 0, 0, time.UTC))
+
+	started := make(chan *csb.Transaction, 1)
+	queue := inmem.NewWorkQueue(func(transaction *csb.Transaction) error {
+		started <- transaction
+		<-transaction.Ctx.Done()
+		return transaction.Ctx.Err()
+	})
+	defer queue.Close()
+
+	s, err := cron.NewScheduler(queue, []csb.Schedule{{Name: "refresh", Spec: "@hourly"}}, cron.WithClock(clock))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Start()
+
+	clock.Advance(time.Hour)
+	var transaction *csb.Transaction
+	select {
+	case transaction = <-started:
+	case <-time.After(timeout):
+		t.Fatal("expected the schedule to publish a transaction")
+	}
+
+	// close cancels the running transaction and waits for the scheduler to stop.
+	closed := make(chan struct{})
+	go func() {
+		s.Close()
+		close(closed)
+	}()
+	select {
+	case <-closed:
+	case <-time.After(timeout):
+		t.Fatal("expected close to return")
+	}
+	if transaction.Ctx.Err() == nil {
+		t.Fatal("expected the transaction context to be cancelled")
+	}
+	if e, _ := s.Entry("refresh"); e.Running {
+		t.Fatalf("expected the entry to stop running, got: %+v", e)
+	}
+
+	// the closed scheduler doesent publish anymore.
+	clock.Advance(time.Hour)
+	select {
+	case transaction := <-started:
+		t.Fatalf("unexpected transaction published: %v", transaction.Id)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestScheduler_Schedules(t *testing.T) {
+	queue := inmem.NewWorkQueue(func(*csb.Transaction) error { return nil })
+	defer queue.Close()
+
+	clock := newFakeClock(time.Date(2022, 5, 2, 10, 0, 0, 0, time.UTC))
+	s, err := cron.NewScheduler(queue, []csb.Schedule{
+		{Name: "daily", Spec: "@daily"},
+		{Name: "hourly", Spec: "@hourly"},
+		{Name: "never", Spec: "0 0 30 2 *"},
+	}, cron.WithClock(clock), cron.WithLocation(time.UTC))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	entries := s.Entries()
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Schedule.Name)
+	}
+	if want := []string{"hourly", "daily", "never"}; len(names) != len(want) || names[0] != want[0] || names[1] != want[1] || names[2] != want[2] {
+		t.Fatalf("expected entries %v, got: %v", want, names)
+	}
+
+	if err := s.Add(csb.Schedule{Name: "daily", Spec: "@daily"}); csb.ErrorCode(err) != csb.ECONFLICT {
+		t.Fatalf("expected ECONFLICT, got: %v", err)
+	}
+	if err := s.Add(csb.Schedule{Name: "bad", Spec: "* * *"}); csb.ErrorCode(err) != csb.EINVALID {
+		t.Fatalf("expected EINVALID, got: %v", err)
+	}
+	if err := s.Remove("daily"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Entry("daily"); csb.ErrorCode(err) != csb.ENOTFOUND {
+		t.Fatalf("expected ENOTFOUND, got: %v", err)
+	}
+}
+
+func TestNewSchedulerFromConfig(t *testing.T) {
+	queue := inmem.NewWorkQueue(func(*csb.Transaction) error { return nil })
+	defer queue.Close()
+
+	var conf csb.Config
+	conf.Scheduler.Location = "Europe/Bucharest"
+	conf.Scheduler.Schedules = []csb.Schedule{{Name: "evening", Spec: "0 18 * * *"}}
+
+	// 2022-05-02 15:30 UTC is 18:30 in Bucharest.
+	clock := newFakeClock(time.Date(2022, 5, 2, 15, 30, 0, 0, time.UTC))
+	s, err := cron.NewSchedulerFromConfig(queue, conf, cron.WithClock(clock))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	e, err := s.Entry("evening")
+	if err != nil {
+		t.Fatal(err)
+	} else if want := time.Date(2022, 5, 3, 15, 0, 0, 0, time.UTC); !e.NextRun.Equal(want) {
+		t.Fatalf("expected next run at %v, got: %v", want, e.NextRun)
+	} else if loc := e.NextRun.Location().String(); loc != "Europe/Bucharest" {
+		t.Fatalf("expected location Europe/Bucharest, got: %v", loc)
+	}
+
+	conf.Scheduler.Location = "Europe/Nowhere"
+	if _, err := cron.NewSchedulerFromConfig(queue, conf); csb.ErrorCode(err) != csb.EINVALID {
+		t.Fatalf("expected EINVALID for an unknown location, got: %v", err)
+	}
+
+	conf.Scheduler.Location = ""
+	conf.Scheduler.Schedules = append(conf.Scheduler.Schedules, csb.Schedule{Name: "bad", Spec: "61 * * * *"})
+	if _, err := cron.NewSchedulerFromConfig(queue, conf); csb.ErrorCode(err) != csb.EINVALID {
+		t.Fatalf("expected EINVALID for an invalid schedule, got: %v", err)
+	}
+}
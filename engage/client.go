@@ -5,13 +5,16 @@ import (
 	"context"
 	"encoding/json"
 	"net/http"
+	"strconv"
 	"strings"
 
 	csb "github.com/Lambels/CSB-Open-API"
 )
 
+// DefaultBaseURL is the base url of the school's engage report comment services.
+const DefaultBaseURL = "https://cambridgeschoolportal.engagehosted.com/Services/ReportCommentServices.asmx/"
+
 var (
-	baseURL               = "https://cambridgeschoolportal.engagehosted.com/Services/ReportCommentServices.asmx/"
 	academicYearsURL      = "GetMarksheetAcademicYears"
 	reportingPeriodsURL   = "GetReportingPeriods"
 	reportingSubjectsURL  = "GetPupilMarksheetSubjects"
@@ -21,21 +24,46 @@ var (
 
 // Client is a client used to interface with the engage api.
 type Client struct {
-	cc *http.Client
+	// BaseURL is the url of the engage services the endpoints are resolved against,
+	// it must end in a slash.
+	//
+	// Defaults to DefaultBaseURL.
+	BaseURL string
+
+	// Limiter limits the rate of requests sent to engage, it should be shared by all
+	// clients talking to the same engage portal, how long requests waited for it is in its
+	// Stats. A nil limiter disables rate limiting.
+	//
+	// Defaults to a limiter allowing DefaultRate requests per second with bursts of DefaultBurst.
+	Limiter *Limiter
+
+	// Retry is the policy used to retry failed lookups.
+	//
+	// Defaults to DefaultRetryPolicy.
+	Retry RetryPolicy
+
+	// token is the static cookie used when the client has no session.
+	token   string
+	session *Session
+	cc      *http.Client
 }
 
 // GetAcademicYears gets all the possible academic years for a PID.
 func (c *Client) GetAcademicYears(ctx context.Context, pid int) ([]int, error) {
-	resURL := baseURL + academicYearsURL
+	resURL := c.BaseURL + academicYearsURL
 
-	res, err := c.post(ctx, resURL, engageContext{PupilIDs: pid})
+	res, err := c.post(ctx, resURL, engageContext{PupilIDs: strconv.Itoa(pid)})
 	if err != nil {
 		return nil, err
 	}
 
-	out := make([]string, len(res.D))
+	out := make([]int, 0, len(res.D))
 	for _, data := range res.D {
-		out = append(out, data.Value)
+		year, err := strconv.Atoi(data.Value)
+		if err != nil {
+			return nil, csb.Errorf(csb.EINTERNAL, "engage: invalid academic year: %v", data.Value)
+		}
+		out = append(out, year)
 	}
 
 	return out, nil
@@ -43,17 +71,17 @@ func (c *Client) GetAcademicYears(ctx context.Context, pid int) ([]int, error) {
 
 // GetReportingPeriods gets the reporting periods for a PID in a specific range of academic years.
 func (c *Client) GetReportingPeriods(ctx context.Context, pid int, academicYears []int) ([]string, error) {
-	resURL := baseURL + reportingPeriodsURL
+	resURL := c.BaseURL + reportingPeriodsURL
 
 	res, err := c.post(ctx, resURL, engageContext{
-		PupilIDs:      pid,
-		AcademicYears: strings.Join(academicYears, ","),
+		PupilIDs:      strconv.Itoa(pid),
+		AcademicYears: joinInts(academicYears),
 	})
 	if err != nil {
 		return nil, err
 	}
 
-	out := make([]string, len(res.D))
+	out := make([]string, 0, len(res.D))
 	for _, data := range res.D {
 		out = append(out, data.Value)
 	}
@@ -61,20 +89,52 @@ func (c *Client) GetReportingPeriods(ctx context.Context, pid int, academicYears
 	return out, nil
 }
 
+// GetPeriods gets the reporting periods for a PID in an academic year and parses their labels
+// into full periods, in the order engage lists them.
+//
+// Reporting periods whose label doesnt name a term are skipped.
+func (c *Client) GetPeriods(ctx context.Context, pid int, academicYear int) ([]ReportingPeriod, error) {
+	resURL := c.BaseURL + reportingPeriodsURL
+
+	res, err := c.post(ctx, resURL, engageContext{
+		PupilIDs:      strconv.Itoa(pid),
+		AcademicYears: strconv.Itoa(academicYear),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]ReportingPeriod, 0, len(res.D))
+	for _, data := range res.D {
+		period, err := parsePeriod(strconv.Itoa(academicYear), data.Text)
+		if err != nil {
+			continue
+		}
+
+		out = append(out, ReportingPeriod{
+			Value:  data.Value,
+			Label:  data.Text,
+			Period: period,
+		})
+	}
+
+	return out, nil
+}
+
 // GetReportingSubjects gets the reporting subjects for a PID in a specific range of academic years and reporting periods.
 func (c *Client) GetReportingSubjects(ctx context.Context, pid int, academicYears []int, reportingPeriods []string) ([]csb.Subject, error) {
-	resURL := baseURL + reportingSubjectsURL
+	resURL := c.BaseURL + reportingSubjectsURL
 
 	res, err := c.post(ctx, resURL, engageContext{
-		PupilIDs:         pid,
-		AcademicYears:    strings.Join(academicYears, ","),
+		PupilIDs:         strconv.Itoa(pid),
+		AcademicYears:    joinInts(academicYears),
 		ReportingPeriods: strings.Join(reportingPeriods, ","),
 	})
 	if err != nil {
 		return nil, err
 	}
 
-	out := make([]csb.Subject, len(res.D))
+	out := make([]csb.Subject, 0, len(res.D))
 	for _, data := range res.D {
 		out = append(out, csb.Subject(data.Value))
 	}
@@ -82,14 +142,55 @@ func (c *Client) GetReportingSubjects(ctx context.Context, pid int, academicYear
 	return out, nil
 }
 
+// GetSubjects gets the reporting subjects for a PID in a specific range of academic years and
+// reporting periods along side the names engage displays for them.
+func (c *Client) GetSubjects(ctx context.Context, pid int, academicYears []int, reportingPeriods []string) ([]csb.SubjectInfo, error) {
+	resURL := c.BaseURL + reportingSubjectsURL
+
+	res, err := c.post(ctx, resURL, engageContext{
+		PupilIDs:         strconv.Itoa(pid),
+		AcademicYears:    joinInts(academicYears),
+		ReportingPeriods: strings.Join(reportingPeriods, ","),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]csb.SubjectInfo, 0, len(res.D))
+	for _, data := range res.D {
+		out = append(out, csb.SubjectInfo{
+			Code: csb.Subject(data.Value),
+			Name: strings.TrimSpace(data.Text),
+		})
+	}
+
+	return out, nil
+}
+
 // GetColumnsForSubjects gets the "columns" for a pid in a specified academic years and periods range for the specified subjects.
 // A column refers to the type of exam.
 func (c *Client) GetColumnsForSubjects(ctx context.Context, pid int, academicYears []int, reportingPeriods []string, subjects []csb.Subject) ([]string, error) {
-	resURL := baseURL + reportingPeriodsURL
+	columns, err := c.GetColumns(ctx, pid, academicYears, reportingPeriods, subjects)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]string, 0, len(columns))
+	for _, column := range columns {
+		out = append(out, column.ID)
+	}
+
+	return out, nil
+}
+
+// GetColumns gets the marksheet columns for a pid in a specified academic years and periods
+// range for the specified subjects along side their names and types.
+func (c *Client) GetColumns(ctx context.Context, pid int, academicYears []int, reportingPeriods []string, subjects []csb.Subject) ([]csb.Column, error) {
+	resURL := c.BaseURL + columnsForSubjectsURL
 
 	res, err := c.post(ctx, resURL, engageContext{
-		PupilIDs:         pid,
-		AcademicYears:    strings.Join(academicYears, ","),
+		PupilIDs:         strconv.Itoa(pid),
+		AcademicYears:    joinInts(academicYears),
 		ReportingPeriods: strings.Join(reportingPeriods, ","),
 		SubjectList:      csb.Concat(subjects),
 	})
@@ -97,44 +198,115 @@ func (c *Client) GetColumnsForSubjects(ctx context.Context, pid int, academicYea
 		return nil, err
 	}
 
-	out := make([]string, len(res.D))
+	out := make([]csb.Column, 0, len(res.D))
 	for _, data := range res.D {
-		out = append(out, data.Value)
+		out = append(out, csb.Column{
+			ID:   data.Value,
+			Name: strings.TrimSpace(data.Text),
+			Type: columnType(data.Attributes.ColumnType, data.Text),
+		})
 	}
 
 	return out, nil
 }
 
-func (c *Client) GetMarksheetRender(ctx context.Context, pid int, academicYears []int, subjectColumns, reportingPeriods []string, reportingSubjects []csb.Subject) (string, error) {
-	return "", nil
+// GetMarkColumns gets the columns holding marks for a pid in a specified academic years and
+// periods range for the specified subjects.
+func (c *Client) GetMarkColumns(ctx context.Context, pid int, academicYears []int, reportingPeriods []string, subjects []csb.Subject) ([]csb.Column, error) {
+	columns, err := c.GetColumns(ctx, pid, academicYears, reportingPeriods, subjects)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]csb.Column, 0, len(columns))
+	for _, column := range columns {
+		if column.Type != csb.COLUMN_COMMENT {
+			out = append(out, column)
+		}
+	}
+
+	return out, nil
 }
 
-// post sends a post request to url with the specified engage context. It checks for any errors during
-// the exchange process with engage. It returns an engage response which has
-// at least one piece of data inside.
-func (c *Client) post(ctx context.Context, url string, engCtx engageContext) (res *engageResponse, err error) {
-	body, err := json.Marshal(engCtx)
+// GetCommentColumns gets the report comment columns for a pid in a specified academic years and
+// periods range for the specified subjects.
+func (c *Client) GetCommentColumns(ctx context.Context, pid int, academicYears []int, reportingPeriods []string, subjects []csb.Subject) ([]csb.Column, error) {
+	columns, err := c.GetColumns(ctx, pid, academicYears, reportingPeriods, subjects)
 	if err != nil {
 		return nil, err
 	}
 
-	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	out := make([]csb.Column, 0)
+	for _, column := range columns {
+		if column.Type == csb.COLUMN_COMMENT {
+			out = append(out, column)
+		}
+	}
+
+	return out, nil
+}
+
+// GetMarksheetRender renders the marksheet of a pid for the specified academic years, periods, subjects
+// and columns and parses it into marks, a mark per filled column.
+//
+// The returned marks have the student id, subject, teacher, column, value and a full period
+// populated, the percentage is populated for numeric columns.
+func (c *Client) GetMarksheetRender(ctx context.Context, pid int, academicYears []int, subjectColumns []csb.Column, reportingPeriods []string, reportingSubjects []csb.Subject) ([]*csb.Mark, error) {
+	sheet, err := c.render(ctx, pid, academicYears, subjectColumns, reportingPeriods, reportingSubjects)
 	if err != nil {
 		return nil, err
 	}
-	req.Header.Add("Content-Type", "application/json")
 
-	resp, err := c.cc.Do(req)
+	return sheet.marks, nil
+}
+
+// GetComments renders the marksheet of a pid for the specified academic years, periods, subjects
+// and comment columns and parses it into report comments.
+//
+// The returned comments have the student id, subject, teacher, text and a full period populated.
+func (c *Client) GetComments(ctx context.Context, pid int, academicYears []int, commentColumns []csb.Column, reportingPeriods []string, reportingSubjects []csb.Subject) ([]*csb.Comment, error) {
+	sheet, err := c.render(ctx, pid, academicYears, commentColumns, reportingPeriods, reportingSubjects)
 	if err != nil {
 		return nil, err
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		return nil, decodeError(resp)
+	return sheet.comments, nil
+}
+
+// render renders the marksheet of a pid with the columns and parses it.
+func (c *Client) render(ctx context.Context, pid int, academicYears []int, columns []csb.Column, reportingPeriods []string, reportingSubjects []csb.Subject) (*marksheet, error) {
+	resURL := c.BaseURL + marksheetRenderURL
+
+	ids := make([]string, 0, len(columns))
+	for _, column := range columns {
+		ids = append(ids, column.ID)
+	}
+
+	var res renderResponse
+	if err := c.do(ctx, resURL, engageContext{
+		PupilIDs:         strconv.Itoa(pid),
+		AcademicYears:    joinInts(academicYears),
+		ReportingPeriods: strings.Join(reportingPeriods, ","),
+		SubjectList:      csb.Concat(reportingSubjects),
+		ColumnList:       strings.Join(ids, ","),
+	}, &res); err != nil {
+		return nil, err
+	}
+
+	// an empty render is engage's way of saying the pid is invalid, same as with post.
+	if strings.TrimSpace(res.D) == "" {
+		return nil, csb.Errorf(csb.ENOTFOUND, "engage: invalid PID: %v", pid)
 	}
 
-	if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
+	return parseMarksheet(pid, strings.NewReader(res.D), columns)
+}
+
+// post sends a post request to url with the specified engage context. It checks for any errors during
+// the exchange process with engage. It returns an engage response which has
+// at least one piece of data inside.
+func (c *Client) post(ctx context.Context, url string, engCtx engageContext) (*engageResponse, error) {
+	var res engageResponse
+	if err := c.do(ctx, url, engCtx, &res); err != nil {
 		return nil, err
 	}
 
@@ -144,28 +316,169 @@ func (c *Client) post(ctx context.Context, url string, engCtx engageContext) (re
 		return nil, csb.Errorf(csb.ENOTFOUND, "engage: invalid PID: %v", engCtx.PupilIDs)
 	}
 
-	return res, nil
+	return &res, nil
 }
 
-// NewClient creates a new engage client with the provided token used for
-// authentification.
-func NewClient(c *http.Client, token string) *Client {
-	c.Transport = &cookieHeaderTransport{
-		cookie: token,
-		d:      c.Transport,
+// do sends a post request to url with the specified engage context and decodes the response
+// body in v.
+//
+// Engage lookups are idempotent, failed attempts are retried following the client retry policy.
+// If the client has a session and it expired, the session is renewed once and the request
+// replayed.
+func (c *Client) do(ctx context.Context, url string, engCtx engageContext, v interface{}) error {
+	body, err := json.Marshal(engCtx)
+	if err != nil {
+		return err
+	}
+
+	cookie, err := c.cookie(ctx)
+	if err != nil {
+		return err
+	}
+
+	renewed := false
+	for attempt := 0; ; attempt++ {
+		retry, err := c.doOnce(ctx, url, cookie, body, v)
+		if err == nil {
+			return nil
+		}
+
+		// the session expired, log in again and replay the request.
+		if c.session != nil && !renewed && csb.ErrorCode(err) == csb.EUNAUTHORIZED {
+			renewed = true
+			if cookie, err = c.renew(ctx, cookie); err != nil {
+				return err
+			}
+			attempt--
+			continue
+		}
+
+		if !retry || attempt+1 >= c.Retry.MaxAttempts {
+			return err
+		}
+
+		if err := c.Retry.sleep(ctx, attempt); err != nil {
+			return err
+		}
+	}
+}
+
+// cookie returns the cookie used to authenticate requests, logging in if the client has a
+// session which isnt logged in yet.
+func (c *Client) cookie(ctx context.Context) (string, error) {
+	if c.session == nil {
+		return c.token, nil
+	}
+
+	if cookie, ok := c.session.Cookie(); ok {
+		return cookie, nil
+	}
+	return c.renew(ctx, "")
+}
+
+// renew renews the client session which was last seen with cookie = stale and returns the
+// new cookie.
+func (c *Client) renew(ctx context.Context, stale string) (string, error) {
+	if c.Limiter != nil {
+		if err := c.Limiter.Wait(ctx); err != nil {
+			return "", err
+		}
+	}
+	return c.session.Renew(ctx, stale)
+}
+
+// doOnce sends a single post request with body to url, authenticated with cookie, and decodes
+// the response body in v. It reports wether a failed request is worth retrying.
+func (c *Client) doOnce(ctx context.Context, url, cookie string, body []byte, v interface{}) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Add("Content-Type", "application/json")
+	if cookie != "" {
+		req.Header.Add("Cookie", cookie)
+	}
+
+	if c.Limiter != nil {
+		if err := c.Limiter.Wait(ctx); err != nil {
+			return false, err
+		}
+	}
+
+	resp, err := c.cc.Do(req)
+	if err != nil {
+		return retryableErr(ctx, err), err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		err := decodeError(resp)
+		// known engage exceptions wont go away by retrying.
+		return retryableStatus(resp.StatusCode) && csb.ErrorCode(err) == csb.EINTERNAL, err
 	}
 
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return retryableErr(ctx, err), err
+	}
+	return false, nil
+}
+
+// joinInts joins elems in a format usable as a parameter for an engage request.
+func joinInts(elems []int) string {
+	strs := make([]string, len(elems))
+	for i, v := range elems {
+		strs[i] = strconv.Itoa(v)
+	}
+	return strings.Join(strs, ",")
+}
+
+// NewClient creates a new engage client with the provided token used for
+// authentification. The token is the raw cookie header of a logged in engage session.
+func NewClient(c *http.Client, token string) *Client {
 	return &Client{
-		cc: c,
+		BaseURL: DefaultBaseURL,
+		Limiter: NewLimiter(DefaultRate, DefaultBurst),
+		Retry:   DefaultRetryPolicy,
+		token:   token,
+		cc:      c,
 	}
 }
 
-type cookieHeaderTransport struct {
-	cookie string
-	d      http.RoundTripper
+// NewSessionClient creates a new engage client authenticated by session. The session logs in
+// on the first request and whenever engage reports it expired.
+func NewSessionClient(c *http.Client, session *Session) *Client {
+	client := NewClient(c, "")
+	client.session = session
+	return client
 }
 
-func (t *cookieHeaderTransport) RoundTrip(r *http.Request) (*http.Response, error) {
-	r.Header.Add("Cookie", t.cookie)
-	return t.d.RoundTrip(r)
+// NewClientFromConfig creates a new engage client from the engage config. The client logs in
+// with the credentials if a username is set and authenticates with the token otherwise, its
+// limiter allows the configured requests per second and burst.
+func NewClientFromConfig(c *http.Client, conf csb.Config) *Client {
+	var client *Client
+	if conf.Engage.Username != "" {
+		session := NewSession(c, Credentials{Username: conf.Engage.Username, Password: conf.Engage.Password})
+		if conf.Engage.LoginURL != "" {
+			session.LoginURL = conf.Engage.LoginURL
+		}
+		client = NewSessionClient(c, session)
+	} else {
+		client = NewClient(c, conf.Engage.Token)
+	}
+
+	if conf.Engage.BaseURL != "" {
+		client.BaseURL = conf.Engage.BaseURL
+	}
+
+	rate, burst := conf.Engage.RequestsPerSecond, conf.Engage.Burst
+	if rate == 0 {
+		rate = DefaultRate
+	}
+	if burst == 0 {
+		burst = DefaultBurst
+	}
+	client.Limiter = NewLimiter(rate, burst)
+
+	return client
 }
@@ -0,0 +1,84 @@
+package engage_test
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	csb "github.com/Lambels/CSB-Open-API"
+	"github.com/Lambels/CSB-Open-API/engage"
+	"github.com/Lambels/CSB-Open-API/engage/engagetest"
+)
+
+func TestClient_Retry(t *testing.T) {
+	unavailable := engagetest.Error{
+		Status:  http.StatusServiceUnavailable,
+		Message: "Service Unavailable",
+	}
+	invalid := engagetest.Error{
+		Status:        http.StatusInternalServerError,
+		Message:       "Value cannot be null.",
+		ExceptionType: "System.ArgumentNullException",
+	}
+
+	tests := []struct {
+		name     string
+		err      engagetest.Error
+		times    int
+		code     string
+		requests int
+	}{
+		{name: "transient", err: unavailable, times: 2, code: "", requests: 3},
+		{name: "non retryable", err: invalid, code: csb.EINVALID, requests: 1},
+		{name: "exhausted", err: unavailable, code: csb.EINTERNAL, requests: 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := engagetest.NewServer(engagetest.Fixture())
+			defer s.Close()
+
+			c := s.EngageClient("")
+			c.Limiter = nil
+			c.Retry = engage.RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond, MaxDelay: 5 * time.Millisecond}
+
+			tt.err.Times = tt.times
+			s.SetError(engagetest.AcademicYears, tt.err)
+
+			_, err := c.GetAcademicYears(context.Background(), 1001)
+			if code := csb.ErrorCode(err); code != tt.code {
+				t.Fatalf("expected code %q, got: %v", tt.code, err)
+			}
+			if n := s.Requests(engagetest.AcademicYears); n != tt.requests {
+				t.Fatalf("expected %v requests, got: %v", tt.requests, n)
+			}
+		})
+	}
+}
+
+func TestClient_RenewOnce(t *testing.T) {
+	s := engagetest.NewServer(engagetest.Fixture())
+	defer s.Close()
+
+	creds := engage.Credentials{Username: "user", Password: "pass"}
+	s.RequireLogin(creds)
+	c := s.SessionClient(creds)
+	c.Limiter = nil
+	c.Retry = engage.RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond}
+
+	// the session keeps being reported as expired, the client logs in again once and gives up.
+	s.SetError(engagetest.AcademicYears, engagetest.Error{
+		Status:        http.StatusUnauthorized,
+		Message:       "Authentication failed.",
+		ExceptionType: "System.InvalidOperationException",
+	})
+	if _, err := c.GetAcademicYears(context.Background(), 1001); csb.ErrorCode(err) != csb.EUNAUTHORIZED {
+		t.Fatalf("expected EUNAUTHORIZED, got: %v", err)
+	}
+	if n := s.Logins(); n != 2 {
+		t.Fatalf("expected 2 logins, got: %v", n)
+	}
+	if n := s.Requests(engagetest.AcademicYears); n != 2 {
+		t.Fatalf("expected 2 requests, got: %v", n)
+	}
+}
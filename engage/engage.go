@@ -4,8 +4,9 @@ import (
 	"encoding/json"
 	"io"
 	"net/http"
+	"strings"
 
-	"github.com/Lambels/go-csb"
+	csb "github.com/Lambels/CSB-Open-API"
 )
 
 // engageContext holds all relevant information when making a engage request.
@@ -19,6 +20,7 @@ type engageContext struct {
 	SubjectList      string `json:"subjectList,omitempty"`
 	DivisionList     string `json:"divisionList,omitempty"`
 	BatchList        string `json:"batchList,omitempty"`
+	ColumnList       string `json:"columnList,omitempty"`
 	PupilIDs         string `json:"pupilIDs"`
 }
 
@@ -28,6 +30,12 @@ type engageResponse struct {
 	D []engageData `json:"d"`
 }
 
+// renderResponse encapsulates the response of a marksheet render, the rendered marksheet
+// is held as markup in the d field.
+type renderResponse struct {
+	D string `json:"d"`
+}
+
 type engageData struct {
 	Type       string `json:"__type"`
 	Text       string `json:"Text"`
@@ -47,22 +55,69 @@ type engageError struct {
 	ExceptionType string `json:"ExceptionType"`
 }
 
+// exceptionCodes maps engage exception types to csb error codes.
+var exceptionCodes = map[string]string{
+	"System.UnauthorizedAccessException":              csb.EUNAUTHORIZED,
+	"System.Security.SecurityException":               csb.EUNAUTHORIZED,
+	"System.ArgumentException":                        csb.EINVALID,
+	"System.ArgumentNullException":                    csb.EINVALID,
+	"System.ArgumentOutOfRangeException":              csb.EINVALID,
+	"System.FormatException":                          csb.EINVALID,
+	"System.InvalidCastException":                     csb.EINVALID,
+	"System.OverflowException":                        csb.EINVALID,
+	"System.Collections.Generic.KeyNotFoundException": csb.ENOTFOUND,
+	"System.NotImplementedException":                  csb.ENOTIMPLEMENTED,
+	"System.NotSupportedException":                    csb.ENOTIMPLEMENTED,
+}
+
+// statusCodes maps http status codes to csb error codes, used when the exception type of an
+// error isnt known.
+var statusCodes = map[int]string{
+	http.StatusBadRequest:   csb.EINVALID,
+	http.StatusUnauthorized: csb.EUNAUTHORIZED,
+	http.StatusForbidden:    csb.EUNAUTHORIZED,
+	http.StatusNotFound:     csb.ENOTFOUND,
+}
+
 // decodeError tries to decode the body of a non OK status request in an error
 // understandable by the rest of the api.
+//
+// The error code is chosen from the exception type of the engage error and falls back on the
+// status code of the response. An expired session is reported as EUNAUTHORIZED.
 func decodeError(resp *http.Response) error {
+	code, ok := statusCodes[resp.StatusCode]
+	if !ok {
+		code = csb.EINTERNAL
+	}
+
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
 		return err
 	}
 
 	if len(body) == 0 {
-		return csb.HttpStatusErrorf(resp.StatusCode, "engage: error body empty")
+		return csb.Errorf(code, "engage: status %v: error body empty", resp.StatusCode)
 	}
 
 	var engErr engageError
 	if err := json.Unmarshal(body, &engErr); err != nil {
-		return csb.HttpStatusErrorf(resp.StatusCode, "engage: couldnt decode error body")
+		return csb.Errorf(code, "engage: status %v: couldnt decode error body", resp.StatusCode)
+	}
+
+	return csb.Errorf(classifyError(code, engErr), "engage: status %v: %v , stack trace: %v , exception type: %v", resp.StatusCode, engErr.Message, engErr.StackTrace, engErr.ExceptionType)
+}
+
+// classifyError returns the csb error code of engErr, code is returned if the exception
+// isnt recognised.
+func classifyError(code string, engErr engageError) string {
+	// asmx services report failed authentication (expired session) as an invalid operation
+	// or a soap exception, only the message tells it apart from other faults of those types.
+	if strings.Contains(strings.ToLower(engErr.Message), "authentication failed") {
+		return csb.EUNAUTHORIZED
 	}
 
-	return csb.HttpStatusErrorf(resp.StatusCode, "engage: %v , stack trace: %v , exception type: %v", engErr.Message, engErr.StackTrace, engErr.ExceptionType)
+	if v, ok := exceptionCodes[engErr.ExceptionType]; ok {
+		return v
+	}
+	return code
 }
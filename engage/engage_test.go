@@ -0,0 +1,61 @@
+package engage
+
+import (
+	"testing"
+
+	csb "github.com/Lambels/CSB-Open-API"
+)
+
+func TestClassifyError(t *testing.T) {
+	tests := []struct {
+		name   string
+		code   string
+		engErr engageError
+		want   string
+	}{
+		{
+			name:   "expired session",
+			code:   csb.EINTERNAL,
+			engErr: engageError{Message: "Authentication failed.", ExceptionType: "System.InvalidOperationException"},
+			want:   csb.EUNAUTHORIZED,
+		},
+		{
+			name:   "soap authentication fault",
+			code:   csb.EINTERNAL,
+			engErr: engageError{Message: "Server was unable to process request. ---> Authentication failed.", ExceptionType: "System.Web.Services.Protocols.SoapException"},
+			want:   csb.EUNAUTHORIZED,
+		},
+		{
+			name:   "soap fault",
+			code:   csb.EINTERNAL,
+			engErr: engageError{Message: "Server was unable to process request. ---> Timeout expired.", ExceptionType: "System.Web.Services.Protocols.SoapException"},
+			want:   csb.EINTERNAL,
+		},
+		{
+			name:   "soap fault with status",
+			code:   csb.EINVALID,
+			engErr: engageError{Message: "Server was unable to read request.", ExceptionType: "System.Web.Services.Protocols.SoapException"},
+			want:   csb.EINVALID,
+		},
+		{
+			name:   "invalid operation",
+			code:   csb.EINTERNAL,
+			engErr: engageError{Message: "Request format is invalid.", ExceptionType: "System.InvalidOperationException"},
+			want:   csb.EINTERNAL,
+		},
+		{
+			name:   "known exception",
+			code:   csb.EINTERNAL,
+			engErr: engageError{Message: "Input string was not in a correct format.", ExceptionType: "System.FormatException"},
+			want:   csb.EINVALID,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := classifyError(tt.code, tt.engErr); got != tt.want {
+				t.Fatalf("expected %v, got: %v", tt.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,50 @@
+package engagetest
+
+import (
+	_ "embed"
+	"encoding/json"
+	"io"
+
+	csb "github.com/Lambels/CSB-Open-API"
+)
+
+//go:embed fixture.json
+var fixture []byte
+
+// Fixture returns a fresh copy of the default fixture of students and their marks.
+func Fixture() []*csb.Student {
+	var students []*csb.Student
+	if err := json.Unmarshal(fixture, &students); err != nil {
+		panic(err)
+	}
+	return students
+}
+
+// ReadFixture decodes a json fixture of students, their marks and comments from r, the format
+// is the same as the json encoding of csb students.
+func ReadFixture(r io.Reader) ([]*csb.Student, error) {
+	var students []*csb.Student
+	if err := json.NewDecoder(r).Decode(&students); err != nil {
+		return nil, err
+	}
+
+	for _, student := range students {
+		for _, mark := range student.Marks {
+			full, err := mark.Period.Full()
+			if err != nil {
+				return nil, err
+			} else if !full {
+				return nil, csb.Errorf(csb.EINVALID, "engagetest: mark of student %v has no full period", student.PID)
+			}
+		}
+		for _, comment := range student.Comments {
+			full, err := comment.Period.Full()
+			if err != nil {
+				return nil, err
+			} else if !full {
+				return nil, csb.Errorf(csb.EINVALID, "engagetest: comment of student %v has no full period", student.PID)
+			}
+		}
+	}
+	return students, nil
+}
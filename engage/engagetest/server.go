@@ -0,0 +1,769 @@
+// Package engagetest provides a fake engage server speaking the same ASMX JSON protocol as
+// the school's engage portal, for offline development and tests.
+package engagetest
+
+import (
+	"encoding/json"
+	"fmt"
+	"html"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	csb "github.com/Lambels/CSB-Open-API"
+	"github.com/Lambels/CSB-Open-API/engage"
+)
+
+// servicesPath is the path of the report comment services on the server.
+const servicesPath = "/Services/ReportCommentServices.asmx/"
+
+// LoginPath is the path of the fake login form.
+const LoginPath = "/Login.aspx"
+
+// AuthCookie is the name of the cookie issued by the fake login form.
+const AuthCookie = ".ASPXAUTH"
+
+// FormCookie is the name of the cookie issued with the fake login form, the form has to be
+// posted back with it.
+const FormCookie = "ASP.NET_SessionId"
+
+// Fields of the fake login form.
+const (
+	usernameField = "ctl00$PageContent$txtUsername"
+	passwordField = "ctl00$PageContent$txtPassword"
+	loginButton   = "ctl00$PageContent$btnLogin"
+	viewState     = "/wEPDwUKMTY1NDU2MTA1MmRkfake"
+)
+
+// loginForm is the markup of the fake login form, formatted with the action, view state and
+// event validation.
+const loginForm = `<!DOCTYPE html>
+<html>
+<head><title>Engage - Login</title></head>
+<body>
+<form method="post" action="%v" id="aspnetForm">
+<div class="aspNetHidden">
+<input type="hidden" name="__EVENTTARGET" id="__EVENTTARGET" value="" />
+<input type="hidden" name="__EVENTARGUMENT" id="__EVENTARGUMENT" value="" />
+<input type="hidden" name="__VIEWSTATE" id="__VIEWSTATE" value="%v" />
+<input type="hidden" name="__VIEWSTATEGENERATOR" id="__VIEWSTATEGENERATOR" value="C2EE9ABB" />
+<input type="hidden" name="__EVENTVALIDATION" id="__EVENTVALIDATION" value="%v" />
+</div>
+<label for="txtUsername">Username</label>
+<input name="ctl00$PageContent$txtUsername" type="text" id="txtUsername" />
+<label for="txtPassword">Password</label>
+<input name="ctl00$PageContent$txtPassword" type="password" id="txtPassword" />
+<input type="submit" name="ctl00$PageContent$btnLogin" value="Log In" id="btnLogin" />
+<input type="submit" name="ctl00$PageContent$btnForgotten" value="Forgotten Password" id="btnForgotten" />
+</form>
+</body>
+</html>`
+
+// Endpoints served by the fake server.
+const (
+	AcademicYears      = "GetMarksheetAcademicYears"
+	ReportingPeriods   = "GetReportingPeriods"
+	ReportingSubjects  = "GetPupilMarksheetSubjects"
+	ColumnsForSubjects = "GetColumnsForSubjects"
+	MarksheetRender    = "RenderPupilMarksheet"
+)
+
+// Columns served by the fake server.
+const (
+	markColumn    = "1"
+	commentColumn = "2"
+)
+
+// Error represents an error injected in the server, it is written back as an engage exception.
+type Error struct {
+	// Status is the http status code of the response.
+	Status int
+	// Message of the engage exception.
+	Message string
+	// ExceptionType of the engage exception.
+	ExceptionType string
+	// Times is the amount of requests failed before the error clears itself, 0 fails every
+	// request until the error is cleared.
+	Times int
+}
+
+// Server is a fake engage server seeded with students and their marks.
+//
+// Unknown pupil ids are answered the same way engage does: with an OK status and an empty
+// d field.
+type Server struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	students map[int]*csb.Student
+	latency  time.Duration
+	errs     map[string]Error
+	// requests counts the requests made to each endpoint.
+	requests map[string]int
+
+	// creds are the accepted credentials, nil if the server doesnt require a login.
+	creds        *engage.Credentials
+	sessions     map[string]struct{}
+	sessionCount int
+	logins       int
+	// forms maps the form session cookies to the event validation issued with the form.
+	forms     map[string]string
+	formCount int
+}
+
+// NewServer starts a new fake engage server seeded with students. The marks of each student
+// must have a full period.
+//
+// The caller should call Close when finished, to shut it down.
+func NewServer(students []*csb.Student) *Server {
+	s := &Server{
+		students: make(map[int]*csb.Student, len(students)),
+		errs:     make(map[string]Error),
+		requests: make(map[string]int),
+		sessions: make(map[string]struct{}),
+		forms:    make(map[string]string),
+	}
+	for _, student := range students {
+		s.students[student.PID] = student
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(servicesPath, s.handle)
+	mux.HandleFunc(LoginPath, s.handleLogin)
+	s.Server = httptest.NewServer(mux)
+	return s
+}
+
+// BaseURL returns the base url of the engage services served by s.
+func (s *Server) BaseURL() string {
+	return s.URL + servicesPath
+}
+
+// EngageClient returns an engage client pointed at s.
+func (s *Server) EngageClient(token string) *engage.Client {
+	c := engage.NewClient(s.Client(), token)
+	c.BaseURL = s.BaseURL()
+	return c
+}
+
+// SessionClient returns an engage client pointed at s which logs in with creds.
+func (s *Server) SessionClient(creds engage.Credentials) *engage.Client {
+	session := engage.NewSession(s.Client(), creds)
+	session.LoginURL = s.URL + LoginPath
+
+	c := engage.NewSessionClient(s.Client(), session)
+	c.BaseURL = s.BaseURL()
+	return c
+}
+
+// RequireLogin makes the server answer requests without a valid session cookie the same way
+// engage answers expired sessions. Sessions are created by posting creds to the login form,
+// along side the state fields it was rendered with.
+func (s *Server) RequireLogin(creds engage.Credentials) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.creds = &creds
+}
+
+// NewSessionCookie creates a valid session and returns its cookie header, as pasted in the
+// engage token config.
+func (s *Server) NewSessionCookie() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return (&http.Cookie{Name: AuthCookie, Value: s.newSession()}).String()
+}
+
+// ExpireSessions expires all the sessions on the server.
+func (s *Server) ExpireSessions() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.sessions = make(map[string]struct{})
+}
+
+// Logins returns the amount of successful logins on the server.
+func (s *Server) Logins() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.logins
+}
+
+// SetStudent adds or replaces a student on the server. Requests for a student with marks or
+// comments without a full period fail with an engage exception.
+func (s *Server) SetStudent(student *csb.Student) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.students[student.PID] = student
+}
+
+// RemoveStudent removes the student with pid = pid from the server, subsequent requests for
+// the student are answered as an invalid PID.
+func (s *Server) RemoveStudent(pid int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.students, pid)
+}
+
+// SetLatency delays every response by d.
+func (s *Server) SetLatency(d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.latency = d
+}
+
+// SetError makes the requests to endpoint fail with err until cleared, or for err.Times
+// requests.
+func (s *Server) SetError(endpoint string, err Error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.errs[endpoint] = err
+}
+
+// Requests returns the amount of requests made to endpoint, failed ones included.
+func (s *Server) Requests(endpoint string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.requests[endpoint]
+}
+
+// ClearError removes any error injected on endpoint.
+func (s *Server) ClearError(endpoint string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.errs, endpoint)
+}
+
+// request mirrors the engage context sent by the engage client.
+type request struct {
+	AcademicYears    string `json:"academicYears"`
+	ReportingPeriods string `json:"reportingPeriods"`
+	SubjectList      string `json:"subjectList"`
+	ColumnList       string `json:"columnList"`
+	PupilIDs         string `json:"pupilIDs"`
+}
+
+// data mirrors an engage data entry.
+type data struct {
+	Type       string     `json:"__type"`
+	Text       string     `json:"Text"`
+	Value      string     `json:"Value"`
+	Enabled    bool       `json:"Enabled"`
+	Attributes attributes `json:"Attributes"`
+}
+
+type attributes struct {
+	Checked     bool   `json:"Checked"`
+	IsReporting bool   `json:"IsReporting"`
+	ColumnType  string `json:"ColumnType"`
+}
+
+func (s *Server) handle(w http.ResponseWriter, r *http.Request) {
+	endpoint := strings.TrimPrefix(r.URL.Path, servicesPath)
+
+	s.mu.Lock()
+	s.requests[endpoint]++
+	latency := s.latency
+	injected, failing := s.errs[endpoint]
+	if failing && injected.Times > 0 {
+		if injected.Times--; injected.Times == 0 {
+			delete(s.errs, endpoint)
+		} else {
+			s.errs[endpoint] = injected
+		}
+	}
+	s.mu.Unlock()
+
+	if latency > 0 {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-time.After(latency):
+		}
+	}
+
+	if failing {
+		writeError(w, injected)
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		writeError(w, Error{
+			Status:        http.StatusMethodNotAllowed,
+			Message:       "Request format is invalid.",
+			ExceptionType: "System.InvalidOperationException",
+		})
+		return
+	}
+
+	var req request
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, Error{
+			Status:        http.StatusInternalServerError,
+			Message:       "Invalid JSON primitive.",
+			ExceptionType: "System.ArgumentException",
+		})
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.authenticated(r) {
+		writeError(w, Error{
+			Status:        http.StatusUnauthorized,
+			Message:       "Authentication failed.",
+			ExceptionType: "System.InvalidOperationException",
+		})
+		return
+	}
+
+	pid, _ := strconv.Atoi(req.PupilIDs)
+	student := s.students[pid]
+	// engage faults on pupils whose reporting data lacks a term, do the same instead of
+	// dereferencing it.
+	if !complete(student) {
+		writeError(w, Error{
+			Status:        http.StatusInternalServerError,
+			Message:       "Object reference not set to an instance of an object.",
+			ExceptionType: "System.NullReferenceException",
+		})
+		return
+	}
+
+	switch endpoint {
+	case AcademicYears:
+		writeData(w, academicYears(student))
+	case ReportingPeriods:
+		writeData(w, reportingPeriods(student, req))
+	case ReportingSubjects:
+		writeData(w, reportingSubjects(student, req))
+	case ColumnsForSubjects:
+		writeData(w, columnsForSubjects(student, req))
+	case MarksheetRender:
+		writeJSON(w, struct {
+			D string `json:"d"`
+		}{renderMarksheet(student, req)})
+	default:
+		writeError(w, Error{
+			Status:        http.StatusInternalServerError,
+			Message:       fmt.Sprintf("Unknown web method %v.", endpoint),
+			ExceptionType: "System.ArgumentException",
+		})
+	}
+}
+
+// handleLogin handles the login form, an asp.net web form. Getting the form issues a form
+// session cookie and the hidden state fields which have to be posted back with it.
+//
+// Posts with valid state and credentials are redirected to the home page with a new session
+// cookie, posts with invalid credentials get the form back without any cookie and posts with
+// invalid state fail the way asp.net does.
+func (s *Server) handleLogin(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if r.Method != http.MethodPost {
+		s.formCount++
+		id := fmt.Sprintf("form-%d", s.formCount)
+		s.forms[id] = fmt.Sprintf("validation-%d", s.formCount)
+
+		http.SetCookie(w, &http.Cookie{Name: FormCookie, Value: id, Path: "/", HttpOnly: true})
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		fmt.Fprintf(w, loginForm, LoginPath, viewState, s.forms[id])
+		return
+	}
+
+	cookie, err := r.Cookie(FormCookie)
+	if err != nil || r.PostFormValue("__VIEWSTATE") != viewState || r.PostFormValue("__EVENTVALIDATION") != s.forms[cookie.Value] ||
+		r.PostFormValue(loginButton) == "" {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprint(w, "<html><body><h2>Validation of viewstate MAC failed.</h2></body></html>")
+		return
+	}
+
+	if s.creds == nil || r.PostFormValue(usernameField) != s.creds.Username || r.PostFormValue(passwordField) != s.creds.Password {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		fmt.Fprintf(w, loginForm, LoginPath, viewState, s.forms[cookie.Value])
+		return
+	}
+
+	s.logins++
+	http.SetCookie(w, &http.Cookie{Name: AuthCookie, Value: s.newSession(), Path: "/", HttpOnly: true})
+	http.Redirect(w, r, "/", http.StatusFound)
+}
+
+// authenticated reports wether r is allowed through, s.mu must be held.
+func (s *Server) authenticated(r *http.Request) bool {
+	if s.creds == nil {
+		return true
+	}
+
+	cookie, err := r.Cookie(AuthCookie)
+	if err != nil {
+		return false
+	}
+	_, ok := s.sessions[cookie.Value]
+	return ok
+}
+
+// newSession creates a new session and returns its id, s.mu must be held.
+func (s *Server) newSession() string {
+	s.sessionCount++
+	id := fmt.Sprintf("session-%d", s.sessionCount)
+	s.sessions[id] = struct{}{}
+	return id
+}
+
+func academicYears(student *csb.Student) []data {
+	out := make([]data, 0)
+	for _, year := range distinctYears(marksOf(student, request{})) {
+		out = append(out, data{
+			Type:  "ListItem",
+			Text:  AcademicYearLabel(year),
+			Value: strconv.Itoa(year),
+		})
+	}
+	return out
+}
+
+func reportingPeriods(student *csb.Student, req request) []data {
+	out := make([]data, 0)
+	seen := make(map[string]struct{})
+	for _, mark := range marksOf(student, request{AcademicYears: req.AcademicYears}) {
+		label := PeriodLabel(mark.Period)
+		if _, ok := seen[label]; ok {
+			continue
+		}
+		seen[label] = struct{}{}
+
+		out = append(out, data{
+			Type:       "ListItem",
+			Text:       label,
+			Value:      label,
+			Attributes: attributes{IsReporting: true},
+		})
+	}
+	return out
+}
+
+func reportingSubjects(student *csb.Student, req request) []data {
+	out := make([]data, 0)
+	seen := make(map[csb.Subject]struct{})
+	for _, mark := range marksOf(student, request{AcademicYears: req.AcademicYears, ReportingPeriods: req.ReportingPeriods}) {
+		if _, ok := seen[mark.Subject]; ok {
+			continue
+		}
+		seen[mark.Subject] = struct{}{}
+
+		out = append(out, data{
+			Type:  "ListItem",
+			Text:  mark.Subject.String(),
+			Value: string(mark.Subject),
+		})
+	}
+	return out
+}
+
+func columnsForSubjects(student *csb.Student, req request) []data {
+	out := make([]data, 0)
+	for _, column := range markColumnsOf(student, req) {
+		out = append(out, columnData(column))
+	}
+	if len(commentsOf(student, req)) > 0 {
+		out = append(out, columnData(csb.Column{
+			ID:   commentColumn,
+			Name: "Teacher Comment",
+			Type: csb.COLUMN_COMMENT,
+		}))
+	}
+	return out
+}
+
+func columnData(column csb.Column) data {
+	return data{
+		Type:       "ListItem",
+		Text:       column.Name,
+		Value:      column.ID,
+		Enabled:    true,
+		Attributes: attributes{Checked: true, ColumnType: strings.ToUpper(column.Type[:1]) + column.Type[1:]},
+	}
+}
+
+// columnOf returns the marksheet column of mark, marks without a column are rendered in the
+// "Mark %" column.
+func columnOf(mark *csb.Mark) csb.Column {
+	if mark.Column.ID == "" {
+		return csb.Column{ID: markColumn, Name: "Mark %", Type: csb.COLUMN_PERCENTAGE}
+	}
+	return mark.Column
+}
+
+// markColumnsOf returns the distinct columns of the marks of student matching req, in the
+// order they are first seen.
+func markColumnsOf(student *csb.Student, req request) []csb.Column {
+	seen := make(map[string]struct{})
+	out := make([]csb.Column, 0)
+	for _, mark := range marksOf(student, req) {
+		column := columnOf(mark)
+		if _, ok := seen[column.ID]; ok {
+			continue
+		}
+		seen[column.ID] = struct{}{}
+		out = append(out, column)
+	}
+	return out
+}
+
+// renderMarksheet renders the marks and comments of student matching req as an engage
+// marksheet, with the columns of req. An empty column list renders the mark columns.
+func renderMarksheet(student *csb.Student, req request) string {
+	if student == nil {
+		return ""
+	}
+	requested := split(req.ColumnList)
+	withComments := requested != nil && matches(requested, commentColumn)
+
+	var columns []csb.Column
+	for _, column := range markColumnsOf(student, req) {
+		if matches(requested, column.ID) {
+			columns = append(columns, column)
+		}
+	}
+
+	// a row per subject and period holding marks, a comment or both.
+	type row struct {
+		marks   map[string]*csb.Mark
+		comment *csb.Comment
+
+		subject csb.Subject
+		teacher string
+		period  csb.Period
+	}
+	var rows []*row
+	index := make(map[string]*row)
+	if len(columns) > 0 {
+		for _, mark := range marksOf(student, req) {
+			id := columnOf(mark).ID
+			if !matches(requested, id) {
+				continue
+			}
+
+			r, ok := index[rowKey(mark.Subject, mark.Period)]
+			if !ok {
+				r = &row{marks: make(map[string]*csb.Mark), subject: mark.Subject, teacher: mark.Teacher, period: mark.Period}
+				rows, index[rowKey(mark.Subject, mark.Period)] = append(rows, r), r
+			}
+			r.marks[id] = mark
+		}
+	}
+	if withComments {
+		for _, comment := range commentsOf(student, req) {
+			if r, ok := index[rowKey(comment.Subject, comment.Period)]; ok {
+				r.comment = comment
+				continue
+			}
+			rows = append(rows, &row{comment: comment, subject: comment.Subject, teacher: comment.Teacher, period: comment.Period})
+		}
+	}
+
+	var b strings.Builder
+	b.WriteString(`<div class="marksheet"><table class="table">`)
+	b.WriteString(`<thead><tr><th>Academic Year</th><th>Reporting Period</th><th>Subject</th><th>Teacher</th>`)
+	for _, column := range columns {
+		fmt.Fprintf(&b, `<th>%v</th>`, html.EscapeString(column.Name))
+	}
+	if withComments {
+		b.WriteString(`<th>Teacher Comment</th>`)
+	}
+	b.WriteString(`</tr></thead><tbody>`)
+	for _, r := range rows {
+		fmt.Fprintf(&b, `<tr><td>%v</td><td>%v</td><td>%v</td><td>%v</td>`,
+			html.EscapeString(AcademicYearLabel(r.period.AcademicYear)),
+			html.EscapeString(PeriodLabel(r.period)),
+			html.EscapeString(r.subject.String()),
+			html.EscapeString(r.teacher),
+		)
+		for _, column := range columns {
+			switch mark, ok := r.marks[column.ID]; {
+			case !ok:
+				b.WriteString(`<td></td>`)
+			case mark.Numeric():
+				fmt.Fprintf(&b, `<td>%v%%</td>`, mark.Percentage)
+			default:
+				fmt.Fprintf(&b, `<td>%v</td>`, html.EscapeString(mark.Value))
+			}
+		}
+		if withComments {
+			if r.comment != nil {
+				fmt.Fprintf(&b, `<td>%v</td>`, html.EscapeString(r.comment.Text))
+			} else {
+				b.WriteString(`<td></td>`)
+			}
+		}
+		b.WriteString(`</tr>`)
+	}
+	b.WriteString(`</tbody></table></div>`)
+	return b.String()
+}
+
+// complete reports wether the marks and comments of student all have a full period, a nil
+// student is complete.
+func complete(student *csb.Student) bool {
+	if student == nil {
+		return true
+	}
+
+	for _, mark := range student.Marks {
+		if mark.Period.Term == nil || mark.Period.Importance == nil {
+			return false
+		}
+	}
+	for _, comment := range student.Comments {
+		if comment.Period.Term == nil || comment.Period.Importance == nil {
+			return false
+		}
+	}
+	return true
+}
+
+func rowKey(subject csb.Subject, period csb.Period) string {
+	return fmt.Sprintf("%v/%v", subject, period)
+}
+
+// commentsOf returns the comments of student matching the populated filters of req.
+func commentsOf(student *csb.Student, req request) []*csb.Comment {
+	if student == nil {
+		return nil
+	}
+
+	years := split(req.AcademicYears)
+	periods := split(req.ReportingPeriods)
+	subjects := split(req.SubjectList)
+
+	out := make([]*csb.Comment, 0, len(student.Comments))
+	for _, comment := range student.Comments {
+		if !matches(years, strconv.Itoa(comment.Period.AcademicYear)) ||
+			!matches(periods, PeriodLabel(comment.Period)) ||
+			!matches(subjects, string(comment.Subject)) {
+			continue
+		}
+		out = append(out, comment)
+	}
+	return out
+}
+
+// marksOf returns the marks of student matching the populated filters of req ordered by
+// period and subject, the marks of student must be complete.
+func marksOf(student *csb.Student, req request) []*csb.Mark {
+	if student == nil {
+		return nil
+	}
+
+	years := split(req.AcademicYears)
+	periods := split(req.ReportingPeriods)
+	subjects := split(req.SubjectList)
+
+	out := make([]*csb.Mark, 0, len(student.Marks))
+	for _, mark := range student.Marks {
+		if !matches(years, strconv.Itoa(mark.Period.AcademicYear)) ||
+			!matches(periods, PeriodLabel(mark.Period)) ||
+			!matches(subjects, string(mark.Subject)) {
+			continue
+		}
+		out = append(out, mark)
+	}
+
+	sort.SliceStable(out, func(i, j int) bool {
+		a, b := out[i].Period, out[j].Period
+		if a.AcademicYear != b.AcademicYear {
+			return a.AcademicYear < b.AcademicYear
+		}
+		if *a.Term != *b.Term {
+			return *a.Term < *b.Term
+		}
+		return out[i].Subject < out[j].Subject
+	})
+	return out
+}
+
+func distinctYears(marks []*csb.Mark) []int {
+	seen := make(map[int]struct{})
+	out := make([]int, 0)
+	for _, mark := range marks {
+		if _, ok := seen[mark.Period.AcademicYear]; ok {
+			continue
+		}
+		seen[mark.Period.AcademicYear] = struct{}{}
+		out = append(out, mark.Period.AcademicYear)
+	}
+	return out
+}
+
+// split splits a comma separated engage parameter, an empty parameter results in a nil slice.
+func split(param string) map[string]struct{} {
+	if param == "" {
+		return nil
+	}
+
+	out := make(map[string]struct{})
+	for _, v := range strings.Split(param, ",") {
+		out[strings.TrimSpace(v)] = struct{}{}
+	}
+	return out
+}
+
+// matches reports wether v is in set, an empty set matches everything.
+func matches(set map[string]struct{}, v string) bool {
+	if set == nil {
+		return true
+	}
+	_, ok := set[v]
+	return ok
+}
+
+// AcademicYearLabel returns the label engage displays for an academic year: 2022 -> "2022/2023".
+func AcademicYearLabel(year int) string {
+	return fmt.Sprintf("%d/%d", year, year+1)
+}
+
+// PeriodLabel returns the label engage displays for a full period's reporting period:
+// "Term 2 - Mock".
+func PeriodLabel(period csb.Period) string {
+	return fmt.Sprintf("Term %d - %v", *period.Term, *period.Importance)
+}
+
+func writeData(w http.ResponseWriter, d []data) {
+	writeJSON(w, struct {
+		D []data `json:"d"`
+	}{d})
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, err Error) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("jsonerror", "true")
+	w.WriteHeader(err.Status)
+	json.NewEncoder(w).Encode(struct {
+		Message       string `json:"Message"`
+		StackTrace    string `json:"StackTrace"`
+		ExceptionType string `json:"ExceptionType"`
+	}{err.Message, "", err.ExceptionType})
+}
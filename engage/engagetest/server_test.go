@@ -0,0 +1,135 @@
+package engagetest_test
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"reflect"
+	"testing"
+
+	csb "github.com/Lambels/CSB-Open-API"
+	"github.com/Lambels/CSB-Open-API/engage"
+	"github.com/Lambels/CSB-Open-API/engage/engagetest"
+)
+
+// newClient returns a client of s without rate limiting and retries.
+func newClient(s *engagetest.Server) *engage.Client {
+	c := s.EngageClient("")
+	c.Limiter = nil
+	c.Retry = engage.RetryPolicy{}
+	return c
+}
+
+func TestServer_AcademicYears(t *testing.T) {
+	s := engagetest.NewServer(engagetest.Fixture())
+	defer s.Close()
+	c := newClient(s)
+
+	years, err := c.GetAcademicYears(context.Background(), 1001)
+	if err != nil {
+		t.Fatal(err)
+	} else if want := []int{2021, 2022}; !reflect.DeepEqual(years, want) {
+		t.Fatalf("expected %v, got: %v", want, years)
+	}
+
+	if _, err := c.GetAcademicYears(context.Background(), 9999); csb.ErrorCode(err) != csb.ENOTFOUND {
+		t.Fatalf("expected ENOTFOUND for an unknown pid, got: %v", err)
+	}
+}
+
+func TestServer_MissingTerm(t *testing.T) {
+	s := engagetest.NewServer(engagetest.Fixture())
+	defer s.Close()
+	c := newClient(s)
+
+	importance := "Mock"
+	s.SetStudent(&csb.Student{
+		PID:  2001,
+		Name: "Incomplete",
+		Marks: []*csb.Mark{
+			{Subject: csb.MATHEMATICS, Teacher: "Mr Ionescu", Percentage: 50, Period: csb.Period{AcademicYear: 2022, Importance: &importance}},
+		},
+	})
+
+	if _, err := c.GetAcademicYears(context.Background(), 2001); csb.ErrorCode(err) != csb.EINTERNAL {
+		t.Fatalf("expected EINTERNAL, got: %v", err)
+	}
+
+}
+
+func TestServer_SetError(t *testing.T) {
+	s := engagetest.NewServer(engagetest.Fixture())
+	defer s.Close()
+	c := newClient(s)
+
+	s.SetError(engagetest.AcademicYears, engagetest.Error{
+		Status:        http.StatusInternalServerError,
+		Message:       "Value cannot be null.",
+		ExceptionType: "System.ArgumentNullException",
+	})
+	if _, err := c.GetAcademicYears(context.Background(), 1001); csb.ErrorCode(err) != csb.EINVALID {
+		t.Fatalf("expected EINVALID, got: %v", err)
+	}
+
+	s.ClearError(engagetest.AcademicYears)
+	if _, err := c.GetAcademicYears(context.Background(), 1001); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestServer_RequireLogin(t *testing.T) {
+	s := engagetest.NewServer(engagetest.Fixture())
+	defer s.Close()
+
+	creds := engage.Credentials{Username: "teacher", Password: "secret"}
+	s.RequireLogin(creds)
+
+	if _, err := newClient(s).GetAcademicYears(context.Background(), 1001); csb.ErrorCode(err) != csb.EUNAUTHORIZED {
+		t.Fatalf("expected EUNAUTHORIZED without a session, got: %v", err)
+	}
+
+	c := s.SessionClient(creds)
+	c.Limiter = nil
+	if _, err := c.GetAcademicYears(context.Background(), 1001); err != nil {
+		t.Fatal(err)
+	}
+
+	// the expired session is renewed once.
+	s.ExpireSessions()
+	if _, err := c.GetAcademicYears(context.Background(), 1001); err != nil {
+		t.Fatal(err)
+	} else if n := s.Logins(); n != 2 {
+		t.Fatalf("expected 2 logins, got: %v", n)
+	}
+
+	wrong := s.SessionClient(engage.Credentials{Username: "teacher", Password: "wrong"})
+	wrong.Limiter = nil
+	if _, err := wrong.GetAcademicYears(context.Background(), 1001); csb.ErrorCode(err) != csb.EUNAUTHORIZED {
+		t.Fatalf("expected EUNAUTHORIZED for wrong credentials, got: %v", err)
+	}
+}
+
+func TestServer_LoginState(t *testing.T) {
+	s := engagetest.NewServer(engagetest.Fixture())
+	defer s.Close()
+
+	creds := engage.Credentials{Username: "teacher", Password: "secret"}
+	s.RequireLogin(creds)
+
+	// credentials posted without the state of the rendered form are rejected.
+	resp, err := s.Client().PostForm(s.URL+engagetest.LoginPath, url.Values{
+		"ctl00$PageContent$txtUsername": {creds.Username},
+		"ctl00$PageContent$txtPassword": {creds.Password},
+		"ctl00$PageContent$btnLogin":    {"Log In"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusInternalServerError {
+		t.Fatalf("expected status 500, got: %v", resp.StatusCode)
+	} else if n := s.Logins(); n != 0 {
+		t.Fatalf("expected no logins, got: %v", n)
+	}
+}
@@ -0,0 +1,174 @@
+package engage
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultRate is the default amount of requests per second sent to engage.
+	DefaultRate float64 = 1
+	// DefaultBurst is the default amount of requests which can be sent to engage at once.
+	DefaultBurst int = 3
+)
+
+// Limiter is a token bucket rate limiter, it is safe for concurrent use and meant to be
+// shared by everything talking to engage so that the school portal isnt spammed.
+//
+// The bucket holds at most burst tokens and is refilled at rate tokens per second, each
+// request consumes one token.
+type Limiter struct {
+	rate  float64
+	burst int
+
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time // last time tokens were refilled.
+	// lastEvent is the time the latest reservation is allowed through.
+	lastEvent time.Time
+	stats     LimiterStats
+}
+
+// LimiterStats holds how long callers of a limiter waited.
+type LimiterStats struct {
+	// Requests is the amount of requests which went through the limiter.
+	Requests int64 `json:"requests"`
+	// Delayed is the amount of requests which had to wait for a token.
+	Delayed int64 `json:"delayed"`
+	// Waited is the total time callers waited.
+	Waited time.Duration `json:"waited"`
+	// MaxWait is the longest time a caller waited.
+	MaxWait time.Duration `json:"max_wait"`
+}
+
+// NewLimiter creates a new limiter allowing rate requests per second with bursts of up to
+// burst requests. The bucket starts full.
+//
+// A rate <= 0 disables the limiter and a burst < 1 is treated as 1.
+func NewLimiter(rate float64, burst int) *Limiter {
+	if burst < 1 {
+		burst = 1
+	}
+
+	return &Limiter{
+		rate:   rate,
+		burst:  burst,
+		tokens: float64(burst),
+		last:   time.Now(),
+	}
+}
+
+// Wait blocks until a request is allowed to go through or ctx is done, the time waited is
+// recorded in the limiter stats.
+//
+// If ctx is done before the request is allowed, the reservation is cancelled and the context
+// error is returned. Callers already waiting keep their delay, so only the part of the token
+// which wasnt promised to them is given back, the same as x/time/rate.
+func (l *Limiter) Wait(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	delay, act := l.reserve()
+	if delay == 0 {
+		return nil
+	}
+
+	t := time.NewTimer(delay)
+	defer t.Stop()
+
+	select {
+	case <-ctx.Done():
+		l.cancel(act)
+		return ctx.Err()
+	case <-t.C:
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.stats.Waited += delay
+	if delay > l.stats.MaxWait {
+		l.stats.MaxWait = delay
+	}
+	return nil
+}
+
+// Stats returns a snapshot of the limiter stats.
+func (l *Limiter) Stats() LimiterStats {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.stats
+}
+
+// reserve takes a token from the bucket and returns how long the caller has to wait before
+// the token is available and the time it is available at.
+func (l *Limiter) reserve() (time.Duration, time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	l.stats.Requests++
+	if l.rate <= 0 {
+		return 0, now
+	}
+
+	l.advance(now)
+	l.tokens--
+	if l.tokens >= 0 {
+		return 0, now
+	}
+
+	l.stats.Delayed++
+	delay := time.Duration(-l.tokens / l.rate * float64(time.Second))
+	act := now.Add(delay)
+	if act.After(l.lastEvent) {
+		l.lastEvent = act
+	}
+	return delay, act
+}
+
+// advance refills the bucket up to now, l.mu must be held.
+func (l *Limiter) advance(now time.Time) {
+	l.tokens += now.Sub(l.last).Seconds() * l.rate
+	if l.tokens > float64(l.burst) {
+		l.tokens = float64(l.burst)
+	}
+	l.last = now
+}
+
+// cancel cancels the reservation of a caller which gave up waiting for the token available at
+// act. The tokens reserved after it stay reserved, they were already promised to the callers
+// waiting for them.
+func (l *Limiter) cancel(act time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.stats.Requests--
+	l.stats.Delayed--
+
+	now := time.Now()
+	if !act.After(now) {
+		return
+	}
+
+	restore := 1 - l.lastEvent.Sub(act).Seconds()*l.rate
+	if restore <= 0 {
+		return
+	}
+
+	l.advance(now)
+	l.tokens += restore
+	if l.tokens > float64(l.burst) {
+		l.tokens = float64(l.burst)
+	}
+
+	// the cancelled reservation was the latest, the one before it is the latest now.
+	if act.Equal(l.lastEvent) {
+		if prev := act.Add(-time.Duration(float64(time.Second) / l.rate)); !prev.Before(now) {
+			l.lastEvent = prev
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package engage
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	csb "github.com/Lambels/CSB-Open-API"
+)
+
+func TestLimiter_Cancel(t *testing.T) {
+	// a token every 100ms, the first one is available straight away.
+	l := NewLimiter(10, 1)
+	if err := l.Wait(context.Background()); err != nil {
+		t.Fatal(err)
+	} else if stats := l.Stats(); stats.Delayed != 0 {
+		t.Fatalf("expected the first token straight away, got: %+v", stats)
+	}
+
+	// wait reserves the next token in the background and sends the time it went through.
+	wait := func(ctx context.Context) <-chan time.Time {
+		ch := make(chan time.Time, 1)
+		go func() {
+			if err := l.Wait(ctx); err != nil {
+				close(ch)
+				return
+			}
+			ch <- time.Now()
+		}()
+		time.Sleep(10 * time.Millisecond)
+		return ch
+	}
+
+	a := wait(context.Background()) // token at 100ms.
+	ctx, cancel := context.WithCancel(context.Background())
+	b := wait(ctx)                  // token at 200ms, given up.
+	c := wait(context.Background()) // token at 300ms.
+
+	cancel()
+	if _, ok := <-b; ok {
+		t.Fatal("expected the cancelled caller to give up")
+	}
+
+	// the token given up was promised to c already, d waits for the token after it instead
+	// of going through along side c.
+	d := wait(context.Background())
+
+	ta, tc, td := <-a, <-c, <-d
+	if gap := tc.Sub(ta); gap < 50*time.Millisecond {
+		t.Fatalf("expected c to keep its delay, got through %v after a", gap)
+	}
+	if gap := td.Sub(tc); gap < 50*time.Millisecond {
+		t.Fatalf("expected d to wait for its own token, got through %v after c", gap)
+	}
+
+	stats := l.Stats()
+	if stats.Requests != 4 || stats.Delayed != 3 {
+		t.Fatalf("expected 4 requests with 3 delayed, got: %+v", stats)
+	}
+	if stats.Waited <= 0 || stats.MaxWait < 50*time.Millisecond {
+		t.Fatalf("expected the waits to be recorded, got: %+v", stats)
+	}
+}
+
+func TestNewClientFromConfig(t *testing.T) {
+	var conf csb.Config
+	conf.Engage.Token = "token"
+	conf.Engage.BaseURL = "http://localhost/"
+	conf.Engage.RequestsPerSecond = 5
+	conf.Engage.Burst = 10
+
+	c := NewClientFromConfig(http.DefaultClient, conf)
+	if c.BaseURL != conf.Engage.BaseURL || c.session != nil || c.token != "token" {
+		t.Fatalf("unexpected client: %+v", c)
+	}
+	if c.Limiter.rate != 5 || c.Limiter.burst != 10 {
+		t.Fatalf("expected limiter of 5/s with bursts of 10, got: %v/s with bursts of %v", c.Limiter.rate, c.Limiter.burst)
+	}
+
+	conf.Engage.Username, conf.Engage.LoginURL = "teacher", "http://localhost/Login.aspx"
+	conf.Engage.RequestsPerSecond, conf.Engage.Burst = 0, 0
+	c = NewClientFromConfig(http.DefaultClient, conf)
+	if c.session == nil || c.session.LoginURL != conf.Engage.LoginURL {
+		t.Fatalf("expected session logging in at %v", conf.Engage.LoginURL)
+	}
+	if c.Limiter.rate != DefaultRate || c.Limiter.burst != DefaultBurst {
+		t.Fatalf("expected default limiter, got: %v/s with bursts of %v", c.Limiter.rate, c.Limiter.burst)
+	}
+}
@@ -0,0 +1,406 @@
+package engage
+
+import (
+	"encoding/xml"
+	"errors"
+	"io"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+
+	csb "github.com/Lambels/CSB-Open-API"
+)
+
+// column identifies the meaning of a marksheet column.
+type column int
+
+const (
+	columnUnknown column = iota
+	columnAcademicYear
+	columnPeriod
+	columnSubject
+	columnTeacher
+	columnValue
+	columnComment
+)
+
+// headerColumn represents a column identified in a marksheet header.
+type headerColumn struct {
+	kind column
+	// info describes the marksheet column of columnValue and columnComment columns.
+	info csb.Column
+}
+
+// markCell holds a filled cell of a mark column.
+type markCell struct {
+	column csb.Column
+	value  string
+}
+
+var percentageRe = regexp.MustCompile(`^-?\d+(?:[.,]\d+)?`)
+
+// marksheetRow represents a row of a rendered marksheet table.
+type marksheetRow struct {
+	header bool
+	cells  []string
+}
+
+// marksheet holds the marks and report comments parsed from a rendered marksheet.
+type marksheet struct {
+	marks    []*csb.Mark
+	comments []*csb.Comment
+}
+
+// parseMarksheet parses a rendered marksheet into marks and report comments belonging to the
+// student with pid = pid. A mark is parsed for each filled mark column of a row.
+//
+// The parser is tolerant to changes in the markup: it only relies on the header cells of the
+// marksheet tables to identify the columns, header cells named like one of columns take its
+// id and type and unknown columns are ignored. Rows which dont hold a mark or a comment
+// are skipped, as are cells of numeric columns which dont hold a percentage. Subjects missing
+// from the subject catalog are returned as the name engage displays, see csb.Subject.Known.
+//
+// returns EINTERNAL if the markup holds no recognisable marksheet.
+func parseMarksheet(pid int, r io.Reader, known []csb.Column) (*marksheet, error) {
+	rows, err := parseRows(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		columns []headerColumn
+		found   bool
+	)
+	sheet := &marksheet{
+		marks:    make([]*csb.Mark, 0),
+		comments: make([]*csb.Comment, 0),
+	}
+	for _, row := range rows {
+		// engage sometimes renders the subject of a data row as a header cell, only treat
+		// rows which describe a marksheet as headers.
+		if row.header {
+			if cols, ok := parseHeader(row.cells, known); ok {
+				columns, found = cols, true
+				continue
+			}
+		}
+		if !found {
+			continue
+		}
+
+		var (
+			yearText, periodText, subjectText, teacher string
+			values                                     []markCell
+			comments                                   []string
+		)
+		for i, col := range columns {
+			var cell string
+			if i < len(row.cells) {
+				cell = row.cells[i]
+			}
+
+			switch col.kind {
+			case columnAcademicYear:
+				yearText = cell
+			case columnPeriod:
+				periodText = cell
+			case columnSubject:
+				subjectText = cell
+			case columnTeacher:
+				teacher = cell
+			case columnValue:
+				if cell != "" {
+					values = append(values, markCell{column: col.info, value: cell})
+				}
+			case columnComment:
+				if cell != "" {
+					comments = append(comments, cell)
+				}
+			}
+		}
+
+		if len(values) == 0 && len(comments) == 0 {
+			continue
+		}
+
+		if subjectText == "" {
+			continue
+		}
+		// keep the marks and comments of subjects missing from the catalog under the name
+		// engage displays, the caller decides what to do with them.
+		subject, ok := csb.ParseSubject(subjectText)
+		if !ok {
+			subject = csb.Subject(subjectText)
+		}
+
+		period, err := parsePeriod(yearText, periodText)
+		if err != nil {
+			continue
+		}
+
+		for _, v := range values {
+			mark := &csb.Mark{
+				StudentID: pid,
+				Subject:   subject,
+				Teacher:   teacher,
+				Column:    v.column,
+				Value:     v.value,
+				Period:    period,
+				Source:    csb.SOURCE_ENGAGE,
+			}
+			if mark.Numeric() {
+				percentage, ok := parsePercentage(v.value)
+				if !ok {
+					continue
+				}
+				mark.Percentage = percentage
+			}
+			sheet.marks = append(sheet.marks, mark)
+		}
+		if len(comments) > 0 {
+			sheet.comments = append(sheet.comments, &csb.Comment{
+				StudentID: pid,
+				Subject:   subject,
+				Teacher:   teacher,
+				Period:    period,
+				Text:      strings.Join(comments, "\n"),
+			})
+		}
+	}
+
+	if !found {
+		return nil, csb.Errorf(csb.EINTERNAL, "engage: unrecognised marksheet markup")
+	}
+	return sheet, nil
+}
+
+// parseRows extracts the table rows from the markup in r, the text of each cell is trimmed
+// and whitespace is collapsed.
+//
+// A cell spanning several rows (engage uses row spans for subjects and teachers) is left out
+// of the markup of the rows below, it is repeated in those rows at its column.
+func parseRows(r io.Reader) ([]marksheetRow, error) {
+	d := xml.NewDecoder(r)
+	d.Strict = false
+	d.AutoClose = xml.HTMLAutoClose
+	d.Entity = xml.HTMLEntity
+
+	var (
+		rows  []marksheetRow
+		row   *marksheetRow
+		cell  *strings.Builder
+		depth int // depth of the current cell, used to collect text from nested elements.
+		// span is the row span of the current cell.
+		span int
+		// spans holds the cells spanning into the following rows, by column.
+		spans []rowSpan
+	)
+	for {
+		tkn, err := d.Token()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, csb.Errorf(csb.EINTERNAL, "engage: parse marksheet: %v", err)
+		}
+
+		switch t := tkn.(type) {
+		case xml.StartElement:
+			if cell != nil {
+				if strings.ToLower(t.Name.Local) == "br" {
+					cell.WriteByte(' ')
+				}
+				depth++
+				break
+			}
+
+			switch strings.ToLower(t.Name.Local) {
+			case "table":
+				spans = nil
+			case "tr":
+				row = &marksheetRow{header: true}
+			case "th", "td":
+				if row == nil {
+					break
+				}
+				if strings.ToLower(t.Name.Local) == "td" {
+					row.header = false
+				}
+				cell, span = &strings.Builder{}, parseRowSpan(t.Attr)
+			}
+		case xml.EndElement:
+			if cell != nil && depth > 0 {
+				depth--
+				break
+			}
+
+			switch strings.ToLower(t.Name.Local) {
+			case "th", "td":
+				if cell != nil && row != nil {
+					fillSpans(row, spans, false)
+
+					text := strings.Join(strings.Fields(cell.String()), " ")
+					if span > 1 {
+						for len(spans) <= len(row.cells) {
+							spans = append(spans, rowSpan{})
+						}
+						spans[len(row.cells)] = rowSpan{text: text, left: span - 1}
+					}
+					row.cells = append(row.cells, text)
+				}
+				cell = nil
+			case "tr":
+				if row != nil {
+					fillSpans(row, spans, true)
+					if len(row.cells) > 0 {
+						rows = append(rows, *row)
+					}
+				}
+				row = nil
+			}
+		case xml.CharData:
+			if cell != nil {
+				cell.Write(t)
+			}
+		}
+	}
+
+	return rows, nil
+}
+
+// rowSpan represents a cell spanning into the following rows.
+type rowSpan struct {
+	text string
+	// left is the amount of following rows the cell still spans into.
+	left int
+}
+
+// parseRowSpan returns the row span of a cell from its attributes, 1 if it doesent span.
+func parseRowSpan(attrs []xml.Attr) int {
+	for _, attr := range attrs {
+		if !strings.EqualFold(attr.Name.Local, "rowspan") {
+			continue
+		}
+		if n, err := strconv.Atoi(strings.TrimSpace(attr.Value)); err == nil && n > 1 {
+			return n
+		}
+	}
+	return 1
+}
+
+// fillSpans repeats the cells spanning into row at the next columns of row. At the end of the
+// row the cells spanning into the columns after the last cell of row are repeated too.
+func fillSpans(row *marksheetRow, spans []rowSpan, end bool) {
+	last := len(spans)
+	if end {
+		// the columns before a spanning cell are left empty.
+		for last > 0 && spans[last-1].left == 0 {
+			last--
+		}
+	}
+
+	for i := len(row.cells); i < len(spans); i = len(row.cells) {
+		switch {
+		case spans[i].left > 0:
+			row.cells = append(row.cells, spans[i].text)
+			spans[i].left--
+		case end && i < last:
+			row.cells = append(row.cells, "")
+		default:
+			return
+		}
+	}
+}
+
+// parseHeader identifies the columns of a header row, it reports wether the header describes
+// a marksheet: a subject column and a mark or comment column.
+func parseHeader(cells []string, known []csb.Column) ([]headerColumn, bool) {
+	columns := make([]headerColumn, len(cells))
+	var subject, value, comment bool
+	for i, cell := range cells {
+		if info, ok := findColumn(known, cell); ok {
+			if info.Type == csb.COLUMN_COMMENT {
+				columns[i], comment = headerColumn{kind: columnComment, info: info}, true
+			} else {
+				columns[i], value = headerColumn{kind: columnValue, info: info}, true
+			}
+			continue
+		}
+
+		text := strings.ToLower(cell)
+		switch {
+		// before the teacher column since engage titles comments "Teacher Comment".
+		case strings.Contains(text, "comment") || strings.Contains(text, "remark"):
+			columns[i] = headerColumn{kind: columnComment, info: csb.Column{Name: cell, Type: csb.COLUMN_COMMENT}}
+			comment = true
+		case strings.Contains(text, "academic year") || text == "year":
+			columns[i].kind = columnAcademicYear
+		case strings.Contains(text, "period") || text == "term":
+			columns[i].kind = columnPeriod
+		case strings.Contains(text, "subject"):
+			columns[i].kind = columnSubject
+			subject = true
+		case strings.Contains(text, "teacher") || strings.Contains(text, "staff"):
+			columns[i].kind = columnTeacher
+		case strings.Contains(text, "%") ||
+			strings.Contains(text, "percentage") ||
+			strings.Contains(text, "mark") ||
+			strings.Contains(text, "score") ||
+			strings.Contains(text, "result") ||
+			strings.Contains(text, "exam") ||
+			strings.Contains(text, "coursework") ||
+			strings.Contains(text, "grade") ||
+			strings.Contains(text, "effort"):
+			columns[i] = headerColumn{kind: columnValue, info: csb.Column{Name: cell, Type: columnType("", cell)}}
+			value = true
+		}
+	}
+
+	return columns, subject && (value || comment)
+}
+
+// findColumn finds the column displayed as name.
+func findColumn(columns []csb.Column, name string) (csb.Column, bool) {
+	for _, column := range columns {
+		if strings.EqualFold(strings.TrimSpace(column.Name), name) {
+			return column, true
+		}
+	}
+	return csb.Column{}, false
+}
+
+// columnType maps the type and name engage displays for a column to a csb column type,
+// columns without a recognisable type hold percentages.
+func columnType(typ, name string) string {
+	text := strings.ToLower(typ + " " + name)
+	switch {
+	case strings.Contains(text, "comment") || strings.Contains(text, "remark"):
+		return csb.COLUMN_COMMENT
+	case strings.Contains(text, "effort"):
+		return csb.COLUMN_EFFORT
+	case strings.Contains(text, "predict"):
+		return csb.COLUMN_PREDICTED
+	case strings.Contains(text, "grade") || strings.Contains(text, "attainment"):
+		return csb.COLUMN_GRADE
+	case strings.Contains(text, "coursework"):
+		return csb.COLUMN_COURSEWORK
+	case strings.Contains(text, "exam") || strings.Contains(text, "mock"):
+		return csb.COLUMN_EXAM
+	}
+	return csb.COLUMN_PERCENTAGE
+}
+
+// parsePercentage parses the numeric value of cell rounded to the closest integer.
+func parsePercentage(cell string) (int, bool) {
+	v := percentageRe.FindString(strings.TrimSpace(strings.TrimSuffix(cell, "%")))
+	if v == "" {
+		return 0, false
+	}
+
+	f, err := strconv.ParseFloat(strings.Replace(v, ",", ".", 1), 64)
+	if err != nil || f < 0 || f > 100 {
+		return 0, false
+	}
+	return int(math.Round(f)), true
+}
@@ -0,0 +1,184 @@
+package engage
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	csb "github.com/Lambels/CSB-Open-API"
+)
+
+var update = flag.Bool("update", false, "update the golden files")
+
+func TestParseMarksheet(t *testing.T) {
+	tests := []struct {
+		name  string
+		known []csb.Column
+		// code is the expected error code, the golden file is only checked without one.
+		code string
+	}{
+		{
+			name: "fake_server",
+			known: []csb.Column{
+				{ID: "1", Name: "Mark %", Type: csb.COLUMN_PERCENTAGE},
+				{ID: "2", Name: "Teacher Comment", Type: csb.COLUMN_COMMENT},
+			},
+		},
+		{
+			name: "rowspans",
+			known: []csb.Column{
+				{ID: "7", Name: "Exam %", Type: csb.COLUMN_EXAM},
+				{ID: "8", Name: "Effort", Type: csb.COLUMN_EFFORT},
+			},
+		},
+		{name: "unknown_subject"},
+		{name: "no_marksheet", code: csb.EINTERNAL},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var res renderResponse
+			if err := json.Unmarshal(readFile(t, tt.name+".json"), &res); err != nil {
+				t.Fatal(err)
+			}
+
+			sheet, err := parseMarksheet(1001, strings.NewReader(res.D), tt.known)
+			if tt.code != "" {
+				if code := csb.ErrorCode(err); code != tt.code {
+					t.Fatalf("expected error code %v, got: %v", tt.code, err)
+				}
+				return
+			} else if err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := json.MarshalIndent(struct {
+				Marks    []*csb.Mark    `json:"marks"`
+				Comments []*csb.Comment `json:"comments"`
+			}{sheet.marks, sheet.comments}, "", "  ")
+			if err != nil {
+				t.Fatal(err)
+			}
+			got = append(got, '\n')
+
+			golden := tt.name + ".golden"
+			if *update {
+				if err := os.WriteFile(filepath.Join("testdata", golden), got, 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if want := readFile(t, golden); !bytes.Equal(got, want) {
+				t.Errorf("marksheet doesent match %v, run with -update to see the diff:\n%s", golden, got)
+			}
+		})
+	}
+}
+
+func TestParseRows(t *testing.T) {
+	tests := []struct {
+		name   string
+		markup string
+		want   [][]string
+	}{
+		{
+			name:   "leading spans",
+			markup: `<tr><td rowspan="3">a</td><td rowspan="2">b</td><td>c</td></tr><tr><td>d</td></tr><tr><td>e</td><td>f</td></tr>`,
+			want:   [][]string{{"a", "b", "c"}, {"a", "b", "d"}, {"a", "e", "f"}},
+		},
+		{
+			name:   "middle span",
+			markup: `<tr><td>a</td><td rowspan="2">b</td><td>c</td></tr><tr><td>d</td><td>e</td></tr>`,
+			want:   [][]string{{"a", "b", "c"}, {"d", "b", "e"}},
+		},
+		{
+			name:   "trailing span",
+			markup: `<tr><td>a</td><td>b</td><td rowspan="2">c</td></tr><tr><td>d</td></tr>`,
+			want:   [][]string{{"a", "b", "c"}, {"d", "", "c"}},
+		},
+		{
+			name:   "invalid span",
+			markup: `<tr><td rowspan="x">a</td><td>b</td></tr><tr><td>c</td></tr>`,
+			want:   [][]string{{"a", "b"}, {"c"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rows, err := parseRows(strings.NewReader("<table>" + tt.markup + "</table>"))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got := make([][]string, 0, len(rows))
+			for _, row := range rows {
+				got = append(got, row.cells)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("expected rows %q, got: %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestParsePercentage(t *testing.T) {
+	tests := []struct {
+		cell string
+		want int
+		ok   bool
+	}{
+		{"84%", 84, true},
+		{"84", 84, true},
+		{" 71.5 % ", 72, true},
+		{"66,4", 66, true},
+		{"100%", 100, true},
+		{"0", 0, true},
+		{"101", 0, false},
+		{"-3", 0, false},
+		{"n/a", 0, false},
+		{"A*", 0, false},
+		{"", 0, false},
+	}
+
+	for _, tt := range tests {
+		got, ok := parsePercentage(tt.cell)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("parsePercentage(%q) = %v, %v, want: %v, %v", tt.cell, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestColumnType(t *testing.T) {
+	tests := []struct {
+		typ, name string
+		want      string
+	}{
+		{"", "Mark %", csb.COLUMN_PERCENTAGE},
+		{"", "Teacher Comment", csb.COLUMN_COMMENT},
+		{"Effort", "Effort", csb.COLUMN_EFFORT},
+		{"", "Predicted Grade", csb.COLUMN_PREDICTED},
+		{"", "Attainment", csb.COLUMN_GRADE},
+		{"", "Coursework %", csb.COLUMN_COURSEWORK},
+		{"", "Mock Exam", csb.COLUMN_EXAM},
+	}
+
+	for _, tt := range tests {
+		if got := columnType(tt.typ, tt.name); got != tt.want {
+			t.Errorf("columnType(%q, %q) = %v, want: %v", tt.typ, tt.name, got, tt.want)
+		}
+	}
+}
+
+func readFile(t *testing.T, name string) []byte {
+	t.Helper()
+
+	b, err := os.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
@@ -0,0 +1,315 @@
+package engage
+
+import (
+	"context"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	csb "github.com/Lambels/CSB-Open-API"
+)
+
+var _ csb.PeriodService = (*PeriodService)(nil)
+
+// DefaultPeriodsTTL is the default duration periods fetched from engage are cached for.
+const DefaultPeriodsTTL = time.Hour
+
+var (
+	academicYearRe = regexp.MustCompile(`\d{4}`)
+	termRe         = regexp.MustCompile(`(?i)\b(?:term|t)\s*([1-4])\b`)
+)
+
+// ReportingPeriod represents an engage reporting period.
+type ReportingPeriod struct {
+	// Value is the engage identifier of the reporting period, used as a parameter for
+	// engage requests.
+	Value string `json:"value"`
+	// Label is the label engage displays for the reporting period.
+	Label string `json:"label"`
+	// Period is the full period parsed from the label.
+	Period csb.Period `json:"period"`
+}
+
+// PeriodService is a period service implemented over engage.
+//
+// The academic years and reporting periods of each student are cached for TTL to avoid
+// spamming engage.
+type PeriodService struct {
+	// TTL is the duration fetched periods are cached for.
+	//
+	// Defaults to DefaultPeriodsTTL.
+	TTL time.Duration
+
+	// Now returns the current time, defaults to time.Now.
+	Now func() time.Time
+
+	c *Client
+
+	mu      sync.Mutex
+	years   map[int]cachedYears
+	periods map[periodsKey]cachedPeriods
+}
+
+type cachedYears struct {
+	years   []int
+	expires time.Time
+}
+
+type periodsKey struct {
+	pid          int
+	academicYear int
+}
+
+type cachedPeriods struct {
+	periods []csb.Period
+	expires time.Time
+}
+
+// NewPeriodService creates a new period service over the engage client.
+func NewPeriodService(client *Client) *PeriodService {
+	return &PeriodService{
+		TTL:     DefaultPeriodsTTL,
+		Now:     time.Now,
+		c:       client,
+		years:   make(map[int]cachedYears),
+		periods: make(map[periodsKey]cachedPeriods),
+	}
+}
+
+// BuildPeriods builds the periods of academicYear, narrowed to term if term isnt 0.
+//
+// If pid is provided the ordered full periods of the student are returned, else the periods
+// of each term of the academic year.
+//
+// returns EINVALID if term is provided without a pid.
+func (s *PeriodService) BuildPeriods(ctx context.Context, pid int, academicYear int, term int) ([]csb.Period, error) {
+	base := csb.Period{AcademicYear: academicYear}
+	if term != 0 {
+		if pid == 0 {
+			return nil, csb.Errorf(csb.EINVALID, "build periods: cannot narrow periods to a term without a student id")
+		}
+		base.Term = &term
+	}
+	if err := base.Validate(); err != nil {
+		return nil, err
+	}
+
+	if pid == 0 {
+		return termPeriods(academicYear, 1, academicYear, 4), nil
+	}
+
+	periods, err := s.findPeriods(ctx, pid, academicYear)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]csb.Period, 0, len(periods))
+	for _, period := range periods {
+		if base.Contains(period) {
+			out = append(out, period)
+		}
+	}
+	return out, nil
+}
+
+// Exists checks wether the student with pid = pid has any period under period.
+//
+// returns EINVALID if pid isnt provided.
+func (s *PeriodService) Exists(ctx context.Context, pid int, period csb.Period) (bool, error) {
+	if err := period.Validate(); err != nil {
+		return false, err
+	}
+	if pid == 0 {
+		return false, csb.Errorf(csb.EINVALID, "exists: cannot check a period without a student id")
+	}
+
+	years, err := s.findAcademicYears(ctx, pid)
+	if err != nil {
+		return false, err
+	}
+	if !containsInt(years, period.AcademicYear) {
+		return false, nil
+	}
+
+	periods, err := s.findPeriods(ctx, pid, period.AcademicYear)
+	if err != nil {
+		return false, err
+	}
+	for _, p := range periods {
+		if period.Contains(p) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// PeriodRange generates the ordered range of periods [from, to].
+//
+// If pid is provided the range holds the full periods of the student, else the range is
+// made of terms and the importance of from and to is ignored.
+//
+// returns EINVALID if to is before from.
+func (s *PeriodService) PeriodRange(ctx context.Context, pid int, from, to csb.Period) ([]csb.Period, error) {
+	if err := from.Validate(); err != nil {
+		return nil, err
+	}
+	if err := to.Validate(); err != nil {
+		return nil, err
+	}
+	if to.Before(from) {
+		return nil, csb.Errorf(csb.EINVALID, "period range: to period is before from period")
+	}
+
+	if pid == 0 {
+		fromTerm, toTerm := 1, 4
+		if from.Term != nil {
+			fromTerm = *from.Term
+		}
+		if to.Term != nil {
+			toTerm = *to.Term
+		}
+		return termPeriods(from.AcademicYear, fromTerm, to.AcademicYear, toTerm), nil
+	}
+
+	years, err := s.findAcademicYears(ctx, pid)
+	if err != nil {
+		return nil, err
+	}
+
+	var all []csb.Period
+	for _, year := range years {
+		if year < from.AcademicYear || year > to.AcademicYear {
+			continue
+		}
+
+		periods, err := s.findPeriods(ctx, pid, year)
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, periods...)
+	}
+
+	start, end := -1, -1
+	for i, period := range all {
+		if start == -1 && (from.Contains(period) || from.Before(period)) {
+			start = i
+		}
+		if to.Contains(period) || period.Before(to) {
+			end = i
+		}
+	}
+	if start == -1 || end < start {
+		return []csb.Period{}, nil
+	}
+	return all[start : end+1], nil
+}
+
+// findAcademicYears returns the sorted academic years of the student with pid = pid.
+func (s *PeriodService) findAcademicYears(ctx context.Context, pid int) ([]int, error) {
+	s.mu.Lock()
+	cached, ok := s.years[pid]
+	s.mu.Unlock()
+	if ok && s.Now().Before(cached.expires) {
+		return cached.years, nil
+	}
+
+	years, err := s.c.GetAcademicYears(ctx, pid)
+	if err != nil {
+		return nil, err
+	}
+	sort.Ints(years)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.years[pid] = cachedYears{years: years, expires: s.Now().Add(s.TTL)}
+	return years, nil
+}
+
+// findPeriods returns the ordered full periods of the student with pid = pid in academicYear.
+func (s *PeriodService) findPeriods(ctx context.Context, pid int, academicYear int) ([]csb.Period, error) {
+	key := periodsKey{pid: pid, academicYear: academicYear}
+
+	s.mu.Lock()
+	cached, ok := s.periods[key]
+	s.mu.Unlock()
+	if ok && s.Now().Before(cached.expires) {
+		return cached.periods, nil
+	}
+
+	reportingPeriods, err := s.c.GetPeriods(ctx, pid, academicYear)
+	// engage answers an academic year without periods the same as an invalid pid.
+	if err != nil && csb.ErrorCode(err) != csb.ENOTFOUND {
+		return nil, err
+	}
+
+	periods := make([]csb.Period, 0, len(reportingPeriods))
+	for _, reportingPeriod := range reportingPeriods {
+		periods = append(periods, reportingPeriod.Period)
+	}
+	sort.SliceStable(periods, func(i, j int) bool {
+		return periods[i].Before(periods[j])
+	})
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.periods[key] = cachedPeriods{periods: periods, expires: s.Now().Add(s.TTL)}
+	return periods, nil
+}
+
+// termPeriods generates the term periods between [fromYear/fromTerm, toYear/toTerm].
+func termPeriods(fromYear, fromTerm, toYear, toTerm int) []csb.Period {
+	out := make([]csb.Period, 0)
+	for year, term := fromYear, fromTerm; year < toYear || (year == toYear && term <= toTerm); {
+		t := term
+		out = append(out, csb.Period{AcademicYear: year, Term: &t})
+
+		if term++; term > 4 {
+			year, term = year+1, 1
+		}
+	}
+	return out
+}
+
+func containsInt(elems []int, v int) bool {
+	for _, e := range elems {
+		if e == v {
+			return true
+		}
+	}
+	return false
+}
+
+// parsePeriod parses a full period from engage's academic year and reporting period labels.
+//
+// The academic year label is expected to start with the year the academic year begins in,
+// "2022/2023" -> 2022. The reporting period label is expected to name the term, "Term 2 - Mock"
+// -> term 2, importance "Mock". If the label has nothing else but the term the whole label is
+// used as the importance.
+func parsePeriod(academicYear, reportingPeriod string) (csb.Period, error) {
+	year, err := strconv.Atoi(academicYearRe.FindString(academicYear))
+	if err != nil {
+		return csb.Period{}, csb.Errorf(csb.EINVALID, "engage: invalid academic year label: %q", academicYear)
+	}
+
+	loc := termRe.FindStringSubmatchIndex(reportingPeriod)
+	if loc == nil {
+		return csb.Period{}, csb.Errorf(csb.EINVALID, "engage: invalid reporting period label: %q", reportingPeriod)
+	}
+	term, _ := strconv.Atoi(reportingPeriod[loc[2]:loc[3]])
+
+	importance := strings.Trim(reportingPeriod[:loc[0]]+" "+reportingPeriod[loc[1]:], " -–:/()")
+	importance = strings.Join(strings.Fields(importance), " ")
+	if importance == "" {
+		importance = strings.TrimSpace(reportingPeriod)
+	}
+
+	period := csb.Period{
+		AcademicYear: year,
+		Term:         &term,
+		Importance:   &importance,
+	}
+	return period, period.Validate()
+}
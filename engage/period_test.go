@@ -0,0 +1,122 @@
+package engage
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	csb "github.com/Lambels/CSB-Open-API"
+)
+
+func TestParsePeriod(t *testing.T) {
+	tests := []struct {
+		name            string
+		academicYear    string
+		reportingPeriod string
+		term            int
+		importance      string
+		code            string
+	}{
+		{name: "term and importance", academicYear: "2022/2023", reportingPeriod: "Term 2 - Mock", term: 2, importance: "Mock"},
+		{name: "importance first", academicYear: "2022", reportingPeriod: "Mock (T3)", term: 3, importance: "Mock"},
+		{name: "extra spaces", academicYear: "2022/2023", reportingPeriod: "  Term 1  -  End of  Term ", term: 1, importance: "End of Term"},
+		{name: "only term", academicYear: "2022/2023", reportingPeriod: "Term 4", term: 4, importance: "Term 4"},
+		{name: "no term", academicYear: "2022/2023", reportingPeriod: "Mock", code: csb.EINVALID},
+		{name: "term out of range", academicYear: "2022/2023", reportingPeriod: "Term 5 - Mock", code: csb.EINVALID},
+		{name: "no academic year", academicYear: "current", reportingPeriod: "Term 1 - Mock", code: csb.EINVALID},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			period, err := parsePeriod(tt.academicYear, tt.reportingPeriod)
+			if code := csb.ErrorCode(err); code != tt.code {
+				t.Fatalf("expected code %q, got: %v", tt.code, err)
+			} else if err != nil {
+				return
+			}
+
+			if period.AcademicYear != 2022 || *period.Term != tt.term || *period.Importance != tt.importance {
+				t.Fatalf("expected 2022 term %v %q, got: %v", tt.term, tt.importance, period)
+			}
+		})
+	}
+}
+
+func TestPeriodService_Cache(t *testing.T) {
+	var mu sync.Mutex
+	requests := make(map[string]int)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		endpoint := r.URL.Path[strings.LastIndex(r.URL.Path, "/")+1:]
+		mu.Lock()
+		requests[endpoint]++
+		mu.Unlock()
+
+		var res engageResponse
+		switch endpoint {
+		case academicYearsURL:
+			res.D = []engageData{{Text: "2022/2023", Value: "2022"}}
+		case reportingPeriodsURL:
+			res.D = []engageData{
+				{Text: "Term 2 - Mock", Value: "2"},
+				{Text: "Term 1 - Mock", Value: "1"},
+				{Text: "Attendance", Value: "3"},
+			}
+		}
+		json.NewEncoder(w).Encode(res)
+	}))
+	defer srv.Close()
+
+	c := NewClient(srv.Client(), "")
+	c.BaseURL = srv.URL + "/"
+	c.Limiter = nil
+
+	now := time.Date(2022, 10, 1, 0, 0, 0, 0, time.UTC)
+	s := NewPeriodService(c)
+	s.TTL = time.Minute
+	s.Now = func() time.Time { return now }
+
+	ctx := context.Background()
+	lookup := func() {
+		t.Helper()
+		term := 1
+		if ok, err := s.Exists(ctx, 1001, csb.Period{AcademicYear: 2022, Term: &term}); err != nil {
+			t.Fatal(err)
+		} else if !ok {
+			t.Fatal("expected term 1 to exist")
+		}
+	}
+	expectRequests := func(n int) {
+		t.Helper()
+		mu.Lock()
+		defer mu.Unlock()
+		if requests[academicYearsURL] != n || requests[reportingPeriodsURL] != n {
+			t.Fatalf("expected %v requests per endpoint, got: %v", n, requests)
+		}
+	}
+
+	lookup()
+	expectRequests(1)
+
+	// cache hit.
+	now = now.Add(30 * time.Second)
+	lookup()
+	expectRequests(1)
+
+	// the periods are ordered and the label without a term is skipped.
+	periods, err := s.BuildPeriods(ctx, 1001, 2022, 0)
+	if err != nil {
+		t.Fatal(err)
+	} else if len(periods) != 2 || *periods[0].Term != 1 || *periods[1].Term != 2 {
+		t.Fatalf("expected terms 1 and 2, got: %v", periods)
+	}
+	expectRequests(1)
+
+	// expired.
+	now = now.Add(time.Minute)
+	lookup()
+	expectRequests(2)
+}
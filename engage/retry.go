@@ -0,0 +1,83 @@
+package engage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"syscall"
+	"time"
+)
+
+// DefaultRetryPolicy is the retry policy used by new clients.
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts: 3,
+	BaseDelay:   250 * time.Millisecond,
+	MaxDelay:    5 * time.Second,
+}
+
+// RetryPolicy describes how failed engage lookups are retried.
+//
+// Lookups are retried on timeouts, connection resets, 5xx responses which dont carry a known
+// engage exception and 429 responses. Every retry waits with an exponential backoff and full
+// jitter.
+type RetryPolicy struct {
+	// MaxAttempts is the maximum amount of attempts, including the first one. Values < 2
+	// disable retries.
+	MaxAttempts int
+	// BaseDelay is the backoff of the first retry, it doubles with every attempt.
+	BaseDelay time.Duration
+	// MaxDelay caps the backoff.
+	MaxDelay time.Duration
+}
+
+// backoff returns a jittered delay before the retry following attempt (0 indexed).
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	d := p.BaseDelay << attempt
+	if d <= 0 || (p.MaxDelay > 0 && d > p.MaxDelay) {
+		d = p.MaxDelay
+	}
+	if d <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(d) + 1))
+}
+
+// sleep waits the backoff following attempt or until ctx is done.
+func (p RetryPolicy) sleep(ctx context.Context, attempt int) error {
+	t := time.NewTimer(p.backoff(attempt))
+	defer t.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
+
+// retryableStatus reports wether a response with status code = status is worth retrying.
+func retryableStatus(status int) bool {
+	return status >= http.StatusInternalServerError || status == http.StatusTooManyRequests
+}
+
+// retryableErr reports wether a transport error is worth retrying.
+func retryableErr(ctx context.Context, err error) bool {
+	// the caller gave up.
+	if ctx.Err() != nil {
+		return false
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+
+	return errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, syscall.EPIPE) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, io.EOF)
+}
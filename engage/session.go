@@ -0,0 +1,269 @@
+package engage
+
+import (
+	"context"
+	"encoding/xml"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+
+	csb "github.com/Lambels/CSB-Open-API"
+)
+
+// DefaultLoginURL is the url of the school's engage login form.
+const DefaultLoginURL = "https://cambridgeschoolportal.engagehosted.com/Login.aspx"
+
+// Credentials are the credentials of an engage account.
+type Credentials struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+// Session is a logged in engage session, it captures the auth cookies issued by the engage
+// login form and renews them when they expire.
+//
+// A session is safe for concurrent use, concurrent renewals of the same expired cookie
+// result in a single login.
+type Session struct {
+	// LoginURL is the url of the engage login form.
+	//
+	// Defaults to DefaultLoginURL.
+	LoginURL string
+
+	creds Credentials
+	cc    *http.Client
+
+	mu     sync.Mutex
+	cookie string
+}
+
+// NewSession creates a new session which logs in with creds using c. The session doesnt log
+// in until it is first used.
+func NewSession(c *http.Client, creds Credentials) *Session {
+	// copy the client to capture the cookies set by a redirecting login.
+	cc := *c
+	cc.CheckRedirect = func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+	cc.Jar = nil
+
+	return &Session{
+		LoginURL: DefaultLoginURL,
+		creds:    creds,
+		cc:       &cc,
+	}
+}
+
+// Cookie returns the current auth cookie, it reports false if the session isnt logged in.
+func (s *Session) Cookie() (string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.cookie, s.cookie != ""
+}
+
+// Renew logs in again if the session still holds the stale cookie and returns the current
+// cookie. An empty stale cookie renews a session which isnt logged in.
+//
+// returns EUNAUTHORIZED if engage refuses the credentials.
+func (s *Session) Renew(ctx context.Context, stale string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// someone else already renewed the session.
+	if s.cookie != stale {
+		return s.cookie, nil
+	}
+
+	cookie, err := s.login(ctx)
+	if err != nil {
+		return "", err
+	}
+	s.cookie = cookie
+	return cookie, nil
+}
+
+// login fetches the login form and posts it back filled with the credentials, it returns the
+// cookie header built from the cookies engage set.
+//
+// The login form is an asp.net web form: it only accepts posts carrying the hidden state
+// fields (__VIEWSTATE, __EVENTVALIDATION, ...) and the session cookie it was rendered with.
+func (s *Session) login(ctx context.Context) (string, error) {
+	form, cookies, err := s.loginForm(ctx)
+	if err != nil {
+		return "", err
+	}
+	form.fields.Set(form.username, s.creds.Username)
+	form.fields.Set(form.password, s.creds.Password)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, form.action, strings.NewReader(form.fields.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+	for _, cookie := range cookies {
+		req.AddCookie(&http.Cookie{Name: cookie.Name, Value: cookie.Value})
+	}
+
+	resp, err := s.cc.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden:
+		return "", csb.Errorf(csb.EUNAUTHORIZED, "engage: login refused for %v", s.creds.Username)
+	case resp.StatusCode >= http.StatusBadRequest:
+		return "", csb.Errorf(csb.EINTERNAL, "engage: login failed with status %v", resp.StatusCode)
+	}
+
+	if len(resp.Cookies()) == 0 {
+		// engage re-renders the login form without cookies on bad credentials.
+		return "", csb.Errorf(csb.EUNAUTHORIZED, "engage: login refused for %v", s.creds.Username)
+	}
+
+	// the cookies set by the login replace the ones set with the form.
+	pairs := make([]string, 0)
+	seen := make(map[string]struct{})
+	for _, cookie := range append(resp.Cookies(), cookies...) {
+		if _, ok := seen[cookie.Name]; ok {
+			continue
+		}
+		seen[cookie.Name] = struct{}{}
+		pairs = append(pairs, (&http.Cookie{Name: cookie.Name, Value: cookie.Value}).String())
+	}
+	return strings.Join(pairs, "; "), nil
+}
+
+// loginForm gets the login form and parses it, it returns the form along side the cookies set
+// with it.
+func (s *Session) loginForm(ctx context.Context) (*loginForm, []*http.Cookie, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.LoginURL, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	resp, err := s.cc.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, nil, csb.Errorf(csb.EINTERNAL, "engage: get login form failed with status %v", resp.StatusCode)
+	}
+
+	form, err := parseLoginForm(resp.Body)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	action, err := resp.Request.URL.Parse(form.action)
+	if err != nil {
+		return nil, nil, csb.Errorf(csb.EINTERNAL, "engage: invalid login form action: %q", form.action)
+	}
+	form.action = action.String()
+
+	return form, resp.Cookies(), nil
+}
+
+// loginForm represents the login form rendered by engage.
+type loginForm struct {
+	// action is the url the form posts to.
+	action string
+	// fields are the fields posted back as rendered: the hidden state fields and the submit
+	// button.
+	fields url.Values
+	// username and password are the names of the credential fields.
+	username, password string
+	// submit indicates wether the submit button was added, only the first one is posted.
+	submit bool
+}
+
+// parseLoginForm parses the form holding a password field from the markup in r.
+//
+// returns EINTERNAL if the markup holds no login form.
+func parseLoginForm(r io.Reader) (*loginForm, error) {
+	d := xml.NewDecoder(r)
+	d.Strict = false
+	d.AutoClose = xml.HTMLAutoClose
+	d.Entity = xml.HTMLEntity
+
+	// a page may hold several forms, the login form is the one with a password field.
+	var form, login *loginForm
+	for {
+		// stop at the first error, the markup parsed so far may hold the form already.
+		tkn, err := d.Token()
+		if err != nil {
+			break
+		}
+
+		switch t := tkn.(type) {
+		case xml.StartElement:
+			switch strings.ToLower(t.Name.Local) {
+			case "form":
+				form = &loginForm{action: attr(t, "action"), fields: make(url.Values)}
+			case "input":
+				if form != nil {
+					form.add(t)
+				}
+			}
+		case xml.EndElement:
+			if strings.ToLower(t.Name.Local) != "form" || form == nil {
+				break
+			}
+			if login == nil && form.username != "" && form.password != "" {
+				login = form
+			}
+			form = nil
+		}
+	}
+
+	// the form may be left open by the markup.
+	if login == nil && form != nil && form.username != "" && form.password != "" {
+		login = form
+	}
+	if login == nil {
+		return nil, csb.Errorf(csb.EINTERNAL, "engage: login form not found")
+	}
+	return login, nil
+}
+
+// add adds the input el to the form.
+func (f *loginForm) add(el xml.StartElement) {
+	name := attr(el, "name")
+	if name == "" {
+		return
+	}
+
+	switch strings.ToLower(attr(el, "type")) {
+	case "hidden":
+		f.fields.Set(name, attr(el, "value"))
+	case "submit":
+		if !f.submit {
+			f.fields.Set(name, attr(el, "value"))
+			f.submit = true
+		}
+	case "password":
+		if f.password == "" {
+			f.password = name
+		}
+	case "", "text", "email":
+		if f.username == "" {
+			f.username = name
+		}
+	}
+}
+
+// attr returns the value of the attribute of el with name = name.
+func attr(el xml.StartElement, name string) string {
+	for _, a := range el.Attr {
+		if strings.EqualFold(a.Name.Local, name) {
+			return a.Value
+		}
+	}
+	return ""
+}
@@ -0,0 +1,76 @@
+package engage
+
+import (
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+
+	csb "github.com/Lambels/CSB-Open-API"
+)
+
+func TestParseLoginForm(t *testing.T) {
+	tests := []struct {
+		name   string
+		markup string
+		want   *loginForm
+	}{
+		{
+			name: "web form",
+			markup: `<html><body>
+<form method="get" action="/Search.aspx"><input type="text" name="q"><input type="submit" name="go" value="Go"></form>
+<form method="post" action="./Login.aspx?ReturnUrl=%2f" id="aspnetForm">
+<input type="hidden" name="__VIEWSTATE" value="state&amp;more" />
+<input type="hidden" name="__EVENTVALIDATION" value="validation" />
+<input name="ctl00$txtUsername" type="text" />
+<input name="ctl00$txtPassword" type="password" />
+<input type="submit" name="ctl00$btnLogin" value="Log In" />
+<input type="submit" name="ctl00$btnForgotten" value="Forgotten Password" />
+</form>
+</body></html>`,
+			want: &loginForm{
+				action: "./Login.aspx?ReturnUrl=%2f",
+				fields: url.Values{
+					"__VIEWSTATE":       {"state&more"},
+					"__EVENTVALIDATION": {"validation"},
+					"ctl00$btnLogin":    {"Log In"},
+				},
+				username: "ctl00$txtUsername",
+				password: "ctl00$txtPassword",
+				submit:   true,
+			},
+		},
+		{
+			name:   "unclosed form",
+			markup: `<form action="/Login.aspx"><input name="user"><input name="pass" type="password">`,
+			want: &loginForm{
+				action:   "/Login.aspx",
+				fields:   url.Values{},
+				username: "user",
+				password: "pass",
+			},
+		},
+		{
+			name:   "no login form",
+			markup: `<html><body><form action="/Search.aspx"><input type="text" name="q"></form></body></html>`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			form, err := parseLoginForm(strings.NewReader(tt.markup))
+			if tt.want == nil {
+				if csb.ErrorCode(err) != csb.EINTERNAL {
+					t.Fatalf("expected EINTERNAL, got: %v", err)
+				}
+				return
+			} else if err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(form, tt.want) {
+				t.Fatalf("expected %+v, got: %+v", tt.want, form)
+			}
+		})
+	}
+}
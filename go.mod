@@ -3,9 +3,12 @@ module github.com/Lambels/CSB-Open-API
 go 1.19
 
 require (
-	github.com/golang-migrate/migrate/v4 v4.15.2 // indirect
+	github.com/golang-migrate/migrate/v4 v4.15.2
+	github.com/mattn/go-sqlite3 v1.14.10
+)
+
+require (
 	github.com/hashicorp/errwrap v1.1.0 // indirect
 	github.com/hashicorp/go-multierror v1.1.1 // indirect
-	github.com/mattn/go-sqlite3 v1.14.10 // indirect
 	go.uber.org/atomic v1.7.0 // indirect
 )
@@ -0,0 +1,287 @@
+package csb
+
+import (
+	"sort"
+	"sync"
+)
+
+// Names of the built in grade scales.
+const (
+	// SCALE_IGCSE is the Cambridge IGCSE letter scale: A*-G and U.
+	SCALE_IGCSE = "igcse"
+	// SCALE_ROMANIAN is the Romanian 1-10 scale.
+	SCALE_ROMANIAN = "romanian"
+)
+
+// GradeScale represents a named grade scale and its boundary tables.
+type GradeScale struct {
+	// Name of the scale, used to look the scale up.
+	Name string `json:"name"`
+	// Grades holds the grades of the scale ordered from best to worst.
+	Grades []string `json:"grades"`
+	// Tables holds the versioned boundary tables of the scale.
+	Tables []BoundaryTable `json:"tables"`
+}
+
+// BoundaryTable represents a version of the grade boundaries of a scale. A table applies to
+// the marks of its subject recieved in the period range [From, To].
+//
+// Boundaries change between exam sessions, so a scale usually has multiple tables. The table
+// used to grade a mark is the most specific one: subject tables come before tables for all
+// subjects, then the table with the latest From period wins.
+type BoundaryTable struct {
+	// Version is the label of the table, "June 2023".
+	Version string `json:"version"`
+	// Subject the table applies to, empty for all subjects.
+	Subject Subject `json:"subject"`
+	// From is the first period the table applies to, the zero period for no lower bound.
+	//
+	// It can only be narrowed down to term level.
+	From Period `json:"from"`
+	// To is the last period the table applies to, the zero period for no upper bound.
+	//
+	// It can only be narrowed down to term level.
+	To Period `json:"to"`
+	// Boundaries maps each grade of the scale to the minimum percentage required for it.
+	// Grades without a boundary are never awarded.
+	Boundaries map[string]int `json:"boundaries"`
+}
+
+// Applies reports wether the table applies to a mark of subject recieved in period.
+func (t BoundaryTable) Applies(subject Subject, period Period) bool {
+	if t.Subject != "" && t.Subject != subject {
+		return false
+	}
+	if t.From.AcademicYear != 0 && !t.From.Contains(period) && period.Before(t.From) {
+		return false
+	}
+	if t.To.AcademicYear != 0 && !t.To.Contains(period) && t.To.Before(period) {
+		return false
+	}
+	return true
+}
+
+// Validate validates the scale and its tables.
+func (s *GradeScale) Validate() error {
+	if s.Name == "" {
+		return Errorf(EINVALID, "validate: grade scale missing name field")
+	}
+	if len(s.Grades) == 0 {
+		return Errorf(EINVALID, "validate: grade scale %v has no grades", s.Name)
+	}
+
+	grades := make(map[string]struct{}, len(s.Grades))
+	for _, grade := range s.Grades {
+		if _, ok := grades[grade]; ok {
+			return Errorf(EINVALID, "validate: grade scale %v has duplicate grade %v", s.Name, grade)
+		}
+		grades[grade] = struct{}{}
+	}
+
+	for _, t := range s.Tables {
+		if len(t.Boundaries) == 0 {
+			return Errorf(EINVALID, "validate: grade scale %v table %v has no boundaries", s.Name, t.Version)
+		}
+		for _, p := range []Period{t.From, t.To} {
+			if p.AcademicYear == 0 {
+				continue
+			}
+			if err := p.Validate(); err != nil {
+				return err
+			}
+			if p.Importance != nil {
+				return Errorf(EINVALID, "validate: grade scale %v table %v periods can only be narrowed to term level", s.Name, t.Version)
+			}
+		}
+
+		// boundaries must decrease as grades get worse.
+		prev := 101
+		for _, grade := range s.Grades {
+			min, ok := t.Boundaries[grade]
+			if !ok {
+				continue
+			}
+			if min < 0 || min > 100 || min >= prev {
+				return Errorf(EINVALID, "validate: grade scale %v table %v has invalid boundary for %v: %v", s.Name, t.Version, grade, min)
+			}
+			prev = min
+		}
+		for grade := range t.Boundaries {
+			if _, ok := grades[grade]; !ok {
+				return Errorf(EINVALID, "validate: grade scale %v table %v has unknown grade %v", s.Name, t.Version, grade)
+			}
+		}
+	}
+	return nil
+}
+
+// Table returns the table used to grade a mark of subject recieved in period.
+//
+// returns ENOTFOUND if no table applies.
+func (s *GradeScale) Table(subject Subject, period Period) (*BoundaryTable, error) {
+	var best *BoundaryTable
+	for i := range s.Tables {
+		t := &s.Tables[i]
+		if !t.Applies(subject, period) {
+			continue
+		}
+
+		switch {
+		case best == nil:
+			best = t
+		case (t.Subject != "") != (best.Subject != ""):
+			if t.Subject != "" {
+				best = t
+			}
+		case best.From.Before(t.From):
+			best = t
+		}
+	}
+
+	if best == nil {
+		return nil, Errorf(ENOTFOUND, "grade scale %v has no boundaries for %v in %v", s.Name, subject, period)
+	}
+	return best, nil
+}
+
+// Grade converts percentage to a grade using table.
+//
+// returns ENOTFOUND if the percentage is below every boundary of the table.
+func (s *GradeScale) Grade(table *BoundaryTable, percentage int) (string, error) {
+	for _, grade := range s.Grades {
+		min, ok := table.Boundaries[grade]
+		if ok && percentage >= min {
+			return grade, nil
+		}
+	}
+	return "", Errorf(ENOTFOUND, "grade scale %v table %v has no grade for %v%%", s.Name, table.Version, percentage)
+}
+
+// Ranges returns the percentage ranges [min, max] awarding each grade of table, ordered from
+// best to worst grade.
+func (s *GradeScale) Ranges(table *BoundaryTable) []GradeRange {
+	out := make([]GradeRange, 0, len(table.Boundaries))
+	max := 100
+	for _, grade := range s.Grades {
+		min, ok := table.Boundaries[grade]
+		if !ok {
+			continue
+		}
+		out = append(out, GradeRange{Grade: grade, Min: min, Max: max})
+		max = min - 1
+	}
+	return out
+}
+
+// GradeRange represents the inclusive percentage range awarding a grade.
+type GradeRange struct {
+	Grade string `json:"grade"`
+	Min   int    `json:"min"`
+	Max   int    `json:"max"`
+}
+
+// GradeFilter filters marks on their grade on a scale.
+type GradeFilter struct {
+	// Scale is the name of the grade scale.
+	Scale string `json:"scale"`
+	// Grades lets through the marks with one of the specified grades.
+	Grades []string `json:"grades"`
+}
+
+// Grade returns the grade of the mark on scale, graded with the boundaries for the mark
+// subject and period.
+//
+// returns ENOTFOUND if the scale has no boundaries for the mark and EINVALID if the mark isnt
+// numeric.
+func (m *Mark) Grade(scale *GradeScale) (string, error) {
+	if !m.Numeric() {
+		return "", Errorf(EINVALID, "mark isnt numeric: %q", m.Value)
+	}
+	table, err := scale.Table(m.Subject, m.Period)
+	if err != nil {
+		return "", err
+	}
+	return scale.Grade(table, m.Percentage)
+}
+
+// RegisterGradeScale validates and registers a grade scale so that it can be looked up by
+// name. Registering a scale with the name of an existing scale replaces it, unless the scale
+// has no grades in which case its tables are added to the existing scale.
+func RegisterGradeScale(scale GradeScale) error {
+	gradeScalesMu.Lock()
+	defer gradeScalesMu.Unlock()
+
+	if existing, ok := gradeScales[scale.Name]; ok && len(scale.Grades) == 0 {
+		scale.Grades = existing.Grades
+		scale.Tables = append(append([]BoundaryTable(nil), existing.Tables...), scale.Tables...)
+	}
+	if err := scale.Validate(); err != nil {
+		return err
+	}
+
+	gradeScales[scale.Name] = &scale
+	return nil
+}
+
+// RegisterGradeScales registers multiple grade scales, usually loaded from the config.
+func RegisterGradeScales(scales []GradeScale) error {
+	for _, scale := range scales {
+		if err := RegisterGradeScale(scale); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// FindGradeScale returns the registered grade scale with name = name.
+//
+// returns ENOTFOUND if the scale isnt registered.
+func FindGradeScale(name string) (*GradeScale, error) {
+	gradeScalesMu.RLock()
+	defer gradeScalesMu.RUnlock()
+
+	scale, ok := gradeScales[name]
+	if !ok {
+		return nil, Errorf(ENOTFOUND, "grade scale not found: %v", name)
+	}
+	return scale, nil
+}
+
+// GradeScaleNames returns the sorted names of the registered grade scales.
+func GradeScaleNames() []string {
+	gradeScalesMu.RLock()
+	defer gradeScalesMu.RUnlock()
+
+	out := make([]string, 0, len(gradeScales))
+	for name := range gradeScales {
+		out = append(out, name)
+	}
+	sort.Strings(out)
+	return out
+}
+
+var (
+	gradeScalesMu sync.RWMutex
+	gradeScales   = map[string]*GradeScale{
+		SCALE_IGCSE: {
+			Name:   SCALE_IGCSE,
+			Grades: []string{"A*", "A", "B", "C", "D", "E", "F", "G", "U"},
+			Tables: []BoundaryTable{{
+				Version: "default",
+				Boundaries: map[string]int{
+					"A*": 90, "A": 80, "B": 70, "C": 60, "D": 50, "E": 40, "F": 30, "G": 20, "U": 0,
+				},
+			}},
+		},
+		SCALE_ROMANIAN: {
+			Name:   SCALE_ROMANIAN,
+			Grades: []string{"10", "9", "8", "7", "6", "5", "4", "3", "2", "1"},
+			Tables: []BoundaryTable{{
+				Version: "default",
+				Boundaries: map[string]int{
+					"10": 95, "9": 85, "8": 75, "7": 65, "6": 55, "5": 45, "4": 35, "3": 25, "2": 15, "1": 0,
+				},
+			}},
+		},
+	}
+)
@@ -0,0 +1,127 @@
+package csb_test
+
+import (
+	"testing"
+
+	csb "github.com/Lambels/CSB-Open-API"
+)
+
+func TestFindGradeScale(t *testing.T) {
+	if _, err := csb.FindGradeScale("unknown"); csb.ErrorCode(err) != csb.ENOTFOUND {
+		t.Fatalf("expected ENOTFOUND, got: %v", err)
+	}
+
+	tests := []struct {
+		scale      string
+		percentage int
+		want       string
+	}{
+		{csb.SCALE_IGCSE, 100, "A*"},
+		{csb.SCALE_IGCSE, 90, "A*"},
+		{csb.SCALE_IGCSE, 89, "A"},
+		{csb.SCALE_IGCSE, 0, "U"},
+		{csb.SCALE_ROMANIAN, 95, "10"},
+		{csb.SCALE_ROMANIAN, 50, "5"},
+		{csb.SCALE_ROMANIAN, 14, "1"},
+	}
+	for _, tt := range tests {
+		scale, err := csb.FindGradeScale(tt.scale)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		mark := &csb.Mark{Subject: csb.MATHEMATICS, Percentage: tt.percentage, Period: mustParsePeriod(t, "2022-23/T1/Mock")}
+		if got, err := mark.Grade(scale); err != nil {
+			t.Fatal(err)
+		} else if got != tt.want {
+			t.Fatalf("expected %v%% to be %v on %v, got: %v", tt.percentage, tt.want, tt.scale, got)
+		}
+	}
+}
+
+func TestGradeScale_Table(t *testing.T) {
+	scale := csb.GradeScale{
+		Name:   "test-table",
+		Grades: []string{"pass", "fail"},
+		Tables: []csb.BoundaryTable{
+			{Version: "default", Boundaries: map[string]int{"pass": 50, "fail": 0}},
+			{Version: "2022", From: mustParsePeriod(t, "2022-23"), Boundaries: map[string]int{"pass": 60, "fail": 0}},
+			{Version: "2023", From: mustParsePeriod(t, "2023-24/T2"), Boundaries: map[string]int{"pass": 70, "fail": 0}},
+			{Version: "maths", Subject: csb.MATHEMATICS, To: mustParsePeriod(t, "2022-23/T4"), Boundaries: map[string]int{"pass": 40}},
+		},
+	}
+	if err := csb.RegisterGradeScale(scale); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		subject csb.Subject
+		period  string
+		version string
+	}{
+		{csb.PHYSICS, "2021-22/T3/Mock", "default"},
+		{csb.PHYSICS, "2022-23/T1/Mock", "2022"},
+		{csb.PHYSICS, "2023-24/T1/Mock", "2022"},
+		{csb.PHYSICS, "2023-24/T2/Mock", "2023"},
+		{csb.MATHEMATICS, "2022-23/T4/Exam", "maths"},
+		{csb.MATHEMATICS, "2023-24/T1/Exam", "2022"},
+	}
+	for _, tt := range tests {
+		table, err := scale.Table(tt.subject, mustParsePeriod(t, tt.period))
+		if err != nil {
+			t.Fatal(err)
+		} else if table.Version != tt.version {
+			t.Fatalf("expected %v table for %v in %v, got: %v", tt.version, tt.subject, tt.period, table.Version)
+		}
+	}
+
+	// the maths table never awards a fail.
+	mark := &csb.Mark{Subject: csb.MATHEMATICS, Percentage: 10, Period: mustParsePeriod(t, "2022-23/T1/Mock")}
+	if _, err := mark.Grade(&scale); csb.ErrorCode(err) != csb.ENOTFOUND {
+		t.Fatalf("expected ENOTFOUND, got: %v", err)
+	}
+	mark.Column.Type = csb.COLUMN_GRADE
+	if _, err := mark.Grade(&scale); csb.ErrorCode(err) != csb.EINVALID {
+		t.Fatalf("expected EINVALID for a non numeric mark, got: %v", err)
+	}
+}
+
+func TestRegisterGradeScale(t *testing.T) {
+	if err := csb.RegisterGradeScale(csb.GradeScale{
+		Name:   "test-register",
+		Grades: []string{"pass", "fail"},
+		Tables: []csb.BoundaryTable{{Version: "default", Boundaries: map[string]int{"pass": 50, "fail": 0}}},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	// a scale without grades adds its tables to the existing scale.
+	if err := csb.RegisterGradeScale(csb.GradeScale{
+		Name:   "test-register",
+		Tables: []csb.BoundaryTable{{Version: "2023", From: mustParsePeriod(t, "2023-24"), Boundaries: map[string]int{"pass": 60, "fail": 0}}},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	scale, err := csb.FindGradeScale("test-register")
+	if err != nil {
+		t.Fatal(err)
+	} else if len(scale.Grades) != 2 || len(scale.Tables) != 2 {
+		t.Fatalf("expected the tables to be merged, got: %+v", scale)
+	}
+
+	invalid := []csb.GradeScale{
+		{Name: "", Grades: []string{"pass"}},
+		{Name: "test-invalid", Grades: []string{"pass", "pass"}},
+		{Name: "test-invalid", Grades: []string{"pass", "fail"}, Tables: []csb.BoundaryTable{{Version: "increasing", Boundaries: map[string]int{"pass": 50, "fail": 60}}}},
+		{Name: "test-invalid", Grades: []string{"pass", "fail"}, Tables: []csb.BoundaryTable{{Version: "unknown", Boundaries: map[string]int{"merit": 50}}}},
+		{Name: "test-invalid", Grades: []string{"pass", "fail"}, Tables: []csb.BoundaryTable{{Version: "importance", From: mustParsePeriod(t, "2022-23/T1/Mock"), Boundaries: map[string]int{"pass": 50}}}},
+	}
+	for _, scale := range invalid {
+		if err := csb.RegisterGradeScale(scale); csb.ErrorCode(err) != csb.EINVALID {
+			t.Fatalf("expected EINVALID for %+v, got: %v", scale, err)
+		}
+	}
+	if _, err := csb.FindGradeScale("test-invalid"); csb.ErrorCode(err) != csb.ENOTFOUND {
+		t.Fatalf("expected invalid scales to be left out, got: %v", err)
+	}
+}
@@ -2,76 +2,332 @@ package inmem
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"sort"
 	"sync"
-	"sync/atomic"
+	"time"
 
 	csb "github.com/Lambels/CSB-Open-API"
 )
 
+var (
+	_ csb.WorkQueue         = (*WorkQueue)(nil)
+	_ csb.DeadLetterService = (*WorkQueue)(nil)
+)
+
 // defaultBufSize represents the default buffer used as a queue to accumulate transactions.
 //
 // limited since most of the times the work queue will be used to process large requests
 // for engage, and we dont want to spam engage.
 const defaultBufSize int = 50
 
+// defaultWorkers is the default amount of transactions ran at once.
+const defaultWorkers int = 1
+
+// errClosed is the error of the transactions cancelled by closing the work queue.
+var errClosed = errors.New("work queue closed")
+
+// Clock tells the time to the work queue, swapped in tests to move the time by hand.
+type Clock interface {
+	// Now returns the current time.
+	Now() time.Time
+	// After returns a channel which recieves the time once d passed.
+	After(d time.Duration) <-chan time.Time
+}
+
+// realClock is the clock of the system.
+type realClock struct{}
+
+func (realClock) Now() time.Time                         { return time.Now() }
+func (realClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+
+// Option configures a work queue.
+type Option func(*WorkQueue)
+
+// WithWorkers sets the amount of workers, ie: the amount of transactions ran at once. Defaults
+// to 1.
+func WithWorkers(n int) Option {
+	return func(w *WorkQueue) {
+		if n > 0 {
+			w.workers = n
+		}
+	}
+}
+
+// WithCapacity sets the amount of transactions which can wait on the queue. Defaults to 50.
+func WithCapacity(n int) Option {
+	return func(w *WorkQueue) {
+		if n > 0 {
+			w.capacity = n
+		}
+	}
+}
+
+// WithKeyLimit limits the amount of transactions with the same key ran at once, transactions
+// without a key arent limited. No limit by default.
+func WithKeyLimit(n int) Option {
+	return func(w *WorkQueue) {
+		if n > 0 {
+			w.keyLimit = n
+		}
+	}
+}
+
+// WithClock sets the clock used to schedule transactions and retries. Defaults to the system
+// clock.
+func WithClock(clock Clock) Option {
+	return func(w *WorkQueue) {
+		if clock != nil {
+			w.clock = clock
+		}
+	}
+}
+
 // WorkQueue represents an in memory implementation of a work queue.
 //
-// Note that this work queue implementation runs transactions synchronously using only
-// one worker.
+// Transactions are ran by a pool of workers, highest priority first and in the order they
+// are published for the same priority. A transaction whose key is at its limit is skipped
+// until a transaction with the same key finishes. Transactions with a NotBefore time in the
+// future are scheduled and only get queued once the time comes.
+//
+// Failed transactions are retried following their retry policy, scheduled after the backoff of
+// the failed attempt. Transactions with a retry policy (MaxAttempts above 1) failing on their
+// last attempt or with an error which isnt retried are kept as dead letters until re-queued or
+// deleted, the work queue implements csb.DeadLetterService. Cancelled transactions and
+// transactions without a retry policy arent kept.
 type WorkQueue struct {
 	idCount int64
 
-	done  chan struct{}
-	queue chan *csb.Transaction
+	workers  int
+	capacity int
+	keyLimit int
 
-	// handler handels the message synchronously.
+	// handler handels the message, it is called concurrently by the workers.
 	handler func(*csb.Transaction) error
 
-	statesMu sync.RWMutex
-	states   map[int64]*state
+	clock Clock
+
+	// mu guards all the fields below, cond is signaled when a transaction is queued, when a
+	// key frees up and when the work queue is closed.
+	mu        sync.Mutex
+	cond      *sync.Cond
+	queue     []*state
+	scheduled []*state
+	// stopTimer stops the timer queueing the next scheduled transaction.
+	stopTimer chan struct{}
+	running   map[string]int
+	states    map[int64]*state
+	closed    bool
+
+	deadLetters map[int64]*csb.DeadLetter
 
-	once sync.Once // used to close done only once.
+	wg sync.WaitGroup
 }
 
 // NewWorkQueue creates a new in memory work queue.
-func NewWorkQueue(handler func(*csb.Transaction) error) *WorkQueue {
+func NewWorkQueue(handler func(*csb.Transaction) error, opts ...Option) *WorkQueue {
 	w := &WorkQueue{
-		done:    make(chan struct{}),
-		queue:   make(chan *csb.Transaction, defaultBufSize),
-		handler: handler,
-		states:  make(map[int64]*state),
+		workers:  defaultWorkers,
+		capacity: defaultBufSize,
+		handler:  handler,
+		clock:    realClock{},
+		running:  make(map[string]int),
+		states:   make(map[int64]*state),
+
+		deadLetters: make(map[int64]*csb.DeadLetter),
+	}
+	w.cond = sync.NewCond(&w.mu)
+	for _, opt := range opts {
+		opt(w)
 	}
 
-	go w.listen()
+	w.wg.Add(w.workers)
+	for i := 0; i < w.workers; i++ {
+		go w.work()
+	}
 
 	return w
 }
 
-// listen pulls transactions of the work queue and hands them in to the handler.
-func (w *WorkQueue) listen() {
+// work pulls transactions of the work queue and hands them in to the handler until the work
+// queue is closed.
+func (w *WorkQueue) work() {
+	defer w.wg.Done()
+
 	for {
-		select {
-		case <-w.done:
+		s, ok := w.next()
+		if !ok {
 			return
-		case val := <-w.queue:
+		}
+
+		err := w.handler(s.transaction)
+
+		w.mu.Lock()
+		if key := s.transaction.Key; key != "" {
+			if w.running[key]--; w.running[key] == 0 {
+				delete(w.running, key)
+			}
+			// a transaction waiting on the key may run now.
+			w.cond.Broadcast()
+		}
+		w.done(s, err)
+		w.mu.Unlock()
+	}
+}
+
+// next blocks until a transaction can run and marks it as processing, it reports false once
+// the work queue is closed.
+func (w *WorkQueue) next() (*state, bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	for {
+		if w.closed {
+			return nil, false
+		}
+
+		if s := w.pick(); s != nil {
+			w.remove(s)
+			if key := s.transaction.Key; key != "" {
+				w.running[key]++
+			}
+			s.attempt++
+			s.setStatus(csb.Status{State: csb.Processing, Attempt: s.attempt})
+			return s, true
+		}
+
+		w.cond.Wait()
+	}
+}
+
+// pick returns the queued transaction to run next, nil if none can run. w.mu must be held.
+func (w *WorkQueue) pick() *state {
+	var next *state
+	for _, s := range w.queue {
+		key := s.transaction.Key
+		if key != "" && w.keyLimit > 0 && w.running[key] >= w.keyLimit {
+			continue
+		}
+		// the queue is in publish order, only a higher priority takes over.
+		if next == nil || s.transaction.Priority > next.transaction.Priority {
+			next = s
+		}
+	}
+	return next
+}
+
+// done handels the result of a run of the transaction: it either retries the transaction,
+// finishes it or finishes it and keeps it as a dead letter. w.mu must be held.
+func (w *WorkQueue) done(s *state, err error) {
+	policy := s.transaction.Retry
+	// a cancelled transaction or closed work queue isnt retried nor kept.
+	if err == nil || s.transaction.Ctx.Err() != nil || w.closed {
+		w.finish(s, csb.Status{State: csb.Done, Error: err, Attempt: s.attempt})
+		return
+	}
+
+	if policy.Retryable(err) && s.attempt < policy.MaxAttempts {
+		s.notBefore = w.clock.Now().Add(policy.Delay(s.attempt))
+		s.setStatus(csb.Status{State: csb.Scheduled, Error: err, NotBefore: s.notBefore, Attempt: s.attempt})
+		w.scheduled = append(w.scheduled, s)
+		w.schedule()
+		return
+	}
+
+	// the callers publishing without a retry policy dont expect dead letters.
+	if policy.MaxAttempts <= 1 {
+		w.finish(s, csb.Status{State: csb.Done, Error: err, Attempt: s.attempt})
+		return
+	}
+
+	transaction := *s.transaction
+	transaction.Ctx = nil
+	w.deadLetters[transaction.Id] = &csb.DeadLetter{
+		Id:          transaction.Id,
+		Transaction: &transaction,
+		Error:       err,
+		Attempts:    s.attempt,
+		CreatedAt:   w.clock.Now(),
+	}
+	w.finish(s, csb.Status{State: csb.Done, Error: err, Attempt: s.attempt})
+}
+
+// schedule queues the scheduled transactions which are due and arms the timer for the next
+// one. w.mu must be held.
+func (w *WorkQueue) schedule() {
+	now := w.clock.Now()
+
+	var earliest time.Time
+	scheduled := make([]*state, 0, len(w.scheduled))
+	for _, s := range w.scheduled {
+		notBefore := s.notBefore
+		if !notBefore.After(now) {
+			w.enqueue(s)
+			continue
+		}
+
+		scheduled = append(scheduled, s)
+		if earliest.IsZero() || notBefore.Before(earliest) {
+			earliest = notBefore
+		}
+	}
+	w.scheduled = scheduled
+
+	if w.stopTimer != nil {
+		close(w.stopTimer)
+		w.stopTimer = nil
+	}
+	if !earliest.IsZero() {
+		stop := make(chan struct{})
+		w.stopTimer = stop
+		after := w.clock.After(earliest.Sub(now))
+
+		go func() {
 			select {
-			case <-val.Ctx.Done():
-				continue
-			default:
+			case <-after:
+			case <-stop:
+				return
 			}
 
-			state := w.states[val.Id]
-			state.newSatus <- csb.Status{State: csb.Processing}
+			w.mu.Lock()
+			defer w.mu.Unlock()
 
-			status := csb.Status{State: csb.Done}
-			if err := w.handler(val); err != nil {
-				status.Error = err
+			// the timer may have been replaced while waiting on the lock.
+			if !w.closed && w.stopTimer == stop {
+				w.schedule()
 			}
+		}()
+	}
+}
+
+// enqueue queues the transaction. w.mu must be held.
+func (w *WorkQueue) enqueue(s *state) {
+	// keep the queue in publish order.
+	i := len(w.queue)
+	for i > 0 && w.queue[i-1].transaction.Id > s.transaction.Id {
+		i--
+	}
+	w.queue = append(w.queue, nil)
+	copy(w.queue[i+1:], w.queue[i:])
+	w.queue[i] = s
+
+	s.setStatus(csb.Status{State: csb.Queued, Attempt: s.attempt})
+	w.cond.Signal()
+}
 
-			state.newSatus <- status
+// remove removes the transaction from the queue or the scheduled transactions, it reports
+// wether the transaction was found. w.mu must be held.
+func (w *WorkQueue) remove(s *state) bool {
+	for _, list := range []*[]*state{&w.queue, &w.scheduled} {
+		for i, other := range *list {
+			if other == s {
+				*list = append((*list)[:i], (*list)[i+1:]...)
+				return true
+			}
 		}
 	}
+	return false
 }
 
 // Publish pushes the transaction on the work queue, if the work queue is full it returns
@@ -79,31 +335,40 @@ func (w *WorkQueue) listen() {
 //
 // If the work queue is closed, the call is no-op.
 func (w *WorkQueue) Publish(transaction *csb.Transaction) error {
-	w.statesMu.Lock()
-	defer w.statesMu.Unlock()
+	w.mu.Lock()
+	defer w.mu.Unlock()
 
-	select {
-	case <-w.done:
+	if w.closed {
 		return nil
-	default:
+	}
+	if len(w.queue)+len(w.scheduled) >= w.capacity {
+		return fmt.Errorf("publish: transaction queue is full")
+	}
+	if transaction.Ctx == nil {
+		transaction.Ctx = context.Background()
 	}
 
 	w.idCount++
 	transaction.Id = w.idCount
 
 	s := &state{
-		currStatus:    csb.Status{State: csb.Queued},
-		subscriptions: make(map[int64]*Subscription),
+		transaction:   transaction,
+		subscriptions: make(map[*Subscription]struct{}),
+		finished:      make(chan struct{}),
+		notBefore:     transaction.NotBefore,
 	}
 	w.states[transaction.Id] = s
-	go s.bind(transaction) // bind the state to the transaction.
+	go w.watch(s)
 
-	select {
-	case w.queue <- transaction:
+	if transaction.NotBefore.After(w.clock.Now()) {
+		s.setStatus(csb.Status{State: csb.Scheduled, NotBefore: transaction.NotBefore})
+		w.scheduled = append(w.scheduled, s)
+		w.schedule()
 		return nil
-	default:
-		return fmt.Errorf("publish: transaction queue is full")
 	}
+
+	w.enqueue(s)
+	return nil
 }
 
 // Subscribe subscribes to the transaction with id = id.
@@ -112,13 +377,15 @@ func (w *WorkQueue) Publish(transaction *csb.Transaction) error {
 //
 // If the transcation doesent exist ENOTFOUND is returned.
 func (w *WorkQueue) Subscribe(ctx context.Context, id int64) (csb.Subscription, error) {
-	w.statesMu.RLock()
-	defer w.statesMu.RUnlock()
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
 
-	select {
-	case <-w.done:
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.closed {
 		return nil, nil
-	default:
 	}
 
 	state, ok := w.states[id]
@@ -126,36 +393,162 @@ func (w *WorkQueue) Subscribe(ctx context.Context, id int64) (csb.Subscription,
 		return nil, csb.Errorf(csb.ENOTFOUND, "subscribe: no transaction was found with id: %v", id)
 	}
 	sub := &Subscription{
+		w:     w,
 		state: state,
 		c:     make(chan csb.Status, 1),
 	}
+	sub.c <- state.currStatus
+	state.subscriptions[sub] = struct{}{}
+
+	return sub, nil
+}
+
+// Close closes the work queue and waits for the running transactions to finish, it is the
+// callers responsability to cancel the context of the running transactions.
+//
+// Queued and scheduled transactions are cancelled.
+func (w *WorkQueue) Close() error {
+	w.mu.Lock()
+	if w.closed {
+		w.mu.Unlock()
+		return nil
+	}
+	w.closed = true
+	w.cond.Broadcast()
 
+	if w.stopTimer != nil {
+		close(w.stopTimer)
+		w.stopTimer = nil
+	}
+	for _, s := range append(w.queue, w.scheduled...) {
+		w.finish(s, csb.Status{State: csb.Cancelled, Error: errClosed, Attempt: s.attempt})
+	}
+	w.queue, w.scheduled = nil, nil
+	w.mu.Unlock()
+
+	w.wg.Wait()
+	return nil
+}
+
+// watch cancels the transaction if its context is cancelled while its queued or scheduled,
+// processing transactions see the cancellation through their context.
+func (w *WorkQueue) watch(s *state) {
 	select {
-	case state.newSub <- sub:
-		return sub, nil
-	case <-ctx.Done():
-		return nil, ctx.Err()
+	case <-s.transaction.Ctx.Done():
+	case <-s.finished:
+		return
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.remove(s) {
+		w.finish(s, csb.Status{State: csb.Cancelled, Error: s.transaction.Ctx.Err(), Attempt: s.attempt})
 	}
 }
 
-// Close closes the work queue, it is the callers responsability to cancel the context
-// of the current transaction.
-func (w *WorkQueue) Close() error {
-	w.statesMu.Lock()
-	defer w.statesMu.Unlock()
+// FindDeadLetterByID returns the dead letter of the transaction with id = id.
+//
+// returns ENOTFOUND if the dead letter doesent exist.
+func (w *WorkQueue) FindDeadLetterByID(ctx context.Context, id int64) (*csb.DeadLetter, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	deadLetter, ok := w.deadLetters[id]
+	if !ok {
+		return nil, csb.Errorf(csb.ENOTFOUND, "dead letter: no dead letter was found with id: %v", id)
+	}
+	return deadLetter, nil
+}
+
+// FindDeadLetters finds the dead letters with the appropiate filter, oldest first.
+func (w *WorkQueue) FindDeadLetters(ctx context.Context, filter csb.DeadLetterFilter) ([]*csb.DeadLetter, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	deadLetters := make([]*csb.DeadLetter, 0, len(w.deadLetters))
+	for _, deadLetter := range w.deadLetters {
+		if filter.Key != nil && deadLetter.Transaction.Key != *filter.Key {
+			continue
+		}
+		deadLetters = append(deadLetters, deadLetter)
+	}
+	// ids are given out in publish order.
+	sort.Slice(deadLetters, func(i, j int) bool {
+		return deadLetters[i].Id < deadLetters[j].Id
+	})
+
+	if filter.Limit > 0 && len(deadLetters) > filter.Limit {
+		deadLetters = deadLetters[:filter.Limit]
+	}
+	return deadLetters, nil
+}
+
+// RequeueDeadLetter publishes the transaction of the dead letter again and removes the dead
+// letter, the published transaction gets a new id.
+//
+// returns ENOTFOUND if the dead letter doesent exist.
+func (w *WorkQueue) RequeueDeadLetter(ctx context.Context, id int64) (*csb.Transaction, error) {
+	w.mu.Lock()
+	deadLetter, ok := w.deadLetters[id]
+	if !ok {
+		w.mu.Unlock()
+		return nil, csb.Errorf(csb.ENOTFOUND, "dead letter: no dead letter was found with id: %v", id)
+	}
+	// remove the dead letter before publishing so it cant be re-queued twice.
+	delete(w.deadLetters, id)
+	w.mu.Unlock()
+
+	transaction := &csb.Transaction{
+		Data:     deadLetter.Transaction.Data,
+		Priority: deadLetter.Transaction.Priority,
+		Retry:    deadLetter.Transaction.Retry,
+		Key:      deadLetter.Transaction.Key,
+	}
+	err := w.Publish(transaction)
+	if err == nil && transaction.Id == 0 {
+		err = errClosed
+	}
+	if err != nil {
+		w.mu.Lock()
+		w.deadLetters[id] = deadLetter
+		w.mu.Unlock()
+		return nil, err
+	}
+
+	return transaction, nil
+}
+
+// DeleteDeadLetter removes the dead letter without re-queueing it.
+//
+// returns ENOTFOUND if the dead letter doesent exist.
+func (w *WorkQueue) DeleteDeadLetter(ctx context.Context, id int64) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
 
-	w.once.Do(func() { close(w.done) })
+	if _, ok := w.deadLetters[id]; !ok {
+		return csb.Errorf(csb.ENOTFOUND, "dead letter: no dead letter was found with id: %v", id)
+	}
+	delete(w.deadLetters, id)
 	return nil
 }
 
-// Subscription represents
+// finish broadcasts the final status of the transaction and forgets it. w.mu must be held.
+func (w *WorkQueue) finish(s *state, status csb.Status) {
+	s.setStatus(status)
+	s.closeSubscriptions()
+	close(s.finished)
+	delete(w.states, s.transaction.Id)
+}
+
+// Subscription represents a subscription to a transaction of the in memory work queue.
 type Subscription struct {
-	Id    int64
-	state *state // parent state.
+	w     *WorkQueue // parent work queue.
+	state *state     // parent state.
 	c     chan csb.Status
 
-	// used to synchronise calls from the client with calls from the parent state.
-	closed atomic.Bool
+	// closed is guarded by the work queue mutex.
+	closed bool
 }
 
 // C returns a stream of status updates, the channel always has a status update
@@ -168,96 +561,58 @@ func (s *Subscription) C() <-chan csb.Status {
 
 // Close closes the subscription.
 func (s *Subscription) Close() error {
-	if s.closed.CompareAndSwap(false, true) {
-		s.state.delSub <- s
+	s.w.mu.Lock()
+	defer s.w.mu.Unlock()
+
+	if !s.closed {
+		s.closed = true
+		delete(s.state.subscriptions, s)
 		close(s.c)
 	}
-
 	return nil
 }
 
-// state ties a transaction to subscription, it constantly communicates with the transaction
-// the current status and forwards the status to the subscriptions.
+// state ties a transaction to its subscriptions, it holds the current status of the
+// transaction and forwards the new statuses to the subscriptions.
 //
-// It is responsible for handling new and perishing subscriptions as well as closing them
-// when the transaction is complete or the context is cancelled.
+// The state is guarded by the work queue mutex.
 type state struct {
-	idCount int64
+	// transaction is the transaction to which the state is binded to.
+	transaction *csb.Transaction
 
-	// currStatus indicates the current status of the subscription.
+	// currStatus indicates the current status of the transaction.
 	//
 	// It is sent to new subscription by default.
 	currStatus    csb.Status
-	subscriptions map[int64]*Subscription
+	subscriptions map[*Subscription]struct{}
 
-	// transaction is the transaction to which the state is binded to.
-	transaction *csb.Transaction
-	w           *WorkQueue // parent work queue.
+	// finished is closed once the transaction is done or cancelled.
+	finished chan struct{}
 
-	newSub   chan *Subscription
-	delSub   chan *Subscription
-	newSatus chan csb.Status // used to push new statuses.
+	// attempt is the number of the current or last run.
+	attempt int
+	// notBefore is the time the transaction gets queued at while its scheduled.
+	notBefore time.Time
 }
 
-// bind binds the state to the transaction and handels all status updates.
-func (s *state) bind(transaction *csb.Transaction) {
-	s.transaction = transaction
-	defer func() {
-		s.w.statesMu.Lock()
-		defer s.w.statesMu.Unlock()
-
-		s.closeSubscriptions()
-		delete(s.w.states, s.transaction.Id)
-	}()
-
-	for {
+// setStatus sets the current status and broadcasts it to all the subscribers, a subscriber
+// which didnt read the previous status only gets the latest one.
+func (s *state) setStatus(status csb.Status) {
+	s.currStatus = status
+	for sub := range s.subscriptions {
 		select {
-		case <-transaction.Ctx.Done(): // transaction cancelled.
-			// if we are currently in the processing state skip this case
-			// since there will be a new status shortly detailing any error from the context
-			// passed from the handler.
-			if s.currStatus.State == csb.Processing {
-				continue
-			}
-
-			s.currStatus = csb.Status{State: csb.Cancelled, Error: transaction.Ctx.Err()}
-			s.broadcast()
-			return
-		case status := <-s.newSatus: // new status.
-			s.currStatus = status
-			s.broadcast()
-
-			if status.State == csb.Done {
-				return
-			}
-		case sub := <-s.newSub: // new subscriber.
-			s.idCount++
-			sub.Id = s.idCount
-			s.subscriptions[sub.Id] = sub
-
-			sub.c <- s.currStatus // c has buffer of 1, no point to handle blocking.
-		case sub := <-s.delSub: // remove subscriber.
-			delete(s.subscriptions, sub.Id)
-		}
-	}
-}
-
-// broadcast broadcasts the current status to all the subscribers.
-func (s *state) broadcast() {
-	for _, v := range s.subscriptions {
-		select {
-		case <-s.transaction.Ctx.Done():
-			return
-		case v.c <- s.currStatus:
+		case <-sub.c:
+		default:
 		}
+		sub.c <- status
 	}
 }
 
 // closeSubscriptions closes all subscribers, no-op if they are already closed.
 func (s *state) closeSubscriptions() {
-	for _, v := range s.subscriptions {
-		if v.closed.CompareAndSwap(false, true) {
-			close(v.c)
-		}
+	for sub := range s.subscriptions {
+		sub.closed = true
+		close(sub.c)
 	}
+	s.subscriptions = make(map[*Subscription]struct{})
 }
@@ -0,0 +1,550 @@
+package inmem_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	csb "github.com/Lambels/CSB-Open-API"
+	"github.com/Lambels/CSB-Open-API/inmem"
+)
+
+// timeout bounds every wait of the tests.
+const timeout = 5 * time.Second
+
+// gate blocks the handler until released and keeps track of the transactions it runs.
+type gate struct {
+	release chan struct{}
+	started chan *csb.Transaction
+
+	mu      sync.Mutex
+	running map[string]int
+	// max is the most transactions seen running at once, by key.
+	max map[string]int
+}
+
+func newGate() *gate {
+	return &gate{
+		release: make(chan struct{}),
+		started: make(chan *csb.Transaction, 100),
+		running: make(map[string]int),
+		max:     make(map[string]int),
+	}
+}
+
+func (g *gate) handle(transaction *csb.Transaction) error {
+	g.mu.Lock()
+	g.running[transaction.Key]++
+	if g.running[transaction.Key] > g.max[transaction.Key] {
+		g.max[transaction.Key] = g.running[transaction.Key]
+	}
+	g.mu.Unlock()
+
+	g.started <- transaction
+	<-g.release
+
+	g.mu.Lock()
+	g.running[transaction.Key]--
+	g.mu.Unlock()
+	return nil
+}
+
+// wait waits for n transactions to start.
+func (g *gate) wait(t *testing.T, n int) []*csb.Transaction {
+	t.Helper()
+
+	out := make([]*csb.Transaction, 0, n)
+	for i := 0; i < n; i++ {
+		select {
+		case transaction := <-g.started:
+			out = append(out, transaction)
+		case <-time.After(timeout):
+			t.Fatalf("expected %v transactions to start, got: %v", n, len(out))
+		}
+	}
+	return out
+}
+
+// idle checks that no other transaction starts for a short while.
+func (g *gate) idle(t *testing.T) {
+	t.Helper()
+
+	select {
+	case transaction := <-g.started:
+		t.Fatalf("unexpected transaction started: %v", transaction.Id)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func (g *gate) maxRunning(key string) int {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.max[key]
+}
+
+func TestWorkQueue_Workers(t *testing.T) {
+	g := newGate()
+	w := inmem.NewWorkQueue(g.handle, inmem.WithWorkers(3))
+	defer w.Close()
+
+	for i := 0; i < 5; i++ {
+		if err := w.Publish(&csb.Transaction{Data: i}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// only as many transactions as workers run at once.
+	g.wait(t, 3)
+	g.idle(t)
+
+	close(g.release)
+	g.wait(t, 2)
+	if n := g.maxRunning(""); n != 3 {
+		t.Fatalf("expected 3 transactions running at once, got: %v", n)
+	}
+}
+
+func TestWorkQueue_KeyLimit(t *testing.T) {
+	g := newGate()
+	w := inmem.NewWorkQueue(g.handle, inmem.WithWorkers(3), inmem.WithKeyLimit(1))
+	defer w.Close()
+
+	for _, key := range []string{"a", "a", "b", "a"} {
+		if err := w.Publish(&csb.Transaction{Key: key}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// the second transaction of a waits on the first one, b takes over its worker.
+	started := g.wait(t, 2)
+	if started[0].Key == started[1].Key {
+		t.Fatalf("expected different keys to run, got: %v and %v", started[0].Key, started[1].Key)
+	}
+	g.idle(t)
+
+	close(g.release)
+	g.wait(t, 2)
+	if n := g.maxRunning("a"); n != 1 {
+		t.Fatalf("expected 1 transaction of a running at once, got: %v", n)
+	}
+}
+
+func TestWorkQueue_Capacity(t *testing.T) {
+	g := newGate()
+	w := inmem.NewWorkQueue(g.handle, inmem.WithCapacity(2))
+	defer w.Close()
+	defer close(g.release)
+
+	// the running transaction doesent take up the queue.
+	if err := w.Publish(&csb.Transaction{}); err != nil {
+		t.Fatal(err)
+	}
+	g.wait(t, 1)
+
+	for i := 0; i < 2; i++ {
+		if err := w.Publish(&csb.Transaction{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Publish(&csb.Transaction{}); err == nil {
+		t.Fatal("expected error publishing on a full queue")
+	}
+
+	// scheduled transactions count towards the capacity.
+	if err := w.Publish(&csb.Transaction{NotBefore: time.Now().Add(time.Hour)}); err == nil {
+		t.Fatal("expected error scheduling on a full queue")
+	}
+}
+
+func TestWorkQueue_Subscribe(t *testing.T) {
+	g := newGate()
+	w := inmem.NewWorkQueue(g.handle)
+	defer w.Close()
+
+	// the first transaction keeps the worker busy so the second one stays queued.
+	if err := w.Publish(&csb.Transaction{}); err != nil {
+		t.Fatal(err)
+	}
+	g.wait(t, 1)
+
+	transaction := &csb.Transaction{}
+	if err := w.Publish(transaction); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	subs := make([]csb.Subscription, 2)
+	for i := range subs {
+		sub, err := w.Subscribe(ctx, transaction.Id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		subs[i] = sub
+	}
+
+	expectState(t, subs, csb.Queued)
+	g.release <- struct{}{}
+
+	g.wait(t, 1)
+	expectState(t, subs, csb.Processing)
+	g.release <- struct{}{}
+
+	expectState(t, subs, csb.Done)
+	for _, sub := range subs {
+		select {
+		case status, ok := <-sub.C():
+			if ok {
+				t.Fatalf("expected subscription to be closed, got: %+v", status)
+			}
+		case <-time.After(timeout):
+			t.Fatal("expected subscription to be closed")
+		}
+	}
+
+	if _, err := w.Subscribe(ctx, transaction.Id); csb.ErrorCode(err) != csb.ENOTFOUND {
+		t.Fatalf("expected ENOTFOUND for a finished transaction, got: %v", err)
+	}
+}
+
+// expectState reads the next status of every subscription and checks its state.
+func expectState(t *testing.T, subs []csb.Subscription, state int) csb.Status {
+	t.Helper()
+
+	var status csb.Status
+	for _, sub := range subs {
+		select {
+		case s, ok := <-sub.C():
+			if !ok {
+				t.Fatalf("expected state %v, got closed subscription", state)
+			} else if s.State != state {
+				t.Fatalf("expected state %v, got: %+v", state, s)
+			}
+			status = s
+		case <-time.After(timeout):
+			t.Fatalf("expected state %v, got nothing", state)
+		}
+	}
+	return status
+}
+
+// fakeClock is a clock moved by hand.
+type fakeClock struct {
+	mu      sync.Mutex
+	now     time.Time
+	waiters []waiter
+}
+
+type waiter struct {
+	at time.Time
+	c  chan time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) After(d time.Duration) <-chan time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	w := waiter{at: c.now.Add(d), c: make(chan time.Time, 1)}
+	if d <= 0 {
+		w.c <- c.now
+		return w.c
+	}
+	c.waiters = append(c.waiters, w)
+	return w.c
+}
+
+// Advance moves the clock by d and fires the waiters which are due.
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.now = c.now.Add(d)
+	waiters := c.waiters[:0]
+	for _, w := range c.waiters {
+		if w.at.After(c.now) {
+			waiters = append(waiters, w)
+			continue
+		}
+		w.c <- c.now
+	}
+	c.waiters = waiters
+}
+
+// failing is a handler failing with err until err is set to nil.
+type failing struct {
+	mu       sync.Mutex
+	err      error
+	attempts map[int64]int
+}
+
+func (f *failing) handle(transaction *csb.Transaction) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.attempts[transaction.Id]++
+	return f.err
+}
+
+func (f *failing) set(err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.err = err
+}
+
+// waitState reads the statuses of the subscription until one has the state, the statuses in
+// between may be dropped by the work queue.
+func waitState(t *testing.T, sub csb.Subscription, state int) csb.Status {
+	t.Helper()
+
+	for {
+		select {
+		case status, ok := <-sub.C():
+			if !ok {
+				t.Fatalf("expected state %v, got closed subscription", state)
+			} else if status.State == state {
+				return status
+			}
+		case <-time.After(timeout):
+			t.Fatalf("expected state %v, got nothing", state)
+		}
+	}
+}
+
+func TestWorkQueue_Retry(t *testing.T) {
+	start := time.Date(2022, 5, 2, 10, 0, 0, 0, time.UTC)
+	clock := &fakeClock{now: start}
+	f := &failing{err: errors.New("engage unavailable"), attempts: make(map[int64]int)}
+
+	w := inmem.NewWorkQueue(f.handle, inmem.WithClock(clock))
+	defer w.Close()
+
+	ctx := context.Background()
+	transaction := &csb.Transaction{
+		Data:  "refresh",
+		Key:   "1001",
+		Retry: csb.RetryPolicy{MaxAttempts: 3, Backoff: time.Minute},
+	}
+	if err := w.Publish(transaction); err != nil {
+		t.Fatal(err)
+	}
+	sub, err := w.Subscribe(ctx, transaction.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sub.Close()
+
+	// the retries are scheduled after the backoff, doubled on every retry.
+	status := waitState(t, sub, csb.Scheduled)
+	if status.Attempt != 1 || status.Error == nil || !status.NotBefore.Equal(start.Add(time.Minute)) {
+		t.Fatalf("expected first retry scheduled at %v, got: %+v", start.Add(time.Minute), status)
+	}
+	clock.Advance(time.Minute)
+
+	status = waitState(t, sub, csb.Scheduled)
+	if status.Attempt != 2 || !status.NotBefore.Equal(start.Add(3*time.Minute)) {
+		t.Fatalf("expected second retry scheduled at %v, got: %+v", start.Add(3*time.Minute), status)
+	}
+	if _, err := w.FindDeadLetterByID(ctx, transaction.Id); csb.ErrorCode(err) != csb.ENOTFOUND {
+		t.Fatalf("expected no dead letter while retrying, got: %v", err)
+	}
+	clock.Advance(2 * time.Minute)
+
+	status = waitState(t, sub, csb.Done)
+	if status.Attempt != 3 || status.Error == nil {
+		t.Fatalf("expected last attempt to fail, got: %+v", status)
+	}
+	f.mu.Lock()
+	if n := f.attempts[transaction.Id]; n != 3 {
+		t.Fatalf("expected 3 runs, got: %v", n)
+	}
+	f.mu.Unlock()
+
+	deadLetter, err := w.FindDeadLetterByID(ctx, transaction.Id)
+	if err != nil {
+		t.Fatal(err)
+	} else if deadLetter.Attempts != 3 || deadLetter.Error == nil || !deadLetter.CreatedAt.Equal(start.Add(3*time.Minute)) {
+		t.Fatalf("expected dead letter after 3 attempts, got: %+v", deadLetter)
+	} else if deadLetter.Transaction.Key != "1001" || deadLetter.Transaction.Ctx != nil {
+		t.Fatalf("expected dead letter transaction without context, got: %+v", deadLetter.Transaction)
+	}
+
+	key := "1001"
+	if deadLetters, err := w.FindDeadLetters(ctx, csb.DeadLetterFilter{Key: &key}); err != nil {
+		t.Fatal(err)
+	} else if len(deadLetters) != 1 {
+		t.Fatalf("expected 1 dead letter, got: %v", len(deadLetters))
+	}
+
+	// the re-queued transaction gets a fresh set of attempts.
+	f.set(nil)
+	requeued, err := w.RequeueDeadLetter(ctx, transaction.Id)
+	if err != nil {
+		t.Fatal(err)
+	} else if requeued.Id == transaction.Id || requeued.Key != "1001" || requeued.Retry.MaxAttempts != 3 {
+		t.Fatalf("expected a new transaction with the same key and policy, got: %+v", requeued)
+	}
+
+	sub, err = w.Subscribe(ctx, requeued.Id)
+	if csb.ErrorCode(err) == csb.ENOTFOUND {
+		// the transaction already finished.
+	} else if err != nil {
+		t.Fatal(err)
+	} else {
+		defer sub.Close()
+		if status := waitState(t, sub, csb.Done); status.Attempt != 1 || status.Error != nil {
+			t.Fatalf("expected re-queued transaction to succeed, got: %+v", status)
+		}
+	}
+
+	if _, err := w.FindDeadLetterByID(ctx, transaction.Id); csb.ErrorCode(err) != csb.ENOTFOUND {
+		t.Fatalf("expected dead letter to be removed, got: %v", err)
+	}
+	if _, err := w.RequeueDeadLetter(ctx, transaction.Id); csb.ErrorCode(err) != csb.ENOTFOUND {
+		t.Fatalf("expected ENOTFOUND re-queueing twice, got: %v", err)
+	}
+}
+
+func TestWorkQueue_DeadLetters(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2022, 5, 2, 10, 0, 0, 0, time.UTC)}
+	f := &failing{err: csb.Errorf(csb.EINVALID, "invalid student"), attempts: make(map[int64]int)}
+
+	w := inmem.NewWorkQueue(f.handle, inmem.WithClock(clock))
+	defer w.Close()
+	ctx := context.Background()
+
+	// errors which arent retried are kept after the first attempt.
+	transaction := &csb.Transaction{Retry: csb.RetryPolicy{MaxAttempts: 3}}
+	if err := w.Publish(transaction); err != nil {
+		t.Fatal(err)
+	}
+	sub, err := w.Subscribe(ctx, transaction.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status := waitState(t, sub, csb.Done); status.Attempt != 1 || csb.ErrorCode(status.Error) != csb.EINVALID {
+		t.Fatalf("expected EINVALID on the first attempt, got: %+v", status)
+	}
+	if deadLetter, err := w.FindDeadLetterByID(ctx, transaction.Id); err != nil {
+		t.Fatal(err)
+	} else if deadLetter.Attempts != 1 {
+		t.Fatalf("expected 1 attempt, got: %v", deadLetter.Attempts)
+	}
+
+	// transactions without a retry policy arent kept.
+	once := &csb.Transaction{}
+	if err := w.Publish(once); err != nil {
+		t.Fatal(err)
+	}
+	sub, err = w.Subscribe(ctx, once.Id)
+	if csb.ErrorCode(err) == csb.ENOTFOUND {
+		// the transaction already finished.
+	} else if err != nil {
+		t.Fatal(err)
+	} else if status := waitState(t, sub, csb.Done); status.Attempt != 1 || status.Error == nil {
+		t.Fatalf("expected the only attempt to fail, got: %+v", status)
+	}
+	if _, err := w.FindDeadLetterByID(ctx, once.Id); csb.ErrorCode(err) != csb.ENOTFOUND {
+		t.Fatalf("expected no dead letter without a retry policy, got: %v", err)
+	}
+
+	// cancelled transactions arent kept.
+	cctx, cancel := context.WithCancel(ctx)
+	cancelled := &csb.Transaction{NotBefore: clock.Now().Add(time.Hour), Ctx: cctx}
+	if err := w.Publish(cancelled); err != nil {
+		t.Fatal(err)
+	}
+	sub, err = w.Subscribe(ctx, cancelled.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitState(t, sub, csb.Scheduled)
+	cancel()
+	waitState(t, sub, csb.Cancelled)
+	if _, err := w.FindDeadLetterByID(ctx, cancelled.Id); csb.ErrorCode(err) != csb.ENOTFOUND {
+		t.Fatalf("expected no dead letter for a cancelled transaction, got: %v", err)
+	}
+
+	if err := w.DeleteDeadLetter(ctx, transaction.Id); err != nil {
+		t.Fatal(err)
+	} else if deadLetters, err := w.FindDeadLetters(ctx, csb.DeadLetterFilter{}); err != nil {
+		t.Fatal(err)
+	} else if len(deadLetters) != 0 {
+		t.Fatalf("expected no dead letters, got: %v", len(deadLetters))
+	}
+}
+
+func TestWorkQueue_Priority(t *testing.T) {
+	g := newGate()
+	w := inmem.NewWorkQueue(g.handle, inmem.WithWorkers(1))
+	defer w.Close()
+
+	// the first transaction keeps the worker busy while the others queue up.
+	if err := w.Publish(&csb.Transaction{}); err != nil {
+		t.Fatal(err)
+	}
+	g.wait(t, 1)
+
+	for _, transaction := range []*csb.Transaction{
+		{Data: "low", Priority: 0},
+		{Data: "mid", Priority: 1},
+		{Data: "high", Priority: 2},
+		{Data: "mid again", Priority: 1},
+	} {
+		if err := w.Publish(transaction); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// higher priorities run first, the same priority runs in publish order.
+	for _, want := range []string{"high", "mid", "mid again", "low"} {
+		g.release <- struct{}{}
+		if got := g.wait(t, 1)[0].Data; got != want {
+			t.Fatalf("expected %q to run, got: %v", want, got)
+		}
+	}
+	g.release <- struct{}{}
+}
+
+func TestWorkQueue_NotBefore(t *testing.T) {
+	start := time.Date(2022, 5, 2, 10, 0, 0, 0, time.UTC)
+	clock := &fakeClock{now: start}
+	g := newGate()
+	close(g.release)
+
+	w := inmem.NewWorkQueue(g.handle, inmem.WithClock(clock))
+	defer w.Close()
+
+	transaction := &csb.Transaction{NotBefore: start.Add(time.Hour)}
+	if err := w.Publish(transaction); err != nil {
+		t.Fatal(err)
+	}
+	sub, err := w.Subscribe(context.Background(), transaction.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sub.Close()
+
+	if status := waitState(t, sub, csb.Scheduled); !status.NotBefore.Equal(start.Add(time.Hour)) {
+		t.Fatalf("expected transaction scheduled at %v, got: %+v", start.Add(time.Hour), status)
+	}
+
+	// the transaction stays scheduled until the clock reaches its time.
+	clock.Advance(59 * time.Minute)
+	g.idle(t)
+	select {
+	case status := <-sub.C():
+		t.Fatalf("expected transaction to stay scheduled, got: %+v", status)
+	default:
+	}
+
+	clock.Advance(time.Minute)
+	g.wait(t, 1)
+	waitState(t, sub, csb.Done)
+}
@@ -2,6 +2,8 @@ package csb
 
 import (
 	"context"
+	"fmt"
+	"strings"
 	"time"
 )
 
@@ -17,12 +19,21 @@ type Mark struct {
 	// Subject at which the mark was recieved.
 	SubjectID int     `json:"subject_id"`
 	Subject   Subject `json:"subject"`
-	// Teacher is the name of the teacher teaching the subject when the mark was recieved.
+	// Teacher is the name of the teacher teaching the subject when the mark was recieved, as
+	// spelled by engage.
 	Teacher string `json:"teacher"`
-	// Percentage represents the grade recieved out of 100.
+	// TeacherID links to the normalized teacher.
+	TeacherID int `json:"teacher_id"`
+	// Column is the marksheet column the mark was recieved in.
+	Column Column `json:"column"`
+	// Value is the mark as displayed by engage: "84%", "A*" or "Good".
+	Value string `json:"value"`
+	// Percentage represents the grade recieved out of 100, only set for numeric columns.
 	Percentage int `json:"percentage"`
 	// Exam period on which the mark was recieved.
 	Period Period `json:"period"`
+	// Source of the mark, either: SOURCE_ENGAGE or SOURCE_MANUAL.
+	Source string `json:"source"`
 	// Timestamp.
 	CreatedAt time.Time `json:"created_at"`
 }
@@ -31,8 +42,11 @@ func (m *Mark) Validate() error {
 	if m.StudentID == 0 {
 		return Errorf(EINVALID, "validate: mark missing student id field")
 	}
-	if m.StudentID == 0 {
-		return Errorf(EINVALID, "validate: mark missing subject id field")
+	if m.Subject == "" {
+		return Errorf(EINVALID, "validate: mark missing subject field")
+	}
+	if !m.Subject.Known() {
+		return Errorf(EINVALID, "validate: unknown subject: %v", m.Subject)
 	}
 
 	ok, err := m.Period.Full()
@@ -46,9 +60,79 @@ func (m *Mark) Validate() error {
 	if m.Teacher == "" {
 		return Errorf(EINVALID, "validate: expecting teacher field")
 	}
+	if err := validateSource(m.Source); err != nil {
+		return err
+	}
+
+	if m.Numeric() {
+		if m.Percentage < 0 || m.Percentage > 100 {
+			return Errorf(EINVALID, "validate: percentage out of range: %v", m.Percentage)
+		}
+	} else if m.Value == "" {
+		return Errorf(EINVALID, "validate: expecting value field")
+	}
+	return nil
+}
+
+// Record sources.
+const (
+	// SOURCE_ENGAGE means the record was fetched from engage.
+	SOURCE_ENGAGE = "engage"
+	// SOURCE_MANUAL means the record was written by a user, refreshes from engage dont
+	// overwrite it unless asked to.
+	SOURCE_MANUAL = "manual"
+)
+
+func validateSource(source string) error {
+	if source != SOURCE_ENGAGE && source != SOURCE_MANUAL {
+		return Errorf(EINVALID, "validate: invalid source: %q", source)
+	}
 	return nil
 }
 
+// Numeric reports wether the mark is a percentage, see Column.Numeric.
+func (m *Mark) Numeric() bool {
+	return m.Column.Numeric()
+}
+
+// Marksheet column types.
+const (
+	// COLUMN_PERCENTAGE is a plain mark out of 100.
+	COLUMN_PERCENTAGE = "percentage"
+	// COLUMN_EXAM is an exam mark out of 100, mock exams included.
+	COLUMN_EXAM = "exam"
+	// COLUMN_COURSEWORK is a coursework mark out of 100.
+	COLUMN_COURSEWORK = "coursework"
+	// COLUMN_GRADE is a letter or attainment grade.
+	COLUMN_GRADE = "grade"
+	// COLUMN_EFFORT is an effort grade.
+	COLUMN_EFFORT = "effort"
+	// COLUMN_PREDICTED is a predicted grade.
+	COLUMN_PREDICTED = "predicted"
+	// COLUMN_COMMENT is a written report comment, see Comment.
+	COLUMN_COMMENT = "comment"
+)
+
+// Column represents a column of an engage marksheet.
+type Column struct {
+	// ID of the column in engage.
+	ID string `json:"id"`
+	// Name of the column as displayed by engage.
+	Name string `json:"name"`
+	// Type of the column, one of the COLUMN_* types.
+	Type string `json:"type"`
+}
+
+// Numeric reports wether the values of the column are percentages. Columns without a type are
+// numeric.
+func (c Column) Numeric() bool {
+	switch c.Type {
+	case "", COLUMN_PERCENTAGE, COLUMN_EXAM, COLUMN_COURSEWORK:
+		return true
+	}
+	return false
+}
+
 // MarkService represents a mark service.
 type MarkService interface {
 	// FindMarkByID returns a mark with the id = id.
@@ -73,19 +157,38 @@ type MarkService interface {
 	// If the to period is before the from period, EINVALID is returned.
 	FindMarksByPeriodRange(ctx context.Context, from, to Period, filter MarksFilter) ([]*Mark, error)
 
-	// FindMarks finds the marks with the appropiate filter.
-	FindMarks(ctx context.Context, filter MarksFilter) ([]*Mark, error)
+	// CreateMark creates a manual mark, the mark is linked to its subject and teacher.
+	//
+	// returns ENOTFOUND if the student doesnt exist and ECONFLICT if the student already
+	// has a mark with the same natural key (see Mark.Key).
+	CreateMark(ctx context.Context, mark *Mark) error
+
+	// UpdateMark updates the mark with id = id, the mark becomes manual.
+	//
+	// returns ENOTFOUND if the mark doesnt exist.
+	UpdateMark(ctx context.Context, id int, upd MarkUpdate) (*Mark, error)
+
+	// FindMarks finds the marks with the appropiate filter, a page at a time.
+	//
+	// returns EINVALID if the sort key or the cursor are invalid.
+	FindMarks(ctx context.Context, filter MarksFilter) ([]*Mark, Page, error)
 
 	// DeleteMark permanently deletes the mark with id = id.
 	//
 	// returns ENOTFOUND if the mark doesnt exit.
 	DeleteMark(ctx context.Context, id int) error
 
+	// FindMarkHistory returns the revisions of the mark with id = id, oldest first. The
+	// history of a deleted mark is kept.
+	//
+	// returns ENOTFOUND if the mark never existed.
+	FindMarkHistory(ctx context.Context, id int) ([]*MarkRevision, error)
+
 	// RefreshMarks refreshes the marks for a particular student over the exam period span
-	// provided.
+	// provided and reports the changes applied.
 	//
 	// returns any error in the exchange.
-	RefreshMarks(ctx context.Context, pid int, from, to Period) error
+	RefreshMarks(ctx context.Context, refresh RefreshMarks) (*RefreshReport, error)
 }
 
 // MarksFilter hardly replicates a RenderMarks request body for engage.
@@ -94,8 +197,13 @@ type MarksFilter struct {
 	ID *int `json:"id"`
 	// PID filters on the student id.
 	PID *int `json:"pid"`
-	// Teacher filters on the name of the teacher.
+	// PIDs filters on the student ids and only lets through the marks of the specified
+	// students.
+	PIDs []int `json:"pids"`
+	// Teacher filters on any spelling of the name of the teacher, see NormalizeTeacher.
 	Teacher *string `json:"teacher"`
+	// TeacherID filters on the teacher id.
+	TeacherID *int `json:"teacher_id"`
 	// MinPercentage sets a minimum percentage for the results.
 	MinPercentage *int `json:"min_percentage"`
 	// MaxPercentage sets a maximum percentage for the results.
@@ -107,4 +215,140 @@ type MarksFilter struct {
 	// Subjects filters on the marks subjects and only lets through the marks with the specified
 	// subjects.
 	Subjects []Subject `json:"subjects"`
+	// Grade filters on the grade of the marks on a registered grade scale.
+	Grade *GradeFilter `json:"grade"`
+	// ColumnTypes filters on the type of the marksheet column of the marks.
+	ColumnTypes []string `json:"column_types"`
+	// Source filters on the source of the marks.
+	Source *string `json:"source"`
+
+	// SortBy sorts the marks, either: SORT_PERCENTAGE, SORT_CREATED_AT, SORT_PERIOD or
+	// SORT_NAME (the subject name). Defaults to SORT_PERIOD.
+	SortBy string `json:"sort_by"`
+	// Limit caps the amount of marks returned, 0 for no limit.
+	Limit int `json:"limit"`
+	// Cursor resumes the marks after a previous page, it must be used with the filter of the
+	// previous page.
+	Cursor string `json:"cursor"`
+}
+
+// MarkUpdate represents a set of fields to update on a mark, nil fields are left unchanged.
+type MarkUpdate struct {
+	Teacher *string `json:"teacher"`
+	// Percentage of numeric marks, the value is derived from it unless Value is set too.
+	// Setting it on a non numeric mark is invalid.
+	Percentage *int `json:"percentage"`
+	// Value of the mark, required to update non numeric marks. Setting it on a numeric mark
+	// without Percentage is invalid.
+	Value *string `json:"value"`
+}
+
+// RefreshMarks represents a request to the RefreshMarks service.
+type RefreshMarks struct {
+	// PID is the student whose marks are refreshed.
+	PID int `json:"pid"`
+	// From is the first period refreshed (including).
+	From Period `json:"from"`
+	// To is the last period refreshed (including).
+	To Period `json:"to"`
+	// Reconcile indicates wether stored marks should be reconciled with engage: corrected
+	// marks get updated and marks removed from engage get deleted.
+	//
+	// Without reconcile only new marks are inserted.
+	Reconcile bool `json:"reconcile"`
+	// Overwrite indicates wether a reconcile may update or delete manual marks, the marks
+	// updated become engage marks.
+	Overwrite bool `json:"overwrite"`
+}
+
+// Mark change types.
+const (
+	// CHANGE_INSERT means the mark was new in engage and got inserted.
+	CHANGE_INSERT = "insert"
+	// CHANGE_UPDATE means the mark was corrected in engage and got updated.
+	CHANGE_UPDATE = "update"
+	// CHANGE_DELETE means the mark was removed from engage and got deleted.
+	CHANGE_DELETE = "delete"
+)
+
+// MarkChange represents a change applied to a mark by a refresh.
+type MarkChange struct {
+	// Type of the change, either: CHANGE_INSERT, CHANGE_UPDATE or CHANGE_DELETE.
+	Type string `json:"type"`
+	// Mark is the mark after the change, the deleted mark for deletes.
+	Mark *Mark `json:"mark"`
+	// Prev is the mark before the change, nil for inserts.
+	Prev *Mark `json:"prev,omitempty"`
+}
+
+// RefreshReport reports the changes applied by a refresh.
+type RefreshReport struct {
+	// PID of the student refreshed.
+	PID int `json:"pid"`
+	// Periods holds the periods refreshed.
+	Periods []Period `json:"periods"`
+	// Changes holds every change applied, in the order they were applied.
+	Changes []MarkChange `json:"changes"`
+	// Unresolved holds the marks engage rendered under a subject missing from the subject
+	// catalog, they arent stored. Their subject is the name displayed by engage, refreshing
+	// the subjects resolves them for the next refresh.
+	Unresolved []*Mark `json:"unresolved"`
+}
+
+// Count returns the amount of changes of type typ.
+func (r *RefreshReport) Count(typ string) int {
+	var n int
+	for _, change := range r.Changes {
+		if change.Type == typ {
+			n++
+		}
+	}
+	return n
+}
+
+// Key returns the natural key of the mark: marks of a student are unique per subject, full
+// period and marksheet column, the key stays the same when engage corrects a mark.
+func (m *Mark) Key() string {
+	column := m.Column.ID
+	if column == "" {
+		column = strings.ToLower(m.Column.Name)
+	}
+	return fmt.Sprintf("%v/%v/%v/%v", m.StudentID, m.Subject, m.Period, column)
+}
+
+// Mark revision reasons.
+const (
+	// REASON_REFRESH means the mark was written by a refresh from engage.
+	REASON_REFRESH = "refresh"
+	// REASON_MANUAL means the mark was written by a user.
+	REASON_MANUAL = "manual"
+	// REASON_PURGE means the mark was deleted with its student by a purging refresh.
+	REASON_PURGE = "purge"
+)
+
+// MarkRevision represents a recorded write to a mark.
+type MarkRevision struct {
+	// PK of the revision.
+	ID int `json:"id"`
+	// MarkID is the id of the mark written, the mark may no longer exist.
+	MarkID int `json:"mark_id"`
+	// StudentID is the student of the mark.
+	StudentID int `json:"student_id"`
+	// Type of the write, either: CHANGE_INSERT, CHANGE_UPDATE or CHANGE_DELETE.
+	Type string `json:"type"`
+	// Reason of the write, either: REASON_REFRESH, REASON_MANUAL or REASON_PURGE.
+	Reason string `json:"reason"`
+
+	// PrevPercentage, PrevValue and PrevTeacher hold the mark before the write, nil for
+	// inserts. PrevPercentage is also nil for non numeric marks.
+	PrevPercentage *int    `json:"prev_percentage"`
+	PrevValue      *string `json:"prev_value"`
+	PrevTeacher    *string `json:"prev_teacher"`
+	// Percentage, Value and Teacher hold the mark after the write, nil for deletes.
+	Percentage *int    `json:"percentage"`
+	Value      *string `json:"value"`
+	Teacher    *string `json:"teacher"`
+
+	// Timestamp of the write.
+	CreatedAt time.Time `json:"created_at"`
 }
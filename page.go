@@ -0,0 +1,17 @@
+package csb
+
+// Sort keys accepted by the SortBy filter fields, prefix a key with "-" to sort descending.
+const (
+	SORT_PERCENTAGE = "percentage"
+	SORT_CREATED_AT = "created_at"
+	SORT_PERIOD     = "period"
+	SORT_NAME       = "name"
+)
+
+// Page holds the pagination details of a range of results.
+type Page struct {
+	// NextCursor resumes the results after this page, empty on the last page.
+	NextCursor string `json:"next_cursor"`
+	// Total is the amount of results matching the filter over all pages.
+	Total int `json:"total"`
+}
@@ -1,6 +1,21 @@
 package csb
 
-import "context"
+import (
+	"context"
+	"encoding"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	_ encoding.TextMarshaler   = Period{}
+	_ encoding.TextUnmarshaler = (*Period)(nil)
+	_ flag.Value               = (*Period)(nil)
+)
 
 // Period represents a period of examination, the academic year, term and importance of the exam
 // at which the mark was recieved.
@@ -11,6 +26,28 @@ type Period struct {
 	Importance *string `json:"importance"`
 }
 
+// importanceRanks defines the order of the well known importance levels in a term, lower
+// ranks come first. Importance levels are matched case insensitively.
+var importanceRanks = map[string]int{
+	"assessment":      1,
+	"progress report": 2,
+	"progress":        2,
+	"mock":            3,
+	"exam":            4,
+	"end of term":     5,
+	"end of year":     6,
+}
+
+// ImportanceRanks returns the ranks of the well known importance levels, lower ranks come
+// first in a term.
+func ImportanceRanks() map[string]int {
+	out := make(map[string]int, len(importanceRanks))
+	for importance, rank := range importanceRanks {
+		out[importance] = rank
+	}
+	return out
+}
+
 func (p Period) Full() (bool, error) {
 	if err := p.Validate(); err != nil {
 		return false, err
@@ -34,11 +71,237 @@ func (p Period) Validate() error {
 	}
 
 	if *p.Term > 4 || *p.Term < 1 {
-		return Errorf(EINVALID, "validate: term must be between 1 and 4 inclusive, but got: %v", p.Term)
+		return Errorf(EINVALID, "validate: term must be between 1 and 4 inclusive, but got: %v", *p.Term)
 	}
 	return nil
 }
 
+// Compare compares p and q, it returns -1 if p is before q, 0 if they are the same period and
+// 1 if p is after q.
+//
+// Periods are ordered by academic year, term and importance. A missing term or importance is
+// before any populated one, so a period narrowed to a term is before all the periods in the
+// term. Well known importance levels are ordered by their weight in the term: Assessment,
+// Progress Report, Mock, Exam, End of Term, End of Year. Any other importance level comes
+// after them, in alphabetical order.
+func (p Period) Compare(q Period) int {
+	switch {
+	case p.AcademicYear < q.AcademicYear:
+		return -1
+	case p.AcademicYear > q.AcademicYear:
+		return 1
+	}
+
+	if c := compareTerm(p.Term, q.Term); c != 0 {
+		return c
+	}
+	return compareImportance(p.Importance, q.Importance)
+}
+
+// Before reports wether p is strictly before q.
+func (p Period) Before(q Period) bool {
+	return p.Compare(q) < 0
+}
+
+// Equal reports wether p and q are the same period.
+func (p Period) Equal(q Period) bool {
+	return p.Compare(q) == 0
+}
+
+// Contains reports wether q falls under the populated fields of p: 2022-23/T2 contains
+// 2022-23/T2/Mock.
+func (p Period) Contains(q Period) bool {
+	if p.AcademicYear != q.AcademicYear {
+		return false
+	}
+	if p.Term != nil && (q.Term == nil || *p.Term != *q.Term) {
+		return false
+	}
+	if p.Importance != nil && (q.Importance == nil || !strings.EqualFold(*p.Importance, *q.Importance)) {
+		return false
+	}
+	return true
+}
+
+// String returns the canonical text form of p: 2022-23/T2/Mock. The zero period is
+// represented by an empty string.
+func (p Period) String() string {
+	if p.AcademicYear == 0 {
+		return ""
+	}
+
+	s := fmt.Sprintf("%d-%02d", p.AcademicYear, (p.AcademicYear+1)%100)
+	if p.Term != nil {
+		s += fmt.Sprintf("/T%d", *p.Term)
+		if p.Importance != nil {
+			s += "/" + *p.Importance
+		}
+	}
+	return s
+}
+
+// MarshalText implements encoding.TextMarshaler, it returns the canonical text form of p.
+func (p Period) MarshalText() ([]byte, error) {
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+	return []byte(p.String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler, it parses the canonical text form of a
+// period.
+func (p *Period) UnmarshalText(text []byte) error {
+	period, err := ParsePeriod(string(text))
+	if err != nil {
+		return err
+	}
+	*p = period
+	return nil
+}
+
+// MarshalJSON keeps the json encoding of a period an object, even though it implements
+// encoding.TextMarshaler.
+func (p Period) MarshalJSON() ([]byte, error) {
+	type period Period
+	return json.Marshal(period(p))
+}
+
+// UnmarshalJSON decodes a period from either its json object or its canonical text form.
+func (p *Period) UnmarshalJSON(data []byte) error {
+	if len(data) > 0 && data[0] == '"' {
+		var s string
+		if err := json.Unmarshal(data, &s); err != nil {
+			return err
+		}
+		return p.UnmarshalText([]byte(s))
+	}
+
+	type period Period
+	return json.Unmarshal(data, (*period)(p))
+}
+
+// Set implements flag.Value, it parses the canonical text form of a period.
+func (p *Period) Set(s string) error {
+	return p.UnmarshalText([]byte(s))
+}
+
+// ParsePeriod parses the canonical text form of a period: 2022-23, 2022-23/T2 or
+// 2022-23/T2/Mock. The academic year can also be written in full, 2022-2023, or as the year
+// it starts in, 2022.
+//
+// returns EINVALID if s isnt a valid period.
+func ParsePeriod(s string) (Period, error) {
+	parts := strings.SplitN(strings.TrimSpace(s), "/", 3)
+
+	year, err := parseAcademicYear(parts[0])
+	if err != nil {
+		return Period{}, err
+	}
+	p := Period{AcademicYear: year}
+
+	if len(parts) > 1 {
+		t := strings.TrimPrefix(strings.TrimPrefix(parts[1], "T"), "t")
+		term, err := strconv.Atoi(t)
+		if err != nil {
+			return Period{}, Errorf(EINVALID, "parse period: invalid term: %q", parts[1])
+		}
+		p.Term = &term
+	}
+	if len(parts) > 2 {
+		importance := strings.TrimSpace(parts[2])
+		if importance == "" {
+			return Period{}, Errorf(EINVALID, "parse period: empty importance: %q", s)
+		}
+		p.Importance = &importance
+	}
+
+	if err := p.Validate(); err != nil {
+		return Period{}, err
+	}
+	return p, nil
+}
+
+// parseAcademicYear parses an academic year in the form 2022-23, 2022-2023 or 2022.
+func parseAcademicYear(s string) (int, error) {
+	start, end, ranged := strings.Cut(s, "-")
+
+	year, err := strconv.Atoi(start)
+	if err != nil {
+		return 0, Errorf(EINVALID, "parse period: invalid academic year: %q", s)
+	}
+	if !ranged {
+		return year, nil
+	}
+
+	next, err := strconv.Atoi(end)
+	if err != nil ||
+		(len(end) == 2 && next != (year+1)%100) ||
+		(len(end) == 4 && next != year+1) ||
+		(len(end) != 2 && len(end) != 4) {
+		return 0, Errorf(EINVALID, "parse period: invalid academic year: %q", s)
+	}
+	return year, nil
+}
+
+// AcademicYearOf returns the academic year t falls in, academic years start in september:
+// 2022-10-01 -> 2022 and 2023-03-01 -> 2022.
+func AcademicYearOf(t time.Time) int {
+	if t.Month() < time.September {
+		return t.Year() - 1
+	}
+	return t.Year()
+}
+
+func compareTerm(a, b *int) int {
+	switch {
+	case a == nil && b == nil:
+		return 0
+	case a == nil:
+		return -1
+	case b == nil:
+		return 1
+	case *a < *b:
+		return -1
+	case *a > *b:
+		return 1
+	}
+	return 0
+}
+
+func compareImportance(a, b *string) int {
+	switch {
+	case a == nil && b == nil:
+		return 0
+	case a == nil:
+		return -1
+	case b == nil:
+		return 1
+	}
+
+	x, y := strings.ToLower(*a), strings.ToLower(*b)
+	rx, okx := importanceRanks[x]
+	ry, oky := importanceRanks[y]
+	switch {
+	case okx && oky:
+		return compareInt(rx, ry)
+	case okx:
+		return -1
+	case oky:
+		return 1
+	}
+	return strings.Compare(x, y)
+}
+
+func compareInt(a, b int) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
 // PeriodService represents a period service.
 //
 // PeriodService should usually be implemented over engage since periods are volatile and
@@ -0,0 +1,121 @@
+package csb_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	csb "github.com/Lambels/CSB-Open-API"
+)
+
+func TestPeriod_Compare(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"2022-23", "2022-23", 0},
+		{"2021-22", "2022-23", -1},
+		{"2023-24/T1", "2022-23/T4", 1},
+		{"2022-23", "2022-23/T1", -1},
+		{"2022-23/T2", "2022-23/T2/Assessment", -1},
+		{"2022-23/T2/Mock", "2022-23/T2/mock", 0},
+		{"2022-23/T2/Assessment", "2022-23/T2/Progress Report", -1},
+		{"2022-23/T2/End of Year", "2022-23/T2/Mock", 1},
+		{"2022-23/T2/End of Year", "2022-23/T2/Baseline", -1},
+		{"2022-23/T2/Baseline", "2022-23/T2/Checkpoint", -1},
+		{"2022-23/T1/Baseline", "2022-23/T2/Assessment", -1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.a+" "+tt.b, func(t *testing.T) {
+			a, b := mustParsePeriod(t, tt.a), mustParsePeriod(t, tt.b)
+			if got := a.Compare(b); got != tt.want {
+				t.Fatalf("expected %v, got: %v", tt.want, got)
+			}
+			if got := b.Compare(a); got != -tt.want {
+				t.Fatalf("expected %v reversed, got: %v", -tt.want, got)
+			}
+		})
+	}
+}
+
+func TestParsePeriod(t *testing.T) {
+	tests := []struct {
+		s    string
+		want string // canonical text, empty if s is invalid.
+	}{
+		{s: "2022-23", want: "2022-23"},
+		{s: "2022-2023", want: "2022-23"},
+		{s: "2022", want: "2022-23"},
+		{s: "2099-00", want: "2099-00"},
+		{s: "2022-23/T2", want: "2022-23/T2"},
+		{s: "2022-23/t2", want: "2022-23/T2"},
+		{s: "2022-23/2", want: "2022-23/T2"},
+		{s: " 2022-23/T2/ Mock ", want: "2022-23/T2/Mock"},
+		{s: "2022-23/T2/End of Term", want: "2022-23/T2/End of Term"},
+		{s: ""},
+		{s: "2022-24"},
+		{s: "2022-202"},
+		{s: "2019-20"},
+		{s: "2022-23/T5"},
+		{s: "2022-23/Mock"},
+		{s: "2022-23/T2/"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.s, func(t *testing.T) {
+			p, err := csb.ParsePeriod(tt.s)
+			if tt.want == "" {
+				if csb.ErrorCode(err) != csb.EINVALID {
+					t.Fatalf("expected EINVALID, got: %v, %v", p, err)
+				}
+				return
+			} else if err != nil {
+				t.Fatal(err)
+			}
+
+			// the canonical text round trips.
+			text, err := p.MarshalText()
+			if err != nil {
+				t.Fatal(err)
+			} else if string(text) != tt.want {
+				t.Fatalf("expected %q, got: %q", tt.want, text)
+			}
+			if q := mustParsePeriod(t, string(text)); !q.Equal(p) || q.String() != p.String() {
+				t.Fatalf("expected %v to round trip, got: %v", p, q)
+			}
+		})
+	}
+}
+
+func TestPeriod_JSON(t *testing.T) {
+	p := mustParsePeriod(t, "2022-23/T2/Mock")
+
+	// periods are encoded as objects and decoded from either form.
+	data, err := json.Marshal(p)
+	if err != nil {
+		t.Fatal(err)
+	} else if string(data) != `{"academic_year":2022,"term":2,"importance":"Mock"}` {
+		t.Fatalf("unexpected encoding: %s", data)
+	}
+
+	for _, data := range []string{string(data), `"2022-23/T2/Mock"`} {
+		var q csb.Period
+		if err := json.Unmarshal([]byte(data), &q); err != nil {
+			t.Fatal(err)
+		} else if q.String() != p.String() {
+			t.Fatalf("expected %v, got: %v", p, q)
+		}
+	}
+
+	var q csb.Period
+	if err := json.Unmarshal([]byte(`"2022-23/T9"`), &q); csb.ErrorCode(err) != csb.EINVALID {
+		t.Fatalf("expected EINVALID, got: %v", err)
+	}
+}
+
+func mustParsePeriod(tb testing.TB, s string) csb.Period {
+	tb.Helper()
+	p, err := csb.ParsePeriod(s)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return p
+}
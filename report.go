@@ -0,0 +1,103 @@
+package csb
+
+import "context"
+
+// DefaultBucketSize is the default width of the histogram buckets of a cohort report, in
+// percentage points.
+const DefaultBucketSize = 10
+
+// DefaultPercentiles are the percentiles computed by default in a cohort report.
+var DefaultPercentiles = []int{10, 25, 50, 75, 90}
+
+// CohortFilter represents a request for a cohort report.
+type CohortFilter struct {
+	// CurrentYear selects the students of a year group.
+	CurrentYear *int `json:"current_year"`
+	// PIDs selects a custom set of students, it takes precedence over CurrentYear.
+	PIDs []int `json:"pids"`
+
+	// Subject the marks are compared on.
+	Subject Subject `json:"subject"`
+	// Period filters on the POPULATED fields of the period, students with multiple marks in the
+	// period are compared on their average.
+	Period Period `json:"period"`
+
+	// BucketSize is the width of the histogram buckets, defaults to DefaultBucketSize.
+	BucketSize int `json:"bucket_size"`
+	// Percentiles to compute, defaults to DefaultPercentiles.
+	Percentiles []int `json:"percentiles"`
+
+	// Anonymized leaves out the names and pids of the students so that the report can be
+	// shared with parents.
+	Anonymized bool `json:"anonymized"`
+	// Focus is the pid of a student kept in an anonymized report, usually the child of the
+	// parents the report is shared with.
+	Focus *int `json:"focus"`
+}
+
+// Validate validates the filter.
+func (f *CohortFilter) Validate() error {
+	if f.CurrentYear == nil && len(f.PIDs) == 0 {
+		return Errorf(EINVALID, "validate: cohort needs a year group or students")
+	}
+	if f.Subject == "" {
+		return Errorf(EINVALID, "validate: cohort missing subject field")
+	}
+	if f.BucketSize < 0 || f.BucketSize > 100 {
+		return Errorf(EINVALID, "validate: invalid bucket size: %v", f.BucketSize)
+	}
+	for _, p := range f.Percentiles {
+		if p < 0 || p > 100 {
+			return Errorf(EINVALID, "validate: invalid percentile: %v", p)
+		}
+	}
+	return f.Period.Validate()
+}
+
+// CohortReport represents the distribution of the marks of a cohort at a subject and period.
+type CohortReport struct {
+	Subject Subject `json:"subject"`
+	Period  Period  `json:"period"`
+	// Count is the amount of students with marks.
+	Count int `json:"count"`
+
+	// Buckets holds the histogram of the percentages, ordered from the lowest bucket.
+	Buckets []Bucket `json:"buckets"`
+	// Percentiles holds the requested percentiles of the percentages.
+	Percentiles []Percentile `json:"percentiles"`
+	// Students holds the rank of each student, ordered from the lowest percentage.
+	Students []StudentRank `json:"students"`
+}
+
+// Bucket represents a histogram bucket holding the percentages in [Min, Max].
+type Bucket struct {
+	Min   int `json:"min"`
+	Max   int `json:"max"`
+	Count int `json:"count"`
+}
+
+// Percentile represents the percentage under which Percentile percent of the cohort is.
+type Percentile struct {
+	Percentile int     `json:"percentile"`
+	Value      float64 `json:"value"`
+}
+
+// StudentRank represents the place of a student in a cohort.
+type StudentRank struct {
+	// PID and Name of the student, left out in anonymized reports.
+	PID  *int   `json:"pid,omitempty"`
+	Name string `json:"name,omitempty"`
+	// Percentage of the student, the average if the student has multiple marks.
+	Percentage float64 `json:"percentage"`
+	// Rank is the percentile rank of the student: the percent of the cohort with a lower
+	// percentage.
+	Rank float64 `json:"rank"`
+}
+
+// ReportService represents a service building reports over the marks of multiple students.
+type ReportService interface {
+	// FindCohortReport returns the distribution of the marks of a cohort.
+	//
+	// returns EINVALID if the filter is invalid.
+	FindCohortReport(ctx context.Context, filter CohortFilter) (*CohortReport, error)
+}
@@ -0,0 +1,38 @@
+package csb
+
+import "encoding/json"
+
+// Schedule represents a recurring transaction published to a work queue on a cron schedule,
+// ie: refreshing the marks of all the current students every weekday at 18:00.
+type Schedule struct {
+	// Name of the schedule, unique between schedules.
+	Name string `json:"name"`
+	// Spec is the cron expression of the schedule, ie: "0 18 * * 1-5".
+	//
+	// The standard 5 fields (minute, hour, day of month, month, day of week) are supported
+	// along with the @yearly, @monthly, @weekly, @daily and @hourly descriptors.
+	Spec string `json:"spec"`
+	// Data is the data of the published transactions, handed to the work queue handler as is.
+	Data json.RawMessage `json:"data"`
+	// Priority of the published transactions.
+	Priority int `json:"priority"`
+	// Key of the published transactions, see Transaction.Key.
+	Key string `json:"key"`
+	// Retry is the retry policy of the published transactions.
+	Retry RetryPolicy `json:"retry"`
+}
+
+// Validate validates the fields of the schedule, the cron expression is validated when the
+// schedule is parsed.
+func (s *Schedule) Validate() error {
+	if s.Name == "" {
+		return Errorf(EINVALID, "schedule: name required")
+	}
+	if s.Spec == "" {
+		return Errorf(EINVALID, "schedule: spec required for schedule: %v", s.Name)
+	}
+	if len(s.Data) > 0 && !json.Valid(s.Data) {
+		return Errorf(EINVALID, "schedule: invalid data for schedule: %v", s.Name)
+	}
+	return nil
+}
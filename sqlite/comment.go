@@ -0,0 +1,301 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	csb "github.com/Lambels/CSB-Open-API"
+	"github.com/Lambels/CSB-Open-API/engage"
+	"github.com/mattn/go-sqlite3"
+)
+
+var _ csb.CommentService = (*CommentService)(nil)
+
+// CommentService wraps around an engage client and period service to store report comments.
+//
+// The comments are searched with sqlite's fts5 extension if go-sqlite3 was built with the
+// sqlite_fts5 tag, else with LIKE on every word of the query.
+type CommentService struct {
+	// db for persistance.
+	db *DB
+	// client for updates.
+	c *engage.Client
+	// periodService is used to handle periods.
+	periodService csb.PeriodService
+}
+
+// NewCommentService creates a new comment service with the provided database, engage client and
+// period service.
+func NewCommentService(db *DB, client *engage.Client, periodService csb.PeriodService) *CommentService {
+	return &CommentService{
+		db:            db,
+		c:             client,
+		periodService: periodService,
+	}
+}
+
+// FindComments returns a range of comments based on the filter.
+//
+// returns EINVALID if the full text search query is malformed.
+func (s *CommentService) FindComments(ctx context.Context, filter csb.CommentFilter) ([]*csb.Comment, error) {
+	tx, err := s.db.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	return findComments(ctx, tx, filter, s.db.fts)
+}
+
+// RefreshComments refreshes the comments of the student from the period range.
+//
+// Comments are matched on their natural key (see csb.Comment.Key), new comments are inserted
+// and comments whose text or teacher changed are updated.
+func (s *CommentService) RefreshComments(ctx context.Context, pid int, from, to csb.Period) (int, error) {
+	periods, err := s.periodService.PeriodRange(ctx, pid, from, to)
+	if err != nil {
+		return 0, err
+	}
+
+	// engage renders the marksheet of a whole academic year at once, fetch each academic year
+	// only once and before starting the transaction to keep it short.
+	var comments []*csb.Comment
+	seen := make(map[int]struct{})
+	for _, period := range periods {
+		if _, ok := seen[period.AcademicYear]; ok {
+			continue
+		}
+		seen[period.AcademicYear] = struct{}{}
+
+		yearComments, err := s.findCommentsEngage(ctx, pid, period.AcademicYear)
+		if err != nil {
+			return 0, err
+		}
+		comments = append(comments, yearComments...)
+	}
+
+	tx, err := s.db.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	if _, err := findStudentByPID(ctx, tx, pid); err != nil {
+		return 0, err
+	}
+
+	var n int
+	now := s.db.Now()
+	for _, comment := range comments {
+		var in bool
+		for _, period := range periods {
+			if period.Contains(comment.Period) {
+				in = true
+				break
+			}
+		}
+		// comments of subjects missing from the catalog arent stored, same as marks.
+		if !in || !comment.Subject.Known() {
+			continue
+		}
+
+		changed, err := upsertComment(ctx, tx, comment, now)
+		if err != nil {
+			return 0, err
+		} else if changed {
+			n++
+		}
+	}
+
+	return n, tx.Commit()
+}
+
+// findCommentsEngage renders the comments of the student in an academic year.
+func (s *CommentService) findCommentsEngage(ctx context.Context, pid int, academicYear int) ([]*csb.Comment, error) {
+	academicYears := []int{academicYear}
+
+	reportingPeriods, err := s.c.GetReportingPeriods(ctx, pid, academicYears)
+	if err != nil {
+		return nil, err
+	}
+
+	subjects, err := s.c.GetReportingSubjects(ctx, pid, academicYears, reportingPeriods)
+	if err != nil {
+		return nil, err
+	}
+
+	columns, err := s.c.GetCommentColumns(ctx, pid, academicYears, reportingPeriods, subjects)
+	if err != nil {
+		return nil, err
+	} else if len(columns) == 0 {
+		return nil, nil
+	}
+
+	return s.c.GetComments(ctx, pid, academicYears, columns, reportingPeriods, subjects)
+}
+
+// findComments returns the comments matching filter, the query is matched against the full
+// text index if fts is set and with LIKE otherwise.
+func findComments(ctx context.Context, tx *sql.Tx, filter csb.CommentFilter, fts bool) ([]*csb.Comment, error) {
+	join, where, args := "", []string{"1 = 1"}, []interface{}{}
+	if v := filter.PID; v != nil {
+		where, args = append(where, "c.student_id = ?"), append(args, *v)
+	}
+	if len(filter.Periods) > 0 {
+		periods := make([]string, 0, len(filter.Periods))
+		for _, period := range filter.Periods {
+			cond, condArgs := periodCondition("c", period)
+			periods, args = append(periods, cond), append(args, condArgs...)
+		}
+		where = append(where, "("+strings.Join(periods, " OR ")+")")
+	}
+	if len(filter.Subjects) > 0 {
+		where = append(where, "s.code IN ("+placeholders(len(filter.Subjects))+")")
+		for _, subject := range filter.Subjects {
+			args = append(args, subject)
+		}
+	}
+
+	order := "c.academic_year ASC, c.term ASC, s.code ASC, c.id ASC"
+	if v := filter.Query; v != nil && fts {
+		join = "INNER JOIN comments_fts ON comments_fts.rowid = c.id"
+		where, args = append(where, "comments_fts MATCH ?"), append(args, *v)
+		order = "comments_fts.rank ASC, c.id ASC"
+	} else if v != nil {
+		// without the full text index the comments holding every word of the query match.
+		for _, word := range strings.Fields(*v) {
+			if word = strings.Trim(word, `"*()`); word != "" {
+				where, args = append(where, `c.text LIKE '%' || ? || '%' ESCAPE '\'`), append(args, likeEscaper.Replace(word))
+			}
+		}
+	}
+
+	rows, err := tx.QueryContext(ctx, `
+		SELECT
+			c.id,
+			c.student_id,
+			s.code,
+			c.teacher,
+			c.academic_year,
+			c.term,
+			c.importance,
+			c.text,
+			c.created_at,
+			c.updated_at
+		FROM comments c
+		INNER JOIN subjects s ON s.id = c.subject_id
+		`+join+`
+		WHERE `+strings.Join(where, " AND ")+`
+		ORDER BY `+order+`
+	`, args...)
+	if err != nil {
+		return nil, queryError(filter, err)
+	}
+	defer rows.Close()
+
+	comments := make([]*csb.Comment, 0)
+	for rows.Next() {
+		var (
+			comment    csb.Comment
+			term       int
+			importance string
+		)
+		if err := rows.Scan(
+			&comment.ID,
+			&comment.StudentID,
+			&comment.Subject,
+			&comment.Teacher,
+			&comment.Period.AcademicYear,
+			&term,
+			&importance,
+			&comment.Text,
+			(*NullTime)(&comment.CreatedAt),
+			(*NullTime)(&comment.UpdatedAt),
+		); err != nil {
+			return nil, err
+		}
+
+		comment.Period.Term, comment.Period.Importance = &term, &importance
+		comments = append(comments, &comment)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, queryError(filter, err)
+	}
+
+	return comments, nil
+}
+
+// likeEscaper escapes the wildcards of a LIKE pattern.
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// queryError reports malformed full text search queries as EINVALID.
+func queryError(filter csb.CommentFilter, err error) error {
+	var sqliteErr sqlite3.Error
+	if filter.Query != nil && errors.As(err, &sqliteErr) && sqliteErr.Code == sqlite3.ErrError {
+		return csb.Errorf(csb.EINVALID, "invalid search query: %q", *filter.Query)
+	}
+	return err
+}
+
+// upsertComment creates the comment or updates its text and teacher if it already exists, it
+// reports wether the comment was added or changed.
+func upsertComment(ctx context.Context, tx *sql.Tx, comment *csb.Comment, now time.Time) (bool, error) {
+	if err := comment.Validate(); err != nil {
+		return false, err
+	}
+
+	subjectID, err := findSubjectID(ctx, tx, comment.Subject)
+	if err != nil {
+		return false, err
+	}
+
+	res, err := tx.ExecContext(ctx, `
+		INSERT INTO comments (
+			student_id,
+			subject_id,
+			teacher,
+			academic_year,
+			term,
+			importance,
+			text,
+			created_at,
+			updated_at
+		)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (student_id, subject_id, academic_year, term, importance) DO UPDATE SET
+			teacher = excluded.teacher,
+			text = excluded.text,
+			updated_at = excluded.updated_at
+		WHERE comments.text != excluded.text OR comments.teacher != excluded.teacher
+	`,
+		comment.StudentID,
+		subjectID,
+		comment.Teacher,
+		comment.Period.AcademicYear,
+		*comment.Period.Term,
+		*comment.Period.Importance,
+		comment.Text,
+		(*NullTime)(&now),
+		(*NullTime)(&now),
+	)
+	if err != nil {
+		return false, err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
+
+func attachStudentComments(ctx context.Context, tx *sql.Tx, student *csb.Student) (err error) {
+	if student.Comments, err = findComments(ctx, tx, csb.CommentFilter{PID: &student.PID}, false); err != nil {
+		return fmt.Errorf("attach student comments: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,13 @@
+//go:build sqlite_fts5
+
+package sqlite_test
+
+import csb "github.com/Lambels/CSB-Open-API"
+
+// searchModeTests are the searches specific to the full text index.
+var searchModeTests = []searchTest{
+	{query: "alg*", want: []csb.Subject{csb.MATHEMATICS}},
+	{query: "revise NOT optics", want: []csb.Subject{csb.BIOLOGY}},
+	{query: `"good effort"`, want: []csb.Subject{csb.BIOLOGY}},
+	{query: `"good`, err: csb.EINVALID},
+}
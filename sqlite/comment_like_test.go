@@ -0,0 +1,14 @@
+//go:build !sqlite_fts5
+
+package sqlite_test
+
+import csb "github.com/Lambels/CSB-Open-API"
+
+// searchModeTests are the searches specific to the LIKE fallback.
+var searchModeTests = []searchTest{
+	{query: "alg", want: []csb.Subject{csb.MATHEMATICS}},
+	{query: `"algebra"`, want: []csb.Subject{csb.MATHEMATICS}},
+	{query: "%", want: []csb.Subject{}},
+	{query: "_ood", want: []csb.Subject{}},
+	{query: `"good`, want: []csb.Subject{csb.BIOLOGY, csb.PHYSICS}},
+}
@@ -0,0 +1,76 @@
+package sqlite_test
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"testing"
+
+	csb "github.com/Lambels/CSB-Open-API"
+	"github.com/Lambels/CSB-Open-API/engage"
+	"github.com/Lambels/CSB-Open-API/sqlite"
+)
+
+// searchTest is a comment search and the subjects of the comments it should find.
+type searchTest struct {
+	query    string
+	subjects []csb.Subject
+	want     []csb.Subject
+	err      string
+}
+
+func TestCommentService_FindComments_Query(t *testing.T) {
+	db := MustOpenDB(t)
+	server, client := MustOpenEngage(t)
+	s := sqlite.NewCommentService(db, client, engage.NewPeriodService(client))
+	ctx := context.Background()
+
+	subjects := []csb.Subject{csb.MATHEMATICS, csb.PHYSICS, csb.BIOLOGY}
+	MustCreateStudent(t, db, &csb.Student{PID: 1001, Subjects: subjects})
+
+	student := fixtureStudent(t, 1001)
+	student.Comments = []*csb.Comment{
+		{Subject: csb.MATHEMATICS, Teacher: "Mr Ionescu", Period: fullPeriod(2022, 1, "Assessment"), Text: "Excellent work on algebra."},
+		{Subject: csb.PHYSICS, Teacher: "Mrs Popa", Period: fullPeriod(2022, 1, "Assessment"), Text: "Good grasp of forces, revise optics."},
+		{Subject: csb.BIOLOGY, Teacher: "Ms Radu", Period: fullPeriod(2021, 2, "Mock"), Text: "Good effort in the lab, revise cells."},
+	}
+	server.SetStudent(student)
+
+	from, to := csb.Period{AcademicYear: 2021}, csb.Period{AcademicYear: 2022}
+	if _, err := s.RefreshComments(ctx, 1001, from, to); err != nil {
+		t.Fatal(err)
+	}
+
+	// the searches behaving the same with and without the full text index.
+	tests := []searchTest{
+		{query: "algebra", want: []csb.Subject{csb.MATHEMATICS}},
+		{query: "GOOD", want: []csb.Subject{csb.BIOLOGY, csb.PHYSICS}},
+		{query: "good revise", want: []csb.Subject{csb.BIOLOGY, csb.PHYSICS}},
+		{query: "good algebra", want: []csb.Subject{}},
+		{query: "revise", subjects: []csb.Subject{csb.BIOLOGY}, want: []csb.Subject{csb.BIOLOGY}},
+		{query: "geometry", want: []csb.Subject{}},
+	}
+	for _, tt := range append(tests, searchModeTests...) {
+		query := tt.query
+		comments, err := s.FindComments(ctx, csb.CommentFilter{Query: &query, Subjects: tt.subjects})
+		if tt.err != "" {
+			if code := csb.ErrorCode(err); code != tt.err {
+				t.Errorf("%q: got error code %q, want %q", tt.query, code, tt.err)
+			}
+			continue
+		} else if err != nil {
+			t.Errorf("%q: %v", tt.query, err)
+			continue
+		}
+
+		got := make([]csb.Subject, 0, len(comments))
+		for _, comment := range comments {
+			got = append(got, comment.Subject)
+		}
+		// the full text search orders by relevance.
+		sort.Slice(got, func(i, j int) bool { return got[i] < got[j] })
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%q: got %v, want %v", tt.query, got, tt.want)
+		}
+	}
+}
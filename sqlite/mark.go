@@ -3,6 +3,9 @@ package sqlite
 import (
 	"context"
 	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
 	"time"
 
 	csb "github.com/Lambels/CSB-Open-API"
@@ -96,12 +99,17 @@ func (s *MarkService) FindMarksByPeriod(ctx context.Context, pid int, period csb
 	if full {
 		marks, err = s.findMarksByPeriodFallback(ctx, tx, pid, period)
 	} else { // if the period isnt full use local data since we are potentially dealing with allot of data.
-		periods, err := s.periodService.BuildPeriods(ctx, pid, period.AcademicYear, *period.Term)
-		if err != nil {
+		var term int
+		if period.Term != nil {
+			term = *period.Term
+		}
+
+		var periods []csb.Period
+		if periods, err = s.periodService.BuildPeriods(ctx, pid, period.AcademicYear, term); err != nil {
 			return nil, err
 		}
 
-		marks, err = findMarks(ctx, tx, csb.MarksFilter{PID: &pid, Periods: periods})
+		marks, _, err = findMarks(ctx, tx, csb.MarksFilter{PID: &pid, Periods: periods})
 	}
 
 	if err != nil {
@@ -143,7 +151,7 @@ func (s *MarkService) FindMarksByPeriodRange(ctx context.Context, from, to csb.P
 		return nil, err
 	}
 
-	marks, err := findMarks(ctx, tx, filter)
+	marks, _, err := findMarks(ctx, tx, filter)
 	if err != nil {
 		return nil, err
 	} else if err := attachMarksAssociationsWithStudent(ctx, tx, *filter.PID, marks); err != nil {
@@ -152,26 +160,107 @@ func (s *MarkService) FindMarksByPeriodRange(ctx context.Context, from, to csb.P
 	return marks, nil
 }
 
-// FindMarks returns a range of marks based on filter.
-func (s *MarkService) FindMarks(ctx context.Context, filter csb.MarksFilter) ([]*csb.Mark, error) {
+// FindMarks returns a page of marks based on filter.
+//
+// The sorting and pagination are done in sql and the students of the page are attached in
+// a single query.
+func (s *MarkService) FindMarks(ctx context.Context, filter csb.MarksFilter) ([]*csb.Mark, csb.Page, error) {
+	tx, err := s.db.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, csb.Page{}, err
+	}
+	defer tx.Rollback()
+
+	marks, page, err := findMarks(ctx, tx, filter)
+	if err != nil {
+		return nil, page, err
+	} else if err := attachMarksAssociations(ctx, tx, marks); err != nil {
+		return nil, page, err
+	}
+
+	return marks, page, nil
+}
+
+// CreateMark creates a manual mark.
+//
+// returns ENOTFOUND if the student isnt found and ECONFLICT if the student already has a mark
+// with the same natural key.
+func (s *MarkService) CreateMark(ctx context.Context, mark *csb.Mark) error {
+	tx, err := s.db.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	mark.Source = csb.SOURCE_MANUAL
+	if err := mark.Validate(); err != nil {
+		return err
+	}
+	if _, err := findStudentByPID(ctx, tx, mark.StudentID); err != nil {
+		return err
+	}
+
+	marks, err := findMarksByPeriod(ctx, tx, mark.StudentID, mark.Period)
+	if err != nil {
+		return err
+	}
+	for _, other := range marks {
+		if other.Key() == mark.Key() {
+			return csb.Errorf(csb.ECONFLICT, "mark already exists: %v", other.ID)
+		}
+	}
+
+	if err := createMark(ctx, tx, mark, csb.REASON_MANUAL, s.db.Now()); err != nil {
+		return err
+	} else if err := attachMarkAssociations(ctx, tx, mark); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// UpdateMark updates a mark with the specified id, the mark becomes manual so that refreshes
+// keep it.
+//
+// returns ENOTFOUND if the mark isnt found.
+func (s *MarkService) UpdateMark(ctx context.Context, id int, upd csb.MarkUpdate) (*csb.Mark, error) {
 	tx, err := s.db.db.BeginTx(ctx, nil)
 	if err != nil {
 		return nil, err
 	}
 	defer tx.Rollback()
 
-	marks, err := findMarks(ctx, tx, filter)
+	mark, err := findMarkByID(ctx, tx, id)
 	if err != nil {
 		return nil, err
 	}
 
-	for _, mark := range marks {
-		if err := attachMarkAssociations(ctx, tx, mark); err != nil {
-			return nil, err
+	if v := upd.Teacher; v != nil {
+		mark.Teacher = *v
+	}
+	if v := upd.Percentage; v != nil {
+		if !mark.Numeric() {
+			return nil, csb.Errorf(csb.EINVALID, "update mark: %v column holds no percentage, update the value instead", mark.Column.Type)
+		}
+		// the value is derived from the new percentage.
+		mark.Percentage, mark.Value = *v, ""
+	}
+	if v := upd.Value; v != nil {
+		// the percentage of a numeric mark would no longer match its value.
+		if mark.Numeric() && upd.Percentage == nil {
+			return nil, csb.Errorf(csb.EINVALID, "update mark: %v column value is derived from the percentage, update the percentage too", mark.Column.Type)
 		}
+		mark.Value = *v
 	}
+	mark.Source = csb.SOURCE_MANUAL
 
-	return marks, nil
+	if err := updateMark(ctx, tx, mark, csb.REASON_MANUAL, s.db.Now()); err != nil {
+		return nil, err
+	} else if err := attachMarkAssociations(ctx, tx, mark); err != nil {
+		return nil, err
+	}
+
+	return mark, tx.Commit()
 }
 
 // DeleteMark permanently deletes a mark with the specified id.
@@ -184,115 +273,703 @@ func (s *MarkService) DeleteMark(ctx context.Context, id int) error {
 	}
 	defer tx.Rollback()
 
-	if err := deleteMark(ctx, tx, id); err != nil {
+	if err := deleteMark(ctx, tx, id, csb.REASON_MANUAL, s.db.Now()); err != nil {
 		return err
 	}
 
 	return tx.Commit()
 }
 
-// RefreshMarks refreshes marks for the student with pid = pid from the period range.
+// RefreshMarks refreshes marks for the student from the period range.
 //
-// It only checks for new marks since it is very uncommon that a mark gets updated or
-// deleted.
-func (s *MarkService) RefreshMarks(ctx context.Context, pid int, from, to csb.Period) error {
-	// asign student manualy since we are again potentially dealing with allot of marks
-	// and dont want to spam engage or the local database.
-	tx, err := s.db.db.BeginTx(ctx, nil)
+// Marks are matched on their natural key (see csb.Mark.Key), new marks are always inserted. In
+// reconcile mode stored marks with a corrected percentage or teacher get updated and stored
+// marks which were removed from engage get deleted. Manual marks are only reconciled if
+// refresh.Overwrite is set.
+func (s *MarkService) RefreshMarks(ctx context.Context, refresh csb.RefreshMarks) (*csb.RefreshReport, error) {
+	periods, err := s.periodService.PeriodRange(ctx, refresh.PID, refresh.From, refresh.To)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	defer tx.Rollback()
 
-	if _, err := findStudentByPID(ctx, tx, pid); err != nil {
-		return err
+	// engage renders the marksheet of a whole academic year at once, fetch each academic year
+	// only once and before starting the transaction to keep it short.
+	marksEngage := make(map[int][]*csb.Mark)
+	for _, period := range periods {
+		if _, ok := marksEngage[period.AcademicYear]; ok {
+			continue
+		}
+
+		marks, err := s.findMarksByPeriodEngage(ctx, refresh.PID, csb.Period{AcademicYear: period.AcademicYear})
+		if err != nil {
+			return nil, err
+		}
+		marksEngage[period.AcademicYear] = marks
 	}
 
-	periods, err := s.periodService.PeriodRange(ctx, pid, from, to)
+	tx, err := s.db.db.BeginTx(ctx, nil)
 	if err != nil {
-		return err
+		return nil, err
 	}
+	defer tx.Rollback()
 
-	for len(periods) > 0 {
-		period := periods[0]
+	if _, err := findStudentByPID(ctx, tx, refresh.PID); err != nil {
+		return nil, err
+	}
 
-		marksLocal, err := findMarksByPeriod(ctx, tx, pid, period)
+	report := &csb.RefreshReport{
+		PID:        refresh.PID,
+		Periods:    periods,
+		Changes:    make([]csb.MarkChange, 0),
+		Unresolved: make([]*csb.Mark, 0),
+	}
+	now := s.db.Now()
+	for _, period := range periods {
+		marksLocal, err := findMarksByPeriod(ctx, tx, refresh.PID, period)
 		if err != nil {
-			return err
+			return nil, err
 		}
 
-		marksEngage, err := s.findMarksByPeriodEngage(ctx, pid, period)
-		if err != nil {
-			return err
+		stored := make(map[string]*csb.Mark, len(marksLocal))
+		for _, mark := range marksLocal {
+			stored[mark.Key()] = mark
 		}
 
-		// marks in the same period can only have different subjects, do a shallow difference
-		// check on only the subjects to save cpu usage.
-		//
-		// also just add new marks, it isnt often that marks get deleted or updated.
-		diff := make(map[string]struct{}, len(marksLocal))
-		for _, markLocal := range marksLocal {
-			diff[markLocal.Subject.Name] = struct{}{}
-		}
+		seen := make(map[string]struct{})
+		for _, mark := range marksEngage[period.AcademicYear] {
+			key := mark.Key()
+			if _, ok := seen[key]; ok || !period.Contains(mark.Period) {
+				continue
+			}
+			seen[key] = struct{}{}
 
-		for _, markEngage := range marksEngage {
-			if _, ok := diff[markEngage.Subject.Name]; !ok {
-				if err := createMark(ctx, tx, markEngage); err != nil {
-					return err
+			if !mark.Subject.Known() {
+				report.Unresolved = append(report.Unresolved, mark)
+				continue
+			}
+
+			prev, ok := stored[key]
+			switch {
+			case !ok:
+				if err := createMark(ctx, tx, mark, csb.REASON_REFRESH, now); err != nil {
+					return nil, err
+				}
+				report.Changes = append(report.Changes, csb.MarkChange{Type: csb.CHANGE_INSERT, Mark: mark})
+
+			case prev.Source == csb.SOURCE_MANUAL && !refresh.Overwrite:
+				// keep the manual mark.
+
+			case refresh.Reconcile && (prev.Percentage != mark.Percentage || prev.Value != mark.Value || csb.NormalizeTeacher(prev.Teacher) != csb.NormalizeTeacher(mark.Teacher)):
+				updated := *prev
+				updated.Percentage, updated.Value, updated.Teacher = mark.Percentage, mark.Value, mark.Teacher
+				updated.Source = mark.Source
+				if err := updateMark(ctx, tx, &updated, csb.REASON_REFRESH, now); err != nil {
+					return nil, err
 				}
+				report.Changes = append(report.Changes, csb.MarkChange{Type: csb.CHANGE_UPDATE, Mark: &updated, Prev: prev})
 			}
 		}
 
-		select {
-		case <-ctx.Done():
-			return ctx.Err()
-		case <-time.After(engage.RequestTimeout):
+		if !refresh.Reconcile {
+			continue
+		}
+		for _, mark := range marksLocal {
+			if _, ok := seen[mark.Key()]; ok {
+				continue
+			}
+			if mark.Source == csb.SOURCE_MANUAL && !refresh.Overwrite {
+				continue
+			}
+
+			if err := deleteMark(ctx, tx, mark.ID, csb.REASON_REFRESH, now); err != nil {
+				return nil, err
+			}
+			report.Changes = append(report.Changes, csb.MarkChange{Type: csb.CHANGE_DELETE, Mark: mark})
 		}
 	}
 
-	return nil
+	return report, tx.Commit()
 }
 
 func findMarkByID(ctx context.Context, tx *sql.Tx, id int) (*csb.Mark, error) {
+	marks, _, err := findMarks(ctx, tx, csb.MarksFilter{ID: &id})
+	if err != nil {
+		return nil, err
+	} else if len(marks) == 0 {
+		return nil, csb.Errorf(csb.ENOTFOUND, "mark not found: %v", id)
+	}
 
+	return marks[0], nil
 }
 
 func findMarksByPID(ctx context.Context, tx *sql.Tx, pid int) ([]*csb.Mark, error) {
-
+	marks, _, err := findMarks(ctx, tx, csb.MarksFilter{PID: &pid})
+	return marks, err
 }
 
+// findMarksByPeriodFallback returns the local marks of the full period. If there are none and
+// the service falls back on engage, the marks are fetched from engage and stored, the student
+// has to be stored already.
 func (s *MarkService) findMarksByPeriodFallback(ctx context.Context, tx *sql.Tx, pid int, period csb.Period) ([]*csb.Mark, error) {
+	marks, err := findMarksByPeriod(ctx, tx, pid, period)
+	if err != nil || len(marks) > 0 || !s.fallback {
+		return marks, err
+	}
+
+	if _, err := findStudentByPID(ctx, tx, pid); err != nil {
+		return nil, err
+	}
+
+	marksEngage, err := s.findMarksByPeriodEngage(ctx, pid, period)
+	if err != nil {
+		return nil, err
+	}
+
+	now := s.db.Now()
+	seen := make(map[string]struct{}, len(marksEngage))
+	for _, mark := range marksEngage {
+		// marks of subjects missing from the catalog arent stored, same as on refresh.
+		if _, ok := seen[mark.Key()]; ok || !mark.Subject.Known() {
+			continue
+		}
+		seen[mark.Key()] = struct{}{}
 
+		if err := createMark(ctx, tx, mark, csb.REASON_REFRESH, now); err != nil {
+			return nil, err
+		}
+		marks = append(marks, mark)
+	}
+
+	return marks, nil
 }
 
 func findMarksByPeriod(ctx context.Context, tx *sql.Tx, pid int, period csb.Period) ([]*csb.Mark, error) {
-
+	marks, _, err := findMarks(ctx, tx, csb.MarksFilter{PID: &pid, Periods: []csb.Period{period}})
+	return marks, err
 }
 
+// findMarksByPeriodEngage renders the marksheet of the academic year of period and returns the
+// marks which fall under period.
 func (s *MarkService) findMarksByPeriodEngage(ctx context.Context, pid int, period csb.Period) ([]*csb.Mark, error) {
+	academicYears := []int{period.AcademicYear}
 
+	reportingPeriods, err := s.c.GetReportingPeriods(ctx, pid, academicYears)
+	if err != nil {
+		return nil, err
+	}
+
+	subjects, err := s.c.GetReportingSubjects(ctx, pid, academicYears, reportingPeriods)
+	if err != nil {
+		return nil, err
+	}
+
+	columns, err := s.c.GetMarkColumns(ctx, pid, academicYears, reportingPeriods, subjects)
+	if err != nil {
+		return nil, err
+	}
+
+	marksEngage, err := s.c.GetMarksheetRender(ctx, pid, academicYears, columns, reportingPeriods, subjects)
+	if err != nil {
+		return nil, err
+	}
+
+	marks := make([]*csb.Mark, 0, len(marksEngage))
+	for _, mark := range marksEngage {
+		if period.Contains(mark.Period) {
+			marks = append(marks, mark)
+		}
+	}
+	return marks, nil
 }
 
-func findMarks(ctx context.Context, tx *sql.Tx, filter csb.MarksFilter) ([]*csb.Mark, error) {
+func findMarks(ctx context.Context, tx *sql.Tx, filter csb.MarksFilter) (_ []*csb.Mark, page csb.Page, err error) {
+	where, args, err := marksConditions(filter)
+	if err != nil {
+		return nil, page, err
+	}
+
+	key, desc := parseSortBy(filter.SortBy)
+	exprs, err := markSortExprs(key)
+	if err != nil {
+		return nil, page, err
+	}
+
+	// count before applying the cursor so that the total covers all pages.
+	paginated := filter.Limit > 0 || filter.Cursor != ""
+	if paginated {
+		if err := tx.QueryRowContext(ctx, `
+			SELECT COUNT(*)
+			FROM marks m
+			INNER JOIN subjects s ON s.id = m.subject_id
+			WHERE `+strings.Join(where, " AND "),
+			args...,
+		).Scan(&page.Total); err != nil {
+			return nil, page, err
+		}
+	}
 
+	if filter.Cursor != "" {
+		values, err := decodeCursor(filter.Cursor, filter.SortBy, len(exprs))
+		if err != nil {
+			return nil, page, err
+		}
+		where, args = append(where, keysetCondition(exprs, desc, values)), append(args, values...)
+	}
+
+	rows, err := tx.QueryContext(ctx, `
+		SELECT
+			m.id,
+			m.student_id,
+			m.subject_id,
+			s.code,
+			m.teacher,
+			m.teacher_id,
+			m.column_id,
+			m.column_name,
+			m.column_type,
+			m.value,
+			m.percentage,
+			m.academic_year,
+			m.term,
+			m.importance,
+			m.source,
+			m.created_at,
+			`+strings.Join(exprs, ", ")+`
+		FROM marks m
+		INNER JOIN subjects s ON s.id = m.subject_id
+		WHERE `+strings.Join(where, " AND ")+`
+		`+orderClause(exprs, desc, filter.Limit)+`
+	`, args...)
+	if err != nil {
+		return nil, page, err
+	}
+	defer rows.Close()
+
+	var last []interface{}
+	marks := make([]*csb.Mark, 0)
+	for rows.Next() {
+		if filter.Limit > 0 && len(marks) == filter.Limit {
+			page.NextCursor = encodeCursor(filter.SortBy, last)
+			break
+		}
+
+		values, dest := sortValues(len(exprs))
+		mark, err := scanMark(rows, dest...)
+		if err != nil {
+			return nil, page, err
+		}
+		marks, last = append(marks, mark), values
+	}
+	if err := rows.Err(); err != nil {
+		return nil, page, err
+	}
+
+	if !paginated {
+		page.Total = len(marks)
+	}
+	return marks, page, nil
 }
 
-func deleteMark(ctx context.Context, tx *sql.Tx, id int) error {
+// marksConditions returns the sql conditions on the marks m joined with their subjects s
+// matching the filter, the sorting and pagination fields of the filter are ignored.
+func marksConditions(filter csb.MarksFilter) ([]string, []interface{}, error) {
+	where, args := []string{"1 = 1"}, []interface{}{}
+	if v := filter.ID; v != nil {
+		where, args = append(where, "m.id = ?"), append(args, *v)
+	}
+	if v := filter.PID; v != nil {
+		where, args = append(where, "m.student_id = ?"), append(args, *v)
+	}
+	if len(filter.PIDs) > 0 {
+		where = append(where, "m.student_id IN ("+placeholders(len(filter.PIDs))+")")
+		for _, pid := range filter.PIDs {
+			args = append(args, pid)
+		}
+	}
+	if v := filter.Teacher; v != nil {
+		where = append(where, "m.teacher_id IN (SELECT teacher_id FROM teacher_aliases WHERE alias = ?)")
+		args = append(args, csb.NormalizeTeacher(*v))
+	}
+	if v := filter.TeacherID; v != nil {
+		where, args = append(where, "m.teacher_id = ?"), append(args, *v)
+	}
+	if v := filter.MinPercentage; v != nil {
+		where, args = append(where, "m.percentage >= ?"), append(args, *v)
+	}
+	if v := filter.MaxPercentage; v != nil {
+		where, args = append(where, "m.percentage <= ?"), append(args, *v)
+	}
+	if len(filter.Periods) > 0 {
+		periods := make([]string, 0, len(filter.Periods))
+		for _, period := range filter.Periods {
+			cond, condArgs := periodCondition("m", period)
+			periods, args = append(periods, cond), append(args, condArgs...)
+		}
+		where = append(where, "("+strings.Join(periods, " OR ")+")")
+	}
+	if len(filter.Subjects) > 0 {
+		where = append(where, "s.code IN ("+placeholders(len(filter.Subjects))+")")
+		for _, subject := range filter.Subjects {
+			args = append(args, subject)
+		}
+	}
+	if v := filter.Source; v != nil {
+		where, args = append(where, "m.source = ?"), append(args, *v)
+	}
+	if len(filter.ColumnTypes) > 0 {
+		where = append(where, "m.column_type IN ("+placeholders(len(filter.ColumnTypes))+")")
+		for _, typ := range filter.ColumnTypes {
+			args = append(args, typ)
+		}
+	}
+	if v := filter.Grade; v != nil {
+		cond, condArgs, err := gradeCondition(*v)
+		if err != nil {
+			return nil, nil, err
+		}
+		where, args = append(where, cond), append(args, condArgs...)
+	}
+	return where, args, nil
+}
 
+// markSortExprs returns the sql expressions sorting marks on key, the mark id is always the
+// last expression so that the order is total.
+//
+// returns EINVALID if the sort key is unknown.
+func markSortExprs(key string) ([]string, error) {
+	switch key {
+	case "", csb.SORT_PERIOD:
+		return []string{"m.academic_year", "m.term", importanceRankExpr("m.importance"), "LOWER(m.importance)", "m.id"}, nil
+	case csb.SORT_PERCENTAGE:
+		// non numeric marks have no percentage and sort before the numeric ones, the
+		// expression is also the cursor value so the keyset comparison never meets a NULL.
+		return []string{"COALESCE(m.percentage, -1)", "m.id"}, nil
+	case csb.SORT_CREATED_AT:
+		return []string{"COALESCE(m.created_at, '')", "m.id"}, nil
+	case csb.SORT_NAME:
+		return []string{"s.name", "m.id"}, nil
+	}
+	return nil, csb.Errorf(csb.EINVALID, "find marks: invalid sort key: %q", key)
 }
 
-func createMark(ctx context.Context, tx *sql.Tx, mark *csb.Mark) error {
+// importanceRankExpr returns a sql expression ranking the importance in col like
+// csb.Period.Compare does, unknown importance levels rank last.
+func importanceRankExpr(col string) string {
+	ranks := csb.ImportanceRanks()
+	importances := make([]string, 0, len(ranks))
+	for importance := range ranks {
+		importances = append(importances, importance)
+	}
+	sort.Strings(importances)
 
+	var b strings.Builder
+	b.WriteString("(CASE LOWER(" + col + ")")
+	for _, importance := range importances {
+		fmt.Fprintf(&b, " WHEN '%v' THEN %v", strings.ReplaceAll(importance, "'", "''"), ranks[importance])
+	}
+	b.WriteString(" ELSE 1000 END)")
+	return b.String()
 }
 
-func attachMarkAssociations(ctx context.Context, tx *sql.Tx, mark *csb.Mark) (err error) {
+// scanMark scans a mark row selected by findMarks, the sort values following the mark columns
+// are scanned into extra.
+func scanMark(rows *sql.Rows, extra ...interface{}) (*csb.Mark, error) {
+	var (
+		mark       csb.Mark
+		percentage sql.NullInt64
+		term       int
+		importance string
+	)
+	if err := rows.Scan(append([]interface{}{
+		&mark.ID,
+		&mark.StudentID,
+		&mark.SubjectID,
+		&mark.Subject,
+		&mark.Teacher,
+		&mark.TeacherID,
+		&mark.Column.ID,
+		&mark.Column.Name,
+		&mark.Column.Type,
+		&mark.Value,
+		&percentage,
+		&mark.Period.AcademicYear,
+		&term,
+		&importance,
+		&mark.Source,
+		(*NullTime)(&mark.CreatedAt),
+	}, extra...)...); err != nil {
+		return nil, err
+	}
 
+	mark.Percentage = int(percentage.Int64)
+	mark.Period.Term, mark.Period.Importance = &term, &importance
+	return &mark, nil
 }
 
-func attachMarksAssociationsWithStudent(ctx context.Context, tx *sql.Tx, pid int, marks []*csb.Mark) (err error) {
+// periodCondition returns the sql condition matching the rows of the table aliased alias under
+// the populated fields of period.
+func periodCondition(alias string, period csb.Period) (string, []interface{}) {
+	cond, args := []string{alias + ".academic_year = ?"}, []interface{}{period.AcademicYear}
+	if period.Term != nil {
+		cond, args = append(cond, alias+".term = ?"), append(args, *period.Term)
+	}
+	if period.Importance != nil {
+		cond, args = append(cond, alias+".importance = ? COLLATE NOCASE"), append(args, *period.Importance)
+	}
+	return "(" + strings.Join(cond, " AND ") + ")", args
+}
+
+// gradeCondition returns the sql condition matching the marks with one of the filter grades.
+//
+// Each mark is graded with the table csb.GradeScale.Table would pick for it: the tables are
+// tried in order of precedence in a CASE expression, which stops at the first table applying
+// to the mark.
+func gradeCondition(filter csb.GradeFilter) (string, []interface{}, error) {
+	scale, err := csb.FindGradeScale(filter.Scale)
+	if err != nil {
+		return "", nil, csb.Errorf(csb.EINVALID, "find marks: unknown grade scale: %v", filter.Scale)
+	}
+
+	grades := make(map[string]struct{}, len(filter.Grades))
+	for _, grade := range filter.Grades {
+		grades[grade] = struct{}{}
+	}
+
+	tables := make([]*csb.BoundaryTable, 0, len(scale.Tables))
+	for i := range scale.Tables {
+		tables = append(tables, &scale.Tables[i])
+	}
+	sort.SliceStable(tables, func(i, j int) bool {
+		if (tables[i].Subject != "") != (tables[j].Subject != "") {
+			return tables[i].Subject != ""
+		}
+		return tables[j].From.Before(tables[i].From)
+	})
+
+	var (
+		b    strings.Builder
+		args []interface{}
+	)
+	b.WriteString("(CASE")
+	for _, table := range tables {
+		applies := []string{"1 = 1"}
+		if table.Subject != "" {
+			applies, args = append(applies, "s.code = ?"), append(args, table.Subject)
+		}
+		if table.From.AcademicYear != 0 {
+			applies, args = append(applies, "(m.academic_year * 10 + m.term) >= ?"), append(args, termOrdinal(table.From, 0))
+		}
+		if table.To.AcademicYear != 0 {
+			applies, args = append(applies, "(m.academic_year * 10 + m.term) <= ?"), append(args, termOrdinal(table.To, 9))
+		}
+
+		ranges := []string{"0"}
+		for _, r := range scale.Ranges(table) {
+			if _, ok := grades[r.Grade]; ok {
+				ranges, args = append(ranges, "m.percentage BETWEEN ? AND ?"), append(args, r.Min, r.Max)
+			}
+		}
+
+		b.WriteString(" WHEN " + strings.Join(applies, " AND ") + " THEN (" + strings.Join(ranges, " OR ") + ")")
+	}
+	b.WriteString(" ELSE 0 END)")
+
+	return b.String(), args, nil
+}
+
+// termOrdinal returns a comparable ordinal of the term of period, def is used for the term if
+// the period has none.
+func termOrdinal(period csb.Period, def int) int {
+	if period.Term != nil {
+		def = *period.Term
+	}
+	return period.AcademicYear*10 + def
+}
+
+// placeholders returns n comma separated sql placeholders.
+func placeholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?, ", n), ", ")
+}
+
+// deleteMark deletes the mark with id = id and records the deletion in the mark revisions.
+func deleteMark(ctx context.Context, tx *sql.Tx, id int, reason string, now time.Time) error {
+	mark, err := findMarkByID(ctx, tx, id)
+	if err != nil {
+		return err
+	}
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM marks WHERE id = ?`, id); err != nil {
+		return err
+	}
+	return createMarkRevision(ctx, tx, mark, nil, reason, now)
+}
+
+// createMark creates the mark and records the insertion in the mark revisions.
+func createMark(ctx context.Context, tx *sql.Tx, mark *csb.Mark, reason string, now time.Time) error {
+	if err := mark.Validate(); err != nil {
+		return err
+	}
+	mark.CreatedAt = now
+	if mark.Value == "" {
+		mark.Value = fmt.Sprintf("%v%%", mark.Percentage)
+	}
+
+	subjectID, err := findSubjectID(ctx, tx, mark.Subject)
+	if err != nil {
+		return err
+	}
+	mark.SubjectID = subjectID
 
+	teacherID, err := findTeacherID(ctx, tx, mark.Teacher, now)
+	if err != nil {
+		return err
+	}
+	mark.TeacherID = teacherID
+
+	if err := tx.QueryRowContext(ctx, `
+		INSERT INTO marks (
+			student_id,
+			subject_id,
+			teacher,
+			teacher_id,
+			column_id,
+			column_name,
+			column_type,
+			value,
+			percentage,
+			academic_year,
+			term,
+			importance,
+			source,
+			created_at
+		)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		RETURNING id
+	`,
+		mark.StudentID,
+		mark.SubjectID,
+		mark.Teacher,
+		mark.TeacherID,
+		mark.Column.ID,
+		mark.Column.Name,
+		mark.Column.Type,
+		mark.Value,
+		percentageOf(mark),
+		mark.Period.AcademicYear,
+		*mark.Period.Term,
+		*mark.Period.Importance,
+		mark.Source,
+		(*NullTime)(&mark.CreatedAt),
+	).Scan(&mark.ID); err != nil {
+		return err
+	}
+	return createMarkRevision(ctx, tx, nil, mark, reason, now)
 }
 
-func attachMarkSubject(ctx context.Context, tx *sql.Tx, mark *csb.Mark) (err error) {
+// updateMark updates the teacher, value, percentage and source of the mark and records the previous
+// values in the mark revisions, the natural key of a mark never changes.
+func updateMark(ctx context.Context, tx *sql.Tx, mark *csb.Mark, reason string, now time.Time) error {
+	if err := mark.Validate(); err != nil {
+		return err
+	}
+	prev, err := findMarkByID(ctx, tx, mark.ID)
+	if err != nil {
+		return err
+	}
+	if mark.Value == "" {
+		mark.Value = fmt.Sprintf("%v%%", mark.Percentage)
+	}
 
+	teacherID, err := findTeacherID(ctx, tx, mark.Teacher, now)
+	if err != nil {
+		return err
+	}
+	mark.TeacherID = teacherID
+
+	if _, err := tx.ExecContext(ctx, `
+		UPDATE marks
+		SET teacher = ?,
+			teacher_id = ?,
+			value = ?,
+			percentage = ?,
+			source = ?
+		WHERE id = ?
+	`,
+		mark.Teacher,
+		mark.TeacherID,
+		mark.Value,
+		percentageOf(mark),
+		mark.Source,
+		mark.ID,
+	); err != nil {
+		return err
+	}
+	return createMarkRevision(ctx, tx, prev, mark, reason, now)
+}
+
+// percentageOf returns the percentage of the mark to store, nil for non numeric marks.
+func percentageOf(mark *csb.Mark) *int {
+	if !mark.Numeric() {
+		return nil
+	}
+	return &mark.Percentage
+}
+
+// findSubjectID returns the id of the catalog subject with code = code, subjects missing from
+// the catalog are added to it.
+func findSubjectID(ctx context.Context, tx *sql.Tx, code csb.Subject) (int, error) {
+	subjects, err := findSubjects(ctx, tx, csb.SubjectFilter{Code: &code})
+	if err != nil {
+		return 0, err
+	} else if len(subjects) > 0 {
+		return subjects[0].ID, nil
+	}
+
+	subject := csb.SubjectInfo{Code: code, Name: code.String()}
+	if err := upsertSubject(ctx, tx, &subject); err != nil {
+		return 0, err
+	}
+	return subject.ID, nil
+}
+
+func attachMarkAssociations(ctx context.Context, tx *sql.Tx, mark *csb.Mark) (err error) {
+	return attachMarksAssociations(ctx, tx, []*csb.Mark{mark})
+}
+
+// attachMarksAssociations attaches the students of marks, the students are fetched in a single
+// query.
+func attachMarksAssociations(ctx context.Context, tx *sql.Tx, marks []*csb.Mark) (err error) {
+	pids := make([]int, 0, len(marks))
+	seen := make(map[int]struct{}, len(marks))
+	for _, mark := range marks {
+		if _, ok := seen[mark.StudentID]; !ok {
+			pids, seen[mark.StudentID] = append(pids, mark.StudentID), struct{}{}
+		}
+	}
+
+	students, err := findStudentsByPIDs(ctx, tx, pids)
+	if err != nil {
+		return fmt.Errorf("attach mark associations: %w", err)
+	}
+	for _, mark := range marks {
+		mark.Student = students[mark.StudentID]
+	}
+	return nil
+}
+
+// attachMarksAssociationsWithStudent attaches the student with pid = pid to marks which all
+// belong to the student.
+func attachMarksAssociationsWithStudent(ctx context.Context, tx *sql.Tx, pid int, marks []*csb.Mark) (err error) {
+	if len(marks) == 0 {
+		return nil
+	}
+
+	student, err := findStudentByPID(ctx, tx, pid)
+	if err != nil {
+		return fmt.Errorf("attach mark associations: %w", err)
+	}
+	for _, mark := range marks {
+		mark.Student = student
+	}
+	return nil
 }
@@ -0,0 +1,234 @@
+package sqlite_test
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	csb "github.com/Lambels/CSB-Open-API"
+	"github.com/Lambels/CSB-Open-API/engage"
+	"github.com/Lambels/CSB-Open-API/sqlite"
+)
+
+func TestMarkService_FindMarks_Grade(t *testing.T) {
+	db := MustOpenDB(t)
+	ctx := context.Background()
+
+	from, to := fullPeriod(2023, 2, "Mock"), fullPeriod(2022, 4, "Exam")
+	from.Importance, to.Importance = nil, nil
+	scale := csb.GradeScale{
+		Name:   "test-sqlite",
+		Grades: []string{"merit", "pass", "fail"},
+		Tables: []csb.BoundaryTable{
+			{Version: "default", Boundaries: map[string]int{"merit": 80, "pass": 50, "fail": 0}},
+			{Version: "2023", From: from, Boundaries: map[string]int{"merit": 90, "pass": 60, "fail": 0}},
+			{Version: "maths", Subject: csb.MATHEMATICS, To: to, Boundaries: map[string]int{"merit": 70, "pass": 40}},
+		},
+	}
+	if err := csb.RegisterGradeScale(scale); err != nil {
+		t.Fatal(err)
+	}
+
+	MustCreateStudent(t, db, &csb.Student{PID: 1001, Subjects: []csb.Subject{csb.MATHEMATICS, csb.PHYSICS}})
+	var marks []*csb.Mark
+	for _, subject := range []csb.Subject{csb.MATHEMATICS, csb.PHYSICS} {
+		for i, period := range []csb.Period{fullPeriod(2022, 1, "Mock"), fullPeriod(2023, 1, "Mock"), fullPeriod(2023, 3, "Exam")} {
+			for j, percentage := range []int{95, 85, 75, 65, 55, 45, 35} {
+				period := period
+				importance := *period.Importance + string(rune('A'+j))
+				period.Importance = &importance
+				marks = append(marks, MustCreateMark(t, db, &csb.Mark{StudentID: 1001, Subject: subject, Percentage: percentage - i, Period: period}))
+			}
+		}
+	}
+	// non numeric marks are never graded.
+	MustCreateMark(t, db, &csb.Mark{StudentID: 1001, Subject: csb.PHYSICS, Column: csb.Column{Type: csb.COLUMN_GRADE}, Value: "A*", Period: fullPeriod(2022, 1, "Mock")})
+
+	tests := [][]string{{"merit"}, {"pass"}, {"fail"}, {"merit", "fail"}, {"unknown"}}
+	for _, grades := range tests {
+		want := make(map[int]bool)
+		for _, mark := range marks {
+			grade, err := mark.Grade(&scale)
+			if err != nil && csb.ErrorCode(err) != csb.ENOTFOUND {
+				t.Fatal(err)
+			}
+			for _, g := range grades {
+				if g == grade {
+					want[mark.ID] = true
+				}
+			}
+		}
+
+		found, _, err := sqlite.NewMarkService(db, false, nil, nil).FindMarks(ctx, csb.MarksFilter{
+			Grade: &csb.GradeFilter{Scale: scale.Name, Grades: grades},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := make(map[int]bool)
+		for _, mark := range found {
+			got[mark.ID] = true
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Fatalf("grades %v: expected marks %v, got: %v", grades, want, got)
+		}
+	}
+
+	if _, _, err := sqlite.NewMarkService(db, false, nil, nil).FindMarks(ctx, csb.MarksFilter{
+		Grade: &csb.GradeFilter{Scale: "unknown", Grades: []string{"A"}},
+	}); csb.ErrorCode(err) != csb.EINVALID {
+		t.Fatalf("expected EINVALID for an unknown scale, got: %v", err)
+	}
+}
+
+func TestMarkService_RefreshMarks(t *testing.T) {
+	db := MustOpenDB(t)
+	server, client := MustOpenEngage(t)
+	s := sqlite.NewMarkService(db, false, client, engage.NewPeriodService(client))
+	ctx := context.Background()
+
+	MustCreateStudent(t, db, &csb.Student{PID: 1001, Subjects: []csb.Subject{csb.MATHEMATICS, csb.PHYSICS}})
+	year := csb.Period{AcademicYear: 2022}
+
+	// correctMarks changes the 2022 marks of the fixture student in engage: the maths
+	// assessment percentage is corrected, the physics assessment gets another teacher, the
+	// maths mock is removed and a chemistry mock and a mark of an unknown subject are added.
+	correctMarks := func() {
+		student := fixtureStudent(t, 1001)
+		marks := student.Marks[:0]
+		for _, mark := range student.Marks {
+			switch {
+			case mark.Period.AcademicYear != 2022:
+			case mark.Subject == csb.MATHEMATICS && *mark.Period.Term == 1:
+				mark.Percentage = 89
+			case mark.Subject == csb.PHYSICS && *mark.Period.Term == 1:
+				mark.Teacher = "Mrs Popa"
+			case mark.Subject == csb.MATHEMATICS && *mark.Period.Term == 2:
+				continue
+			}
+			marks = append(marks, mark)
+		}
+		student.Marks = append(marks,
+			&csb.Mark{Subject: csb.CHEMISTRY, Teacher: "Ms Radu", Percentage: 70, Period: fullPeriod(2022, 2, "Mock")},
+			&csb.Mark{Subject: "Astronomy", Teacher: "Ms Radu", Percentage: 60, Period: fullPeriod(2022, 2, "Mock")},
+		)
+		server.SetStudent(student)
+	}
+	// manualMark stores a manual mark engage doesent know.
+	manualMark := func() {
+		MustCreateMark(t, db, &csb.Mark{StudentID: 1001, Subject: csb.ENGLISH, Percentage: 50, Period: fullPeriod(2022, 1, "Assessment")})
+	}
+
+	tests := []struct {
+		name       string
+		setup      func()
+		refresh    csb.RefreshMarks
+		insert     int
+		update     int
+		delete     int
+		unresolved int
+		stored     int
+	}{
+		{name: "initial", refresh: csb.RefreshMarks{PID: 1001, From: year, To: year}, insert: 4, stored: 4},
+		{name: "unchanged", refresh: csb.RefreshMarks{PID: 1001, From: year, To: year, Reconcile: true}, stored: 4},
+		{name: "insert only", setup: correctMarks, refresh: csb.RefreshMarks{PID: 1001, From: year, To: year}, insert: 1, unresolved: 1, stored: 5},
+		{name: "reconcile", refresh: csb.RefreshMarks{PID: 1001, From: year, To: year, Reconcile: true}, update: 2, delete: 1, unresolved: 1, stored: 4},
+		{name: "keep manual", setup: manualMark, refresh: csb.RefreshMarks{PID: 1001, From: year, To: year, Reconcile: true}, unresolved: 1, stored: 5},
+		{name: "overwrite manual", refresh: csb.RefreshMarks{PID: 1001, From: year, To: year, Reconcile: true, Overwrite: true}, delete: 1, unresolved: 1, stored: 4},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.setup != nil {
+				tt.setup()
+			}
+
+			report, err := s.RefreshMarks(ctx, tt.refresh)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if n := report.Count(csb.CHANGE_INSERT); n != tt.insert {
+				t.Errorf("expected %v inserts, got: %v", tt.insert, n)
+			}
+			if n := report.Count(csb.CHANGE_UPDATE); n != tt.update {
+				t.Errorf("expected %v updates, got: %v", tt.update, n)
+			}
+			if n := report.Count(csb.CHANGE_DELETE); n != tt.delete {
+				t.Errorf("expected %v deletes, got: %v", tt.delete, n)
+			}
+			if n := len(report.Unresolved); n != tt.unresolved {
+				t.Errorf("expected %v unresolved marks, got: %v", tt.unresolved, n)
+			}
+
+			marks, err := s.FindMarksByPID(ctx, 1001)
+			if err != nil {
+				t.Fatal(err)
+			} else if len(marks) != tt.stored {
+				t.Errorf("expected %v stored marks, got: %v", tt.stored, len(marks))
+			}
+		})
+	}
+
+	// the corrections made it to the stored marks.
+	pid := 1001
+	marks, _, err := s.FindMarks(ctx, csb.MarksFilter{PID: &pid, Periods: []csb.Period{fullPeriod(2022, 1, "Assessment")}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, mark := range marks {
+		switch mark.Subject {
+		case csb.MATHEMATICS:
+			if mark.Percentage != 89 {
+				t.Fatalf("expected the corrected percentage, got: %v", mark.Percentage)
+			}
+		case csb.PHYSICS:
+			if mark.Teacher != "Mrs Popa" {
+				t.Fatalf("expected the new teacher, got: %v", mark.Teacher)
+			}
+		}
+	}
+}
+
+func TestMarkService_UpdateMark(t *testing.T) {
+	db := MustOpenDB(t)
+	s := sqlite.NewMarkService(db, false, nil, nil)
+	ctx := context.Background()
+
+	MustCreateStudent(t, db, &csb.Student{PID: 1001})
+	numeric := MustCreateMark(t, db, &csb.Mark{StudentID: 1001, Subject: csb.MATHEMATICS, Percentage: 80, Period: fullPeriod(2022, 1, "Mock")})
+	grade := MustCreateMark(t, db, &csb.Mark{StudentID: 1001, Subject: csb.MATHEMATICS, Column: csb.Column{Type: csb.COLUMN_GRADE}, Value: "B", Period: fullPeriod(2022, 2, "Mock")})
+
+	tests := []struct {
+		name       string
+		id         int
+		upd        csb.MarkUpdate
+		err        string
+		percentage int
+		value      string
+	}{
+		{name: "percentage", id: numeric.ID, upd: csb.MarkUpdate{Percentage: intPtr(85)}, percentage: 85, value: "85%"},
+		{name: "value of numeric", id: numeric.ID, upd: csb.MarkUpdate{Value: stringPtr("90%")}, err: csb.EINVALID, percentage: 85, value: "85%"},
+		{name: "percentage and value", id: numeric.ID, upd: csb.MarkUpdate{Percentage: intPtr(86), Value: stringPtr("86.4")}, percentage: 86, value: "86.4"},
+		{name: "percentage of grade", id: grade.ID, upd: csb.MarkUpdate{Percentage: intPtr(70)}, err: csb.EINVALID, value: "B"},
+		{name: "value of grade", id: grade.ID, upd: csb.MarkUpdate{Value: stringPtr("A")}, value: "A"},
+		{name: "not found", id: grade.ID + 1, upd: csb.MarkUpdate{Value: stringPtr("A")}, err: csb.ENOTFOUND},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := s.UpdateMark(ctx, tt.id, tt.upd)
+			if code := csb.ErrorCode(err); code != tt.err {
+				t.Fatalf("got error code %q, want %q: %v", code, tt.err, err)
+			} else if tt.err == csb.ENOTFOUND {
+				return
+			}
+
+			// failed updates leave the mark as it was.
+			mark, err := s.FindMarkByID(ctx, tt.id)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if mark.Percentage != tt.percentage || mark.Value != tt.value {
+				t.Errorf("got %v (%q), want %v (%q)", mark.Percentage, mark.Value, tt.percentage, tt.value)
+			}
+		})
+	}
+}
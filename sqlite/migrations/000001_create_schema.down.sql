@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS marks;
+DROP TABLE IF EXISTS student_subjects;
+DROP TABLE IF EXISTS students;
+DROP TABLE IF EXISTS subjects;
@@ -0,0 +1,38 @@
+CREATE TABLE subjects (
+	id   INTEGER PRIMARY KEY AUTOINCREMENT,
+	code TEXT NOT NULL UNIQUE,
+	name TEXT NOT NULL
+);
+
+CREATE TABLE students (
+	pid            INTEGER PRIMARY KEY,
+	name           TEXT NOT NULL,
+	current_year   INTEGER NOT NULL DEFAULT 0,
+	attends_school BOOLEAN NOT NULL DEFAULT TRUE,
+	created_at     TEXT,
+	updated_at     TEXT
+);
+
+CREATE INDEX students_name_idx ON students (name COLLATE NOCASE);
+
+CREATE TABLE student_subjects (
+	student_id INTEGER NOT NULL REFERENCES students (pid) ON DELETE CASCADE,
+	subject_id INTEGER NOT NULL REFERENCES subjects (id),
+
+	PRIMARY KEY (student_id, subject_id)
+);
+
+CREATE TABLE marks (
+	id            INTEGER PRIMARY KEY AUTOINCREMENT,
+	student_id    INTEGER NOT NULL REFERENCES students (pid) ON DELETE CASCADE,
+	subject_id    INTEGER NOT NULL REFERENCES subjects (id),
+	teacher       TEXT NOT NULL,
+	percentage    INTEGER NOT NULL,
+	academic_year INTEGER NOT NULL,
+	term          INTEGER NOT NULL,
+	importance    TEXT NOT NULL,
+	created_at    TEXT
+);
+
+CREATE INDEX marks_student_id_idx ON marks (student_id, academic_year, term);
+CREATE INDEX marks_subject_id_idx ON marks (subject_id);
@@ -0,0 +1,2 @@
+ALTER TABLE subjects DROP COLUMN last_seen;
+ALTER TABLE subjects DROP COLUMN first_seen;
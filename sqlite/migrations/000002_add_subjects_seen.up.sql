@@ -0,0 +1,2 @@
+ALTER TABLE subjects ADD COLUMN first_seen TEXT;
+ALTER TABLE subjects ADD COLUMN last_seen TEXT;
@@ -0,0 +1,15 @@
+-- mark_id isnt a foreign key, the history of deleted marks is kept.
+CREATE TABLE mark_revisions (
+	id              INTEGER PRIMARY KEY AUTOINCREMENT,
+	mark_id         INTEGER NOT NULL,
+	student_id      INTEGER NOT NULL,
+	type            TEXT NOT NULL,
+	reason          TEXT NOT NULL,
+	prev_percentage INTEGER,
+	prev_teacher    TEXT,
+	percentage      INTEGER,
+	teacher         TEXT,
+	created_at      TEXT
+);
+
+CREATE INDEX mark_revisions_mark_id_idx ON mark_revisions (mark_id);
@@ -0,0 +1,25 @@
+-- teacher_id cant be dropped while it references teachers, rebuild marks without it.
+CREATE TABLE marks_old (
+	id            INTEGER PRIMARY KEY AUTOINCREMENT,
+	student_id    INTEGER NOT NULL REFERENCES students (pid) ON DELETE CASCADE,
+	subject_id    INTEGER NOT NULL REFERENCES subjects (id),
+	teacher       TEXT NOT NULL,
+	percentage    INTEGER NOT NULL,
+	academic_year INTEGER NOT NULL,
+	term          INTEGER NOT NULL,
+	importance    TEXT NOT NULL,
+	created_at    TEXT
+);
+
+INSERT INTO marks_old (id, student_id, subject_id, teacher, percentage, academic_year, term, importance, created_at)
+SELECT id, student_id, subject_id, teacher, percentage, academic_year, term, importance, created_at
+FROM marks;
+
+DROP TABLE marks;
+ALTER TABLE marks_old RENAME TO marks;
+
+CREATE INDEX marks_student_id_idx ON marks (student_id, academic_year, term);
+CREATE INDEX marks_subject_id_idx ON marks (subject_id);
+
+DROP TABLE IF EXISTS teacher_aliases;
+DROP TABLE IF EXISTS teachers;
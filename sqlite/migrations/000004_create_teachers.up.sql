@@ -0,0 +1,36 @@
+CREATE TABLE teachers (
+	id         INTEGER PRIMARY KEY AUTOINCREMENT,
+	name       TEXT NOT NULL,
+	created_at TEXT
+);
+
+-- normalized spellings of the teacher names, see csb.NormalizeTeacher.
+CREATE TABLE teacher_aliases (
+	alias      TEXT PRIMARY KEY,
+	teacher_id INTEGER NOT NULL REFERENCES teachers (id) ON DELETE CASCADE
+);
+
+CREATE INDEX teacher_aliases_teacher_id_idx ON teacher_aliases (teacher_id);
+
+-- a column added with a foreign key must default to NULL, new marks always set it.
+ALTER TABLE marks ADD COLUMN teacher_id INTEGER REFERENCES teachers (id);
+
+CREATE INDEX marks_teacher_id_idx ON marks (teacher_id);
+
+-- the teachers of the existing marks are only aliased by their lower cased name, DB.Open
+-- rewrites the aliases with csb.NormalizeTeacher and merges the duplicates.
+INSERT INTO teachers (name)
+SELECT MIN(TRIM(teacher))
+FROM marks
+GROUP BY LOWER(TRIM(teacher));
+
+INSERT INTO teacher_aliases (alias, teacher_id)
+SELECT LOWER(name), id
+FROM teachers;
+
+UPDATE marks
+SET teacher_id = (
+	SELECT teacher_id
+	FROM teacher_aliases
+	WHERE alias = LOWER(TRIM(marks.teacher))
+);
@@ -0,0 +1,5 @@
+DROP TRIGGER IF EXISTS comments_au;
+DROP TRIGGER IF EXISTS comments_ad;
+DROP TRIGGER IF EXISTS comments_ai;
+DROP TABLE IF EXISTS comments_fts;
+DROP TABLE IF EXISTS comments;
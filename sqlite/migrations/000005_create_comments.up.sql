@@ -0,0 +1,14 @@
+CREATE TABLE comments (
+	id            INTEGER PRIMARY KEY AUTOINCREMENT,
+	student_id    INTEGER NOT NULL REFERENCES students (pid) ON DELETE CASCADE,
+	subject_id    INTEGER NOT NULL REFERENCES subjects (id),
+	teacher       TEXT NOT NULL DEFAULT '',
+	academic_year INTEGER NOT NULL,
+	term          INTEGER NOT NULL,
+	importance    TEXT NOT NULL,
+	text          TEXT NOT NULL,
+	created_at    TEXT,
+	updated_at    TEXT,
+
+	UNIQUE (student_id, subject_id, academic_year, term, importance)
+);
@@ -0,0 +1,28 @@
+ALTER TABLE mark_revisions DROP COLUMN value;
+ALTER TABLE mark_revisions DROP COLUMN prev_value;
+
+-- the non numeric marks cant be kept without a percentage.
+CREATE TABLE marks_old (
+	id            INTEGER PRIMARY KEY AUTOINCREMENT,
+	student_id    INTEGER NOT NULL REFERENCES students (pid) ON DELETE CASCADE,
+	subject_id    INTEGER NOT NULL REFERENCES subjects (id),
+	teacher       TEXT NOT NULL,
+	percentage    INTEGER NOT NULL,
+	academic_year INTEGER NOT NULL,
+	term          INTEGER NOT NULL,
+	importance    TEXT NOT NULL,
+	created_at    TEXT,
+	teacher_id    INTEGER REFERENCES teachers (id)
+);
+
+INSERT INTO marks_old (id, student_id, subject_id, teacher, percentage, academic_year, term, importance, created_at, teacher_id)
+SELECT id, student_id, subject_id, teacher, percentage, academic_year, term, importance, created_at, teacher_id
+FROM marks
+WHERE percentage IS NOT NULL;
+
+DROP TABLE marks;
+ALTER TABLE marks_old RENAME TO marks;
+
+CREATE INDEX marks_student_id_idx ON marks (student_id, academic_year, term);
+CREATE INDEX marks_subject_id_idx ON marks (subject_id);
+CREATE INDEX marks_teacher_id_idx ON marks (teacher_id);
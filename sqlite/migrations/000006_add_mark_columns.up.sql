@@ -0,0 +1,32 @@
+-- percentage becomes nullable for the non numeric marks, which takes rebuilding the table.
+CREATE TABLE marks_new (
+	id            INTEGER PRIMARY KEY AUTOINCREMENT,
+	student_id    INTEGER NOT NULL REFERENCES students (pid) ON DELETE CASCADE,
+	subject_id    INTEGER NOT NULL REFERENCES subjects (id),
+	teacher       TEXT NOT NULL,
+	teacher_id    INTEGER NOT NULL REFERENCES teachers (id),
+	column_id     TEXT NOT NULL DEFAULT '',
+	column_name   TEXT NOT NULL DEFAULT '',
+	column_type   TEXT NOT NULL DEFAULT '',
+	value         TEXT NOT NULL DEFAULT '',
+	-- NULL for non numeric marks.
+	percentage    INTEGER,
+	academic_year INTEGER NOT NULL,
+	term          INTEGER NOT NULL,
+	importance    TEXT NOT NULL,
+	created_at    TEXT
+);
+
+INSERT INTO marks_new (id, student_id, subject_id, teacher, teacher_id, value, percentage, academic_year, term, importance, created_at)
+SELECT id, student_id, subject_id, teacher, teacher_id, percentage || '%', percentage, academic_year, term, importance, created_at
+FROM marks;
+
+DROP TABLE marks;
+ALTER TABLE marks_new RENAME TO marks;
+
+CREATE INDEX marks_student_id_idx ON marks (student_id, academic_year, term);
+CREATE INDEX marks_subject_id_idx ON marks (subject_id);
+CREATE INDEX marks_teacher_id_idx ON marks (teacher_id);
+
+ALTER TABLE mark_revisions ADD COLUMN prev_value TEXT;
+ALTER TABLE mark_revisions ADD COLUMN value TEXT;
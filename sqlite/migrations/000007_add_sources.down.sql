@@ -0,0 +1,2 @@
+ALTER TABLE marks DROP COLUMN source;
+ALTER TABLE students DROP COLUMN source;
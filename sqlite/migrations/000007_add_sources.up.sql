@@ -0,0 +1,2 @@
+ALTER TABLE students ADD COLUMN source TEXT NOT NULL DEFAULT 'engage';
+ALTER TABLE marks ADD COLUMN source TEXT NOT NULL DEFAULT 'engage';
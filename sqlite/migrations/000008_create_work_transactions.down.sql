@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS work_transaction_statuses;
+DROP TABLE IF EXISTS work_transactions;
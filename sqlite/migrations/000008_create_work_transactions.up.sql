@@ -0,0 +1,22 @@
+CREATE TABLE work_transactions (
+	id         INTEGER PRIMARY KEY AUTOINCREMENT,
+	-- json encoding of the transaction data.
+	data       TEXT NOT NULL,
+	state      INTEGER NOT NULL,
+	error      TEXT,
+	created_at TEXT,
+	updated_at TEXT
+);
+
+CREATE INDEX work_transactions_state_idx ON work_transactions (state, id);
+
+-- every status a transaction went through.
+CREATE TABLE work_transaction_statuses (
+	id             INTEGER PRIMARY KEY AUTOINCREMENT,
+	transaction_id INTEGER NOT NULL REFERENCES work_transactions (id) ON DELETE CASCADE,
+	state          INTEGER NOT NULL,
+	error          TEXT,
+	created_at     TEXT
+);
+
+CREATE INDEX work_transaction_statuses_transaction_id_idx ON work_transaction_statuses (transaction_id);
@@ -0,0 +1 @@
+ALTER TABLE work_transactions DROP COLUMN key;
@@ -0,0 +1 @@
+ALTER TABLE work_transactions ADD COLUMN key TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,5 @@
+DROP INDEX work_transactions_state_idx;
+CREATE INDEX work_transactions_state_idx ON work_transactions (state, id);
+
+ALTER TABLE work_transactions DROP COLUMN not_before;
+ALTER TABLE work_transactions DROP COLUMN priority;
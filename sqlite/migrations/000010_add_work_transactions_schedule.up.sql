@@ -0,0 +1,5 @@
+ALTER TABLE work_transactions ADD COLUMN priority INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE work_transactions ADD COLUMN not_before TEXT;
+
+DROP INDEX work_transactions_state_idx;
+CREATE INDEX work_transactions_state_idx ON work_transactions (state, priority DESC, id);
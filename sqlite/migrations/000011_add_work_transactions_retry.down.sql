@@ -0,0 +1,4 @@
+ALTER TABLE work_transaction_statuses DROP COLUMN attempt;
+
+ALTER TABLE work_transactions DROP COLUMN attempt;
+ALTER TABLE work_transactions DROP COLUMN retry;
@@ -0,0 +1,5 @@
+-- json encoding of the retry policy.
+ALTER TABLE work_transactions ADD COLUMN retry TEXT NOT NULL DEFAULT '{}';
+ALTER TABLE work_transactions ADD COLUMN attempt INTEGER NOT NULL DEFAULT 0;
+
+ALTER TABLE work_transaction_statuses ADD COLUMN attempt INTEGER NOT NULL DEFAULT 0;
@@ -0,0 +1,110 @@
+package sqlite
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"strconv"
+	"strings"
+
+	csb "github.com/Lambels/CSB-Open-API"
+)
+
+// cursor is the decoded form of a page cursor, it holds the sort key of the page and the sort
+// values of the last result of the page.
+type cursor struct {
+	SortBy string        `json:"s"`
+	Values []interface{} `json:"v"`
+}
+
+// encodeCursor encodes the sort values of the last result of a page into an opaque cursor.
+func encodeCursor(sortBy string, values []interface{}) string {
+	for i, v := range values {
+		if b, ok := v.([]byte); ok {
+			values[i] = string(b)
+		}
+	}
+
+	b, _ := json.Marshal(cursor{SortBy: sortBy, Values: values})
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// decodeCursor decodes a cursor issued for sortBy holding n sort values.
+//
+// returns EINVALID if the cursor is malformed or was issued for another sort key.
+func decodeCursor(s string, sortBy string, n int) ([]interface{}, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, csb.Errorf(csb.EINVALID, "invalid cursor")
+	}
+
+	var c cursor
+	d := json.NewDecoder(bytes.NewReader(b))
+	d.UseNumber()
+	if err := d.Decode(&c); err != nil || len(c.Values) != n {
+		return nil, csb.Errorf(csb.EINVALID, "invalid cursor")
+	}
+	if c.SortBy != sortBy {
+		return nil, csb.Errorf(csb.EINVALID, "cursor issued for another sort: %q", c.SortBy)
+	}
+
+	for i, v := range c.Values {
+		num, ok := v.(json.Number)
+		if !ok {
+			continue
+		}
+		if x, err := num.Int64(); err == nil {
+			c.Values[i] = x
+		} else if x, err := num.Float64(); err == nil {
+			c.Values[i] = x
+		}
+	}
+	return c.Values, nil
+}
+
+// parseSortBy splits a SortBy filter field into its sort key and direction.
+func parseSortBy(sortBy string) (key string, desc bool) {
+	if strings.HasPrefix(sortBy, "-") {
+		return sortBy[1:], true
+	}
+	return sortBy, false
+}
+
+// keysetCondition returns the condition letting through the results sorted after values on
+// the sort expressions exprs.
+func keysetCondition(exprs []string, desc bool, values []interface{}) string {
+	op := ">"
+	if desc {
+		op = "<"
+	}
+	return "(" + strings.Join(exprs, ", ") + ") " + op + " (" + placeholders(len(values)) + ")"
+}
+
+// orderClause returns the ORDER BY and LIMIT clauses of a page sorted on exprs, one more
+// result than the limit is requested to know if there is a next page.
+func orderClause(exprs []string, desc bool, limit int) string {
+	dir := " ASC"
+	if desc {
+		dir = " DESC"
+	}
+
+	order := make([]string, len(exprs))
+	for i, expr := range exprs {
+		order[i] = expr + dir
+	}
+
+	clause := "ORDER BY " + strings.Join(order, ", ")
+	if limit > 0 {
+		clause += " LIMIT " + strconv.Itoa(limit+1)
+	}
+	return clause
+}
+
+// sortValues returns scan destinations for n sort values.
+func sortValues(n int) ([]interface{}, []interface{}) {
+	values, dest := make([]interface{}, n), make([]interface{}, n)
+	for i := range values {
+		dest[i] = &values[i]
+	}
+	return values, dest
+}
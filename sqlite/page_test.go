@@ -0,0 +1,173 @@
+package sqlite_test
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	csb "github.com/Lambels/CSB-Open-API"
+	"github.com/Lambels/CSB-Open-API/sqlite"
+)
+
+func TestMarkService_FindMarks_Cursor(t *testing.T) {
+	db := MustOpenDB(t)
+	now := time.Date(2022, 10, 1, 0, 0, 0, 0, time.UTC)
+	db.Now = func() time.Time { return now }
+	s := sqlite.NewMarkService(db, false, nil, nil)
+	ctx := context.Background()
+
+	// marks sharing their sort values, so that pages have to break ties on the id.
+	MustCreateStudent(t, db, &csb.Student{PID: 1001})
+	subjects := []csb.Subject{csb.MATHEMATICS, csb.PHYSICS, csb.CHEMISTRY}
+	importances := []string{"Mock", "Assessment", "mock", "Baseline"}
+	for i := 0; i < 24; i++ {
+		if i%5 == 0 {
+			now = now.Add(time.Hour)
+		}
+		mark := &csb.Mark{
+			StudentID:  1001,
+			Subject:    subjects[i%len(subjects)],
+			Percentage: 50 + i%4*10,
+			Period:     fullPeriod(2022, 1+i%2, fmt.Sprintf("%v %v", importances[i%len(importances)], i/8)),
+		}
+		if i%7 == 0 {
+			mark.Column = csb.Column{ID: "3", Name: "Effort Grade", Type: csb.COLUMN_EFFORT}
+			mark.Value = "A"
+		}
+		MustCreateMark(t, db, mark)
+	}
+
+	sorts := []string{"", csb.SORT_PERIOD, "-" + csb.SORT_PERIOD, csb.SORT_PERCENTAGE, "-" + csb.SORT_PERCENTAGE, csb.SORT_CREATED_AT, "-" + csb.SORT_CREATED_AT, csb.SORT_NAME, "-" + csb.SORT_NAME}
+	for _, sortBy := range sorts {
+		all, page, err := s.FindMarks(ctx, csb.MarksFilter{SortBy: sortBy})
+		if err != nil {
+			t.Fatal(err)
+		} else if len(all) != 24 || page.Total != 24 || page.NextCursor != "" {
+			t.Fatalf("%q: expected all 24 marks on a single page, got: %v, %+v", sortBy, len(all), page)
+		}
+		want := markIDs(all)
+
+		for _, limit := range []int{1, 5, 24, 30} {
+			t.Run(fmt.Sprintf("%q/%v", sortBy, limit), func(t *testing.T) {
+				var got []int
+				filter := csb.MarksFilter{SortBy: sortBy, Limit: limit}
+				for {
+					marks, page, err := s.FindMarks(ctx, filter)
+					if err != nil {
+						t.Fatal(err)
+					} else if page.Total != 24 {
+						t.Fatalf("expected a total of 24, got: %v", page.Total)
+					} else if len(marks) > limit {
+						t.Fatalf("expected at most %v marks, got: %v", limit, len(marks))
+					}
+
+					got = append(got, markIDs(marks)...)
+					if page.NextCursor == "" {
+						break
+					}
+					filter.Cursor = page.NextCursor
+				}
+
+				if !reflect.DeepEqual(got, want) {
+					t.Fatalf("expected the pages to hold %v, got: %v", want, got)
+				}
+			})
+		}
+	}
+
+	t.Run("Stable", func(t *testing.T) {
+		first, page, err := s.FindMarks(ctx, csb.MarksFilter{SortBy: csb.SORT_PERCENTAGE, Limit: 10})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// a mark inserted before the cursor doesent shift the next page.
+		MustCreateMark(t, db, &csb.Mark{StudentID: 1001, Subject: csb.ENGLISH, Percentage: 0, Period: fullPeriod(2022, 1, "Mock")})
+		next, _, err := s.FindMarks(ctx, csb.MarksFilter{SortBy: csb.SORT_PERCENTAGE, Limit: 10, Cursor: page.NextCursor})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		all, _, err := s.FindMarks(ctx, csb.MarksFilter{SortBy: csb.SORT_PERCENTAGE})
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := markIDs(all)[11:21]
+		if got := markIDs(next); !reflect.DeepEqual(got, want) {
+			t.Fatalf("expected %v after %v, got: %v", want, markIDs(first), got)
+		}
+	})
+
+	t.Run("Invalid", func(t *testing.T) {
+		_, page, err := s.FindMarks(ctx, csb.MarksFilter{SortBy: csb.SORT_PERCENTAGE, Limit: 1})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, filter := range []csb.MarksFilter{
+			{SortBy: csb.SORT_NAME, Cursor: page.NextCursor},
+			{SortBy: csb.SORT_PERCENTAGE, Cursor: "garbage"},
+			{SortBy: "unknown"},
+		} {
+			if _, _, err := s.FindMarks(ctx, filter); csb.ErrorCode(err) != csb.EINVALID {
+				t.Fatalf("expected EINVALID for %+v, got: %v", filter, err)
+			}
+		}
+	})
+}
+
+func TestStudentService_FindStudents_Cursor(t *testing.T) {
+	db := MustOpenDB(t)
+	s := sqlite.NewStudentService(db, nil, false)
+	ctx := context.Background()
+
+	names := []string{"Ana", "mihai", "Ana", "Ioana", "ana", "Mihai", "Bogdan"}
+	for i, name := range names {
+		MustCreateStudent(t, db, &csb.Student{PID: 1001 + i, Name: name})
+	}
+
+	for _, sortBy := range []string{"", csb.SORT_NAME, "-" + csb.SORT_NAME, csb.SORT_CREATED_AT, "-" + csb.SORT_CREATED_AT} {
+		t.Run(fmt.Sprintf("%q", sortBy), func(t *testing.T) {
+			all, _, err := s.FindStudents(ctx, csb.StudentFilter{SortBy: sortBy})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var got []*csb.Student
+			filter := csb.StudentFilter{SortBy: sortBy, Limit: 2}
+			for {
+				students, page, err := s.FindStudents(ctx, filter)
+				if err != nil {
+					t.Fatal(err)
+				} else if page.Total != len(names) {
+					t.Fatalf("expected a total of %v, got: %v", len(names), page.Total)
+				}
+
+				got = append(got, students...)
+				if page.NextCursor == "" {
+					break
+				}
+				filter.Cursor = page.NextCursor
+			}
+
+			if len(got) != len(all) {
+				t.Fatalf("expected %v students, got: %v", len(all), len(got))
+			}
+			for i := range all {
+				if got[i].PID != all[i].PID {
+					t.Fatalf("expected student %v at %v, got: %v", all[i].PID, i, got[i].PID)
+				}
+			}
+		})
+	}
+}
+
+func markIDs(marks []*csb.Mark) []int {
+	ids := make([]int, len(marks))
+	for i, mark := range marks {
+		ids[i] = mark.ID
+	}
+	return ids
+}
@@ -0,0 +1,281 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"sort"
+	"strings"
+
+	csb "github.com/Lambels/CSB-Open-API"
+)
+
+var (
+	_ csb.PeriodService = (*PeriodService)(nil)
+	_ csb.PeriodService = (*FallbackPeriodService)(nil)
+)
+
+// PeriodService is an offline period service which works out the known periods from the
+// marks stored locally.
+//
+// Periods are known per student when a pid is provided, else for the whole school.
+type PeriodService struct {
+	// db for persistance.
+	db *DB
+}
+
+// NewPeriodService creates a new period service over the marks in the provided database.
+func NewPeriodService(db *DB) *PeriodService {
+	return &PeriodService{
+		db: db,
+	}
+}
+
+// BuildPeriods builds the known periods of academicYear, narrowed to term if term isnt 0.
+//
+// If pid is provided the ordered full periods of the student are returned, else the terms with
+// marks in the whole school.
+//
+// returns EINVALID if term is provided without a pid.
+func (s *PeriodService) BuildPeriods(ctx context.Context, pid int, academicYear int, term int) ([]csb.Period, error) {
+	base := csb.Period{AcademicYear: academicYear}
+	if term != 0 {
+		if pid == 0 {
+			return nil, csb.Errorf(csb.EINVALID, "build periods: cannot narrow periods to a term without a student id")
+		}
+		base.Term = &term
+	}
+	if err := base.Validate(); err != nil {
+		return nil, err
+	}
+
+	tx, err := s.db.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	periods, err := findPeriods(ctx, tx, pid, &academicYear)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]csb.Period, 0, len(periods))
+	for _, period := range periods {
+		if base.Contains(period) {
+			out = append(out, period)
+		}
+	}
+	return out, nil
+}
+
+// Exists checks wether any mark was recieved under period, by the student with pid = pid if
+// provided or by anyone in the school.
+func (s *PeriodService) Exists(ctx context.Context, pid int, period csb.Period) (bool, error) {
+	if err := period.Validate(); err != nil {
+		return false, err
+	}
+
+	tx, err := s.db.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	var (
+		where = []string{"academic_year = ?"}
+		args  = []interface{}{period.AcademicYear}
+	)
+	if pid != 0 {
+		where, args = append(where, "student_id = ?"), append(args, pid)
+	}
+	if period.Term != nil {
+		where, args = append(where, "term = ?"), append(args, *period.Term)
+	}
+	if period.Importance != nil {
+		where, args = append(where, "importance = ? COLLATE NOCASE"), append(args, *period.Importance)
+	}
+
+	var exists bool
+	if err := tx.QueryRowContext(ctx, `
+		SELECT EXISTS (
+			SELECT 1
+			FROM marks
+			WHERE `+strings.Join(where, " AND ")+`
+		)
+	`, args...).Scan(&exists); err != nil {
+		return false, err
+	}
+	return exists, nil
+}
+
+// PeriodRange generates the ordered range of known periods [from, to].
+//
+// If pid is provided the range holds the full periods of the student, else the range is made
+// of the terms with marks in the whole school and the importance of from and to is ignored.
+//
+// returns EINVALID if to is before from.
+func (s *PeriodService) PeriodRange(ctx context.Context, pid int, from, to csb.Period) ([]csb.Period, error) {
+	if err := from.Validate(); err != nil {
+		return nil, err
+	}
+	if err := to.Validate(); err != nil {
+		return nil, err
+	}
+	if to.Before(from) {
+		return nil, csb.Errorf(csb.EINVALID, "period range: to period is before from period")
+	}
+	if pid == 0 {
+		from.Importance, to.Importance = nil, nil
+	}
+
+	tx, err := s.db.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	periods, err := findPeriods(ctx, tx, pid, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	start, end := -1, -1
+	for i, period := range periods {
+		if start == -1 && (from.Contains(period) || from.Before(period)) {
+			start = i
+		}
+		if to.Contains(period) || period.Before(to) {
+			end = i
+		}
+	}
+	if start == -1 || end < start {
+		return []csb.Period{}, nil
+	}
+	return periods[start : end+1], nil
+}
+
+// FallbackPeriodService is a composite period service which tries the primary period service
+// first and falls back on the fallback period service when the primary fails.
+//
+// It is usually used with engage as the primary and the local marks as the fallback so that
+// marks can be found when engage is down or when running without an engage token.
+type FallbackPeriodService struct {
+	// Primary is the period service tried first, a nil primary always falls back.
+	Primary csb.PeriodService
+	// Fallback is the period service used when the primary fails.
+	Fallback csb.PeriodService
+}
+
+// NewFallbackPeriodService creates a new composite period service.
+func NewFallbackPeriodService(primary, fallback csb.PeriodService) *FallbackPeriodService {
+	return &FallbackPeriodService{
+		Primary:  primary,
+		Fallback: fallback,
+	}
+}
+
+// BuildPeriods builds periods with the primary period service, falling back on failure.
+func (s *FallbackPeriodService) BuildPeriods(ctx context.Context, pid int, academicYear int, term int) ([]csb.Period, error) {
+	if s.Primary != nil {
+		periods, err := s.Primary.BuildPeriods(ctx, pid, academicYear, term)
+		if !s.fallback(ctx, err) {
+			return periods, err
+		}
+	}
+	return s.Fallback.BuildPeriods(ctx, pid, academicYear, term)
+}
+
+// Exists checks for the period with the primary period service, falling back on failure.
+func (s *FallbackPeriodService) Exists(ctx context.Context, pid int, period csb.Period) (bool, error) {
+	if s.Primary != nil {
+		ok, err := s.Primary.Exists(ctx, pid, period)
+		if !s.fallback(ctx, err) {
+			return ok, err
+		}
+	}
+	return s.Fallback.Exists(ctx, pid, period)
+}
+
+// PeriodRange generates the range with the primary period service, falling back on failure.
+func (s *FallbackPeriodService) PeriodRange(ctx context.Context, pid int, from, to csb.Period) ([]csb.Period, error) {
+	if s.Primary != nil {
+		periods, err := s.Primary.PeriodRange(ctx, pid, from, to)
+		if !s.fallback(ctx, err) {
+			return periods, err
+		}
+	}
+	return s.Fallback.PeriodRange(ctx, pid, from, to)
+}
+
+// fallback reports wether a call to the primary period service which returned err should
+// fallback. Invalid requests and cancelled contexts are returned to the caller as is.
+func (s *FallbackPeriodService) fallback(ctx context.Context, err error) bool {
+	if err == nil || ctx.Err() != nil {
+		return false
+	}
+	return csb.ErrorCode(err) != csb.EINVALID
+}
+
+// findPeriods returns the ordered known periods, optionally narrowed to academicYear.
+//
+// If pid is provided the full periods of the student are returned, else the terms of the
+// whole school.
+func findPeriods(ctx context.Context, tx *sql.Tx, pid int, academicYear *int) ([]csb.Period, error) {
+	var (
+		where = []string{"1 = 1"}
+		args  []interface{}
+	)
+	if academicYear != nil {
+		where, args = append(where, "academic_year = ?"), append(args, *academicYear)
+	}
+
+	query := `
+		SELECT academic_year, term, NULL
+		FROM marks
+		WHERE ` + strings.Join(where, " AND ") + `
+		GROUP BY academic_year, term
+		ORDER BY academic_year, term
+	`
+	if pid != 0 {
+		where, args = append(where, "student_id = ?"), append(args, pid)
+		query = `
+			SELECT academic_year, term, importance
+			FROM marks
+			WHERE ` + strings.Join(where, " AND ") + `
+			GROUP BY academic_year, term, importance COLLATE NOCASE
+			ORDER BY academic_year, term
+		`
+	}
+
+	rows, err := tx.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	periods := make([]csb.Period, 0)
+	for rows.Next() {
+		var (
+			period     csb.Period
+			term       int
+			importance sql.NullString
+		)
+		if err := rows.Scan(&period.AcademicYear, &term, &importance); err != nil {
+			return nil, err
+		}
+
+		period.Term = &term
+		if importance.Valid {
+			period.Importance = &importance.String
+		}
+		periods = append(periods, period)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(periods, func(i, j int) bool {
+		return periods[i].Before(periods[j])
+	})
+	return periods, nil
+}
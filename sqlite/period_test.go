@@ -0,0 +1,33 @@
+package sqlite_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	csb "github.com/Lambels/CSB-Open-API"
+	"github.com/Lambels/CSB-Open-API/sqlite"
+)
+
+func TestPeriodService_BuildPeriods(t *testing.T) {
+	db := MustOpenDB(t)
+	MustCreateStudent(t, db, &csb.Student{PID: 1001, Subjects: []csb.Subject{csb.MATHEMATICS, csb.PHYSICS}})
+
+	// the same importance spelled differently by two teachers is a single period.
+	MustCreateMark(t, db, &csb.Mark{StudentID: 1001, Subject: csb.MATHEMATICS, Percentage: 80, Period: fullPeriod(2022, 1, "Final")})
+	MustCreateMark(t, db, &csb.Mark{StudentID: 1001, Subject: csb.PHYSICS, Percentage: 70, Period: fullPeriod(2022, 1, "final")})
+	MustCreateMark(t, db, &csb.Mark{StudentID: 1001, Subject: csb.MATHEMATICS, Percentage: 60, Period: fullPeriod(2022, 2, "Mock")})
+
+	periods, err := sqlite.NewPeriodService(db).BuildPeriods(context.Background(), 1001, 2022, 0)
+	if err != nil {
+		t.Fatal(err)
+	} else if len(periods) != 2 {
+		t.Fatalf("expected 2 periods, got: %v", periods)
+	}
+	if *periods[0].Term != 1 || !strings.EqualFold(*periods[0].Importance, "final") {
+		t.Fatalf("expected term 1 final, got: %v", periods[0])
+	}
+	if *periods[1].Term != 2 || *periods[1].Importance != "Mock" {
+		t.Fatalf("expected term 2 Mock, got: %v", periods[1])
+	}
+}
@@ -0,0 +1,182 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"math"
+	"strings"
+
+	csb "github.com/Lambels/CSB-Open-API"
+)
+
+var _ csb.ReportService = (*ReportService)(nil)
+
+// ReportService builds reports over the stored marks.
+type ReportService struct {
+	// db for persistance.
+	db *DB
+}
+
+// NewReportService creates a new report service with the provided database.
+func NewReportService(db *DB) *ReportService {
+	return &ReportService{
+		db: db,
+	}
+}
+
+// FindCohortReport returns the distribution of the marks of a cohort.
+//
+// The percentages and percentile ranks of the students are computed in sql, the buckets and
+// percentiles are derived from them.
+func (s *ReportService) FindCohortReport(ctx context.Context, filter csb.CohortFilter) (*csb.CohortReport, error) {
+	if err := filter.Validate(); err != nil {
+		return nil, err
+	}
+	if filter.BucketSize == 0 {
+		filter.BucketSize = csb.DefaultBucketSize
+	}
+	if len(filter.Percentiles) == 0 {
+		filter.Percentiles = csb.DefaultPercentiles
+	}
+
+	tx, err := s.db.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	students, err := findCohortRanks(ctx, tx, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &csb.CohortReport{
+		Subject:     filter.Subject,
+		Period:      filter.Period,
+		Count:       len(students),
+		Buckets:     buckets(students, filter.BucketSize),
+		Percentiles: make([]csb.Percentile, 0, len(filter.Percentiles)),
+		Students:    students,
+	}
+	for _, p := range filter.Percentiles {
+		report.Percentiles = append(report.Percentiles, csb.Percentile{
+			Percentile: p,
+			Value:      percentile(students, p),
+		})
+	}
+
+	if filter.Anonymized {
+		for i := range report.Students {
+			student := &report.Students[i]
+			if filter.Focus == nil || *student.PID != *filter.Focus {
+				student.PID = nil
+			}
+			student.Name = ""
+		}
+	}
+	return report, nil
+}
+
+// findCohortRanks returns the percentage and percentile rank of each student of the cohort,
+// ordered from the lowest percentage.
+func findCohortRanks(ctx context.Context, tx *sql.Tx, filter csb.CohortFilter) ([]csb.StudentRank, error) {
+	where, args, err := marksConditions(csb.MarksFilter{
+		Subjects: []csb.Subject{filter.Subject},
+		Periods:  []csb.Period{filter.Period},
+	})
+	if err != nil {
+		return nil, err
+	}
+	// grades and effort marks cant be ranked.
+	where = append(where, "m.percentage IS NOT NULL")
+
+	if len(filter.PIDs) > 0 {
+		where = append(where, "m.student_id IN ("+placeholders(len(filter.PIDs))+")")
+		for _, pid := range filter.PIDs {
+			args = append(args, pid)
+		}
+	} else {
+		where, args = append(where, "st.current_year = ?"), append(args, *filter.CurrentYear)
+	}
+
+	// the students ranked before a student are the ones with a lower percentage, PERCENT_RANK
+	// would count them out of the cohort size - 1.
+	rows, err := tx.QueryContext(ctx, `
+		SELECT
+			st.pid,
+			st.name,
+			AVG(m.percentage) AS percentage,
+			(RANK() OVER (ORDER BY AVG(m.percentage)) - 1) * 100.0 / COUNT(*) OVER ()
+		FROM marks m
+		INNER JOIN subjects s ON s.id = m.subject_id
+		INNER JOIN students st ON st.pid = m.student_id
+		WHERE `+strings.Join(where, " AND ")+`
+		GROUP BY st.pid
+		ORDER BY percentage ASC, st.pid ASC
+	`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	students := make([]csb.StudentRank, 0)
+	for rows.Next() {
+		var (
+			student csb.StudentRank
+			pid     int
+		)
+		if err := rows.Scan(
+			&pid,
+			&student.Name,
+			&student.Percentage,
+			&student.Rank,
+		); err != nil {
+			return nil, err
+		}
+
+		student.PID = &pid
+		students = append(students, student)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return students, nil
+}
+
+// buckets returns the histogram of the percentages of students in buckets of size percentage
+// points, the last bucket holds 100.
+func buckets(students []csb.StudentRank, size int) []csb.Bucket {
+	n := (100 + size - 1) / size
+	if 100%size == 0 {
+		n = 100 / size
+	}
+
+	out := make([]csb.Bucket, n)
+	for i := range out {
+		out[i] = csb.Bucket{Min: i * size, Max: (i+1)*size - 1}
+	}
+	out[n-1].Max = 100
+
+	for _, student := range students {
+		i := int(math.Floor(student.Percentage)) / size
+		if i >= n {
+			i = n - 1
+		}
+		out[i].Count++
+	}
+	return out
+}
+
+// percentile returns the p-th percentile of the percentages of students, interpolated linearly
+// between the closest ranks. students must be ordered from the lowest percentage.
+func percentile(students []csb.StudentRank, p int) float64 {
+	if len(students) == 0 {
+		return 0
+	}
+
+	pos := float64(p) / 100 * float64(len(students)-1)
+	lo, hi := int(math.Floor(pos)), int(math.Ceil(pos))
+	frac := pos - float64(lo)
+	return students[lo].Percentage + (students[hi].Percentage-students[lo].Percentage)*frac
+}
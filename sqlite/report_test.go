@@ -0,0 +1,135 @@
+package sqlite_test
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	csb "github.com/Lambels/CSB-Open-API"
+	"github.com/Lambels/CSB-Open-API/sqlite"
+)
+
+func TestReportService_FindCohortReport(t *testing.T) {
+	db := MustOpenDB(t)
+	s := sqlite.NewReportService(db)
+	ctx := context.Background()
+
+	for pid := 1001; pid <= 1006; pid++ {
+		year := 11
+		if pid == 1006 {
+			year = 10
+		}
+		MustCreateStudent(t, db, &csb.Student{PID: pid, Name: "Student", CurrentYear: year})
+	}
+	for _, mark := range []*csb.Mark{
+		{StudentID: 1001, Subject: csb.MATHEMATICS, Percentage: 40, Period: fullPeriod(2022, 1, "Mock")},
+		{StudentID: 1002, Subject: csb.MATHEMATICS, Percentage: 60, Period: fullPeriod(2022, 1, "Assessment")},
+		{StudentID: 1002, Subject: csb.MATHEMATICS, Percentage: 80, Period: fullPeriod(2022, 1, "Mock")},
+		{StudentID: 1003, Subject: csb.MATHEMATICS, Percentage: 70, Period: fullPeriod(2022, 1, "Mock")},
+		{StudentID: 1004, Subject: csb.MATHEMATICS, Percentage: 90, Period: fullPeriod(2022, 1, "Mock")},
+		{StudentID: 1005, Subject: csb.MATHEMATICS, Percentage: 100, Period: fullPeriod(2022, 1, "Mock")},
+		{StudentID: 1006, Subject: csb.MATHEMATICS, Percentage: 10, Period: fullPeriod(2022, 1, "Mock")},
+		// left out of the cohort: another subject, another period and a non numeric mark.
+		{StudentID: 1001, Subject: csb.PHYSICS, Percentage: 99, Period: fullPeriod(2022, 1, "Mock")},
+		{StudentID: 1004, Subject: csb.MATHEMATICS, Percentage: 0, Period: fullPeriod(2021, 1, "Mock")},
+		{StudentID: 1003, Subject: csb.MATHEMATICS, Column: csb.Column{ID: "3", Name: "Effort Grade", Type: csb.COLUMN_EFFORT}, Value: "A", Period: fullPeriod(2022, 1, "Mock")},
+	} {
+		MustCreateMark(t, db, mark)
+	}
+
+	year, term := 11, 1
+	period := csb.Period{AcademicYear: 2022, Term: &term}
+
+	type rank struct {
+		pid        int // 0 if left out.
+		percentage float64
+		rank       float64
+	}
+	tests := []struct {
+		name        string
+		filter      csb.CohortFilter
+		ranks       []rank
+		percentiles []float64 // values of the filter percentiles.
+		buckets     []int
+	}{
+		{
+			name:   "year group",
+			filter: csb.CohortFilter{CurrentYear: &year, Subject: csb.MATHEMATICS, Period: period, BucketSize: 25, Percentiles: []int{0, 10, 25, 50, 90, 100}},
+			ranks: []rank{
+				{pid: 1001, percentage: 40, rank: 0},
+				{pid: 1002, percentage: 70, rank: 20},
+				{pid: 1003, percentage: 70, rank: 20},
+				{pid: 1004, percentage: 90, rank: 60},
+				{pid: 1005, percentage: 100, rank: 80},
+			},
+			percentiles: []float64{40, 52, 70, 70, 96, 100},
+			buckets:     []int{0, 1, 2, 2},
+		},
+		{
+			name:        "students",
+			filter:      csb.CohortFilter{PIDs: []int{1001, 1006}, Subject: csb.MATHEMATICS, Period: period, Percentiles: []int{50}},
+			ranks:       []rank{{pid: 1006, percentage: 10, rank: 0}, {pid: 1001, percentage: 40, rank: 50}},
+			percentiles: []float64{25},
+			buckets:     []int{0, 1, 0, 0, 1, 0, 0, 0, 0, 0},
+		},
+		{
+			name:   "anonymized",
+			filter: csb.CohortFilter{CurrentYear: &year, Subject: csb.MATHEMATICS, Period: period, Percentiles: []int{50}, Anonymized: true, Focus: intPtr(1003)},
+			ranks: []rank{
+				{percentage: 40, rank: 0},
+				{percentage: 70, rank: 20},
+				{pid: 1003, percentage: 70, rank: 20},
+				{percentage: 90, rank: 60},
+				{percentage: 100, rank: 80},
+			},
+			percentiles: []float64{70},
+			buckets:     []int{0, 0, 0, 0, 1, 0, 0, 2, 0, 2},
+		},
+		{
+			name:        "empty",
+			filter:      csb.CohortFilter{CurrentYear: &year, Subject: csb.CHEMISTRY, Period: period, BucketSize: 50, Percentiles: []int{50}},
+			percentiles: []float64{0},
+			buckets:     []int{0, 0},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			report, err := s.FindCohortReport(ctx, tt.filter)
+			if err != nil {
+				t.Fatal(err)
+			} else if report.Count != len(tt.ranks) || len(report.Students) != len(tt.ranks) {
+				t.Fatalf("expected %v students, got: %v", len(tt.ranks), report.Count)
+			}
+
+			for i, want := range tt.ranks {
+				got := report.Students[i]
+				if want.pid == 0 && (got.PID != nil || got.Name != "") {
+					t.Fatalf("student %v: expected to be anonymized, got: %+v", i, got)
+				} else if want.pid != 0 && (got.PID == nil || *got.PID != want.pid) {
+					t.Fatalf("student %v: expected pid %v, got: %+v", i, want.pid, got)
+				}
+				if !approx(got.Percentage, want.percentage) || !approx(got.Rank, want.rank) {
+					t.Fatalf("student %v: expected %v%% ranked %v, got: %v%% ranked %v", i, want.percentage, want.rank, got.Percentage, got.Rank)
+				}
+			}
+
+			for i, want := range tt.percentiles {
+				if got := report.Percentiles[i]; got.Percentile != tt.filter.Percentiles[i] || !approx(got.Value, want) {
+					t.Fatalf("expected percentile %v to be %v, got: %+v", tt.filter.Percentiles[i], want, got)
+				}
+			}
+
+			counts := make([]int, len(report.Buckets))
+			for i, bucket := range report.Buckets {
+				counts[i] = bucket.Count
+			}
+			if !reflect.DeepEqual(counts, tt.buckets) {
+				t.Fatalf("expected buckets %v, got: %v", tt.buckets, counts)
+			}
+		})
+	}
+
+	if _, err := s.FindCohortReport(ctx, csb.CohortFilter{Subject: csb.MATHEMATICS, Period: period}); csb.ErrorCode(err) != csb.EINVALID {
+		t.Fatalf("expected EINVALID without a cohort, got: %v", err)
+	}
+}
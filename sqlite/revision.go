@@ -0,0 +1,167 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	csb "github.com/Lambels/CSB-Open-API"
+)
+
+// FindMarkHistory returns the revisions of the mark with id = id, oldest first.
+//
+// returns ENOTFOUND if the mark has no revisions.
+func (s *MarkService) FindMarkHistory(ctx context.Context, id int) ([]*csb.MarkRevision, error) {
+	tx, err := s.db.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	revisions, err := findMarkRevisions(ctx, tx, id)
+	if err != nil {
+		return nil, err
+	} else if len(revisions) == 0 {
+		return nil, csb.Errorf(csb.ENOTFOUND, "mark not found: %v", id)
+	}
+
+	return revisions, nil
+}
+
+func findMarkRevisions(ctx context.Context, tx *sql.Tx, markID int) ([]*csb.MarkRevision, error) {
+	rows, err := tx.QueryContext(ctx, `
+		SELECT
+			id,
+			mark_id,
+			student_id,
+			type,
+			reason,
+			prev_percentage,
+			prev_value,
+			prev_teacher,
+			percentage,
+			value,
+			teacher,
+			created_at
+		FROM mark_revisions
+		WHERE mark_id = ?
+		ORDER BY id ASC
+	`, markID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	revisions := make([]*csb.MarkRevision, 0)
+	for rows.Next() {
+		var (
+			revision                   csb.MarkRevision
+			prevPercentage, percentage sql.NullInt64
+			prevValue, value           sql.NullString
+			prevTeacher, teacher       sql.NullString
+		)
+		if err := rows.Scan(
+			&revision.ID,
+			&revision.MarkID,
+			&revision.StudentID,
+			&revision.Type,
+			&revision.Reason,
+			&prevPercentage,
+			&prevValue,
+			&prevTeacher,
+			&percentage,
+			&value,
+			&teacher,
+			(*NullTime)(&revision.CreatedAt),
+		); err != nil {
+			return nil, err
+		}
+
+		if prevPercentage.Valid {
+			v := int(prevPercentage.Int64)
+			revision.PrevPercentage = &v
+		}
+		if prevValue.Valid {
+			revision.PrevValue = &prevValue.String
+		}
+		if prevTeacher.Valid {
+			revision.PrevTeacher = &prevTeacher.String
+		}
+		if percentage.Valid {
+			v := int(percentage.Int64)
+			revision.Percentage = &v
+		}
+		if value.Valid {
+			revision.Value = &value.String
+		}
+		if teacher.Valid {
+			revision.Teacher = &teacher.String
+		}
+
+		revisions = append(revisions, &revision)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return revisions, nil
+}
+
+// createMarkRevision records a write to a mark, prev is nil for inserts and next is nil for
+// deletes.
+func createMarkRevision(ctx context.Context, tx *sql.Tx, prev, next *csb.Mark, reason string, now time.Time) error {
+	revision := csb.MarkRevision{
+		Reason:    reason,
+		CreatedAt: now,
+	}
+
+	switch {
+	case prev == nil:
+		revision.Type = csb.CHANGE_INSERT
+	case next == nil:
+		revision.Type = csb.CHANGE_DELETE
+	default:
+		revision.Type = csb.CHANGE_UPDATE
+	}
+
+	if prev != nil {
+		revision.MarkID, revision.StudentID = prev.ID, prev.StudentID
+		revision.PrevPercentage, revision.PrevValue, revision.PrevTeacher = percentageOf(prev), &prev.Value, &prev.Teacher
+	}
+	if next != nil {
+		revision.MarkID, revision.StudentID = next.ID, next.StudentID
+		revision.Percentage, revision.Value, revision.Teacher = percentageOf(next), &next.Value, &next.Teacher
+	}
+
+	if _, err := tx.ExecContext(ctx, `
+		INSERT INTO mark_revisions (
+			mark_id,
+			student_id,
+			type,
+			reason,
+			prev_percentage,
+			prev_value,
+			prev_teacher,
+			percentage,
+			value,
+			teacher,
+			created_at
+		)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`,
+		revision.MarkID,
+		revision.StudentID,
+		revision.Type,
+		revision.Reason,
+		revision.PrevPercentage,
+		revision.PrevValue,
+		revision.PrevTeacher,
+		revision.Percentage,
+		revision.Value,
+		revision.Teacher,
+		(*NullTime)(&revision.CreatedAt),
+	); err != nil {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,131 @@
+package sqlite_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	csb "github.com/Lambels/CSB-Open-API"
+	"github.com/Lambels/CSB-Open-API/sqlite"
+)
+
+func TestMarkService_FindMarkHistory(t *testing.T) {
+	db := MustOpenDB(t)
+	now := time.Date(2022, 10, 1, 0, 0, 0, 0, time.UTC)
+	db.Now = func() time.Time { return now }
+	s := sqlite.NewMarkService(db, false, nil, nil)
+	ctx := context.Background()
+
+	MustCreateStudent(t, db, &csb.Student{PID: 1001})
+	mark := MustCreateMark(t, db, &csb.Mark{StudentID: 1001, Subject: csb.MATHEMATICS, Teacher: "Mr Ionescu", Percentage: 80, Period: fullPeriod(2022, 1, "Mock")})
+
+	now = now.Add(time.Hour)
+	teacher, percentage := "Ms Radu", 85
+	if _, err := s.UpdateMark(ctx, mark.ID, csb.MarkUpdate{Teacher: &teacher, Percentage: &percentage}); err != nil {
+		t.Fatal(err)
+	}
+
+	now = now.Add(time.Hour)
+	if err := s.DeleteMark(ctx, mark.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	// the history outlives the mark.
+	revisions, err := s.FindMarkHistory(ctx, mark.ID)
+	if err != nil {
+		t.Fatal(err)
+	} else if len(revisions) != 3 {
+		t.Fatalf("expected 3 revisions, got: %v", len(revisions))
+	}
+
+	tests := []struct {
+		typ                        string
+		prevPercentage, percentage *int
+		prevValue, value           *string
+		prevTeacher, teacher       *string
+		createdAt                  time.Time
+	}{
+		{
+			typ:        csb.CHANGE_INSERT,
+			percentage: intPtr(80), value: stringPtr("80%"), teacher: stringPtr("Mr Ionescu"),
+			createdAt: time.Date(2022, 10, 1, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			typ:            csb.CHANGE_UPDATE,
+			prevPercentage: intPtr(80), prevValue: stringPtr("80%"), prevTeacher: stringPtr("Mr Ionescu"),
+			percentage: intPtr(85), value: stringPtr("85%"), teacher: stringPtr("Ms Radu"),
+			createdAt: time.Date(2022, 10, 1, 1, 0, 0, 0, time.UTC),
+		},
+		{
+			typ:            csb.CHANGE_DELETE,
+			prevPercentage: intPtr(85), prevValue: stringPtr("85%"), prevTeacher: stringPtr("Ms Radu"),
+			createdAt: time.Date(2022, 10, 1, 2, 0, 0, 0, time.UTC),
+		},
+	}
+	for i, tt := range tests {
+		revision := revisions[i]
+		if revision.Type != tt.typ || revision.Reason != csb.REASON_MANUAL || revision.MarkID != mark.ID || revision.StudentID != 1001 {
+			t.Fatalf("revision %v: unexpected revision: %+v", i, revision)
+		}
+		if !equalInt(revision.PrevPercentage, tt.prevPercentage) || !equalInt(revision.Percentage, tt.percentage) {
+			t.Fatalf("revision %v: unexpected percentages: %v -> %v", i, revision.PrevPercentage, revision.Percentage)
+		}
+		if !equalString(revision.PrevValue, tt.prevValue) || !equalString(revision.Value, tt.value) {
+			t.Fatalf("revision %v: unexpected values: %v -> %v", i, revision.PrevValue, revision.Value)
+		}
+		if !equalString(revision.PrevTeacher, tt.prevTeacher) || !equalString(revision.Teacher, tt.teacher) {
+			t.Fatalf("revision %v: unexpected teachers: %v -> %v", i, revision.PrevTeacher, revision.Teacher)
+		}
+		if !revision.CreatedAt.Equal(tt.createdAt) {
+			t.Fatalf("revision %v: expected created at %v, got: %v", i, tt.createdAt, revision.CreatedAt)
+		}
+	}
+
+	if _, err := s.FindMarkHistory(ctx, 9999); csb.ErrorCode(err) != csb.ENOTFOUND {
+		t.Fatalf("expected ENOTFOUND, got: %v", err)
+	}
+}
+
+func TestMarkService_FindMarkHistory_Student(t *testing.T) {
+	db := MustOpenDB(t)
+	s := sqlite.NewMarkService(db, false, nil, nil)
+	ctx := context.Background()
+
+	MustCreateStudent(t, db, &csb.Student{PID: 1001})
+	mark := MustCreateMark(t, db, &csb.Mark{StudentID: 1001, Subject: csb.MATHEMATICS, Column: csb.Column{ID: "3", Name: "Effort Grade", Type: csb.COLUMN_EFFORT}, Value: "A", Period: fullPeriod(2022, 1, "Mock")})
+
+	// deleting the student records the deletion of its marks.
+	if err := sqlite.NewStudentService(db, nil, false).DeleteStudent(ctx, 1001); err != nil {
+		t.Fatal(err)
+	}
+
+	revisions, err := s.FindMarkHistory(ctx, mark.ID)
+	if err != nil {
+		t.Fatal(err)
+	} else if len(revisions) != 2 {
+		t.Fatalf("expected 2 revisions, got: %v", len(revisions))
+	}
+	if revision := revisions[1]; revision.Type != csb.CHANGE_DELETE || revision.Reason != csb.REASON_MANUAL {
+		t.Fatalf("unexpected revision: %+v", revision)
+	}
+	// non numeric marks have no percentage.
+	if revision := revisions[1]; revision.PrevPercentage != nil || !equalString(revision.PrevValue, stringPtr("A")) {
+		t.Fatalf("unexpected previous mark: %v, %v", revision.PrevPercentage, revision.PrevValue)
+	}
+}
+
+func equalInt(a, b *int) bool {
+	return (a == nil && b == nil) || (a != nil && b != nil && *a == *b)
+}
+
+func equalString(a, b *string) bool {
+	return (a == nil && b == nil) || (a != nil && b != nil && *a == *b)
+}
+
+func intPtr(v int) *int {
+	return &v
+}
+
+func stringPtr(v string) *string {
+	return &v
+}
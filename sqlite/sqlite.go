@@ -3,28 +3,47 @@ package sqlite
 import (
 	"context"
 	"database/sql"
+	"database/sql/driver"
+	"embed"
 	"errors"
+	"fmt"
+	"time"
 
+	csb "github.com/Lambels/CSB-Open-API"
 	_ "github.com/mattn/go-sqlite3"
 
 	"github.com/golang-migrate/migrate/v4"
+	"github.com/golang-migrate/migrate/v4/database"
 	"github.com/golang-migrate/migrate/v4/database/sqlite3"
 	_ "github.com/golang-migrate/migrate/v4/source/file"
+	"github.com/golang-migrate/migrate/v4/source/iofs"
 )
 
-//go:embed subjects_data.sql
-var data string
+// migrations holds the versioned schema migrations, embedded so that the binary can create
+// and upgrade its own database.
+//
+//go:embed migrations/*.sql
+var migrations embed.FS
 
 type DB struct {
-	DSN            string
+	DSN string
+	// MigrationsPath optionally overrides the embedded migrations with a migrate source url,
+	// ie: "file://migrations".
 	MigrationsPath string
 	db             *sql.DB
+
+	// Now returns the current time, defaults to time.Now.
+	Now func() time.Time
+
+	// fts indicates wether sqlite was built with fts5 and the comments have a full text index.
+	fts bool
 }
 
 func NewDB(dsn string, migrationsPath string) *DB {
 	return &DB{
 		DSN:            dsn,
 		MigrationsPath: migrationsPath,
+		Now:            time.Now,
 	}
 }
 
@@ -56,44 +75,179 @@ func (db *DB) Open() error {
 		return err
 	}
 
-	m, err := migrate.NewWithDatabaseInstance(
-		db.MigrationsPath,
-		"students",
-		driver,
-	)
+	m, err := db.migrate(driver)
 	if err != nil {
 		return err
 	}
 
-	if err := m.Up(); err != nil {
+	if err := m.Up(); err != nil && !errors.Is(err, migrate.ErrNoChange) {
+		return fmt.Errorf("migrate: %w", err)
+	}
+
+	if err := db.setupSearch(context.Background()); err != nil {
+		return fmt.Errorf("setup search: %w", err)
+	}
+
+	if err := db.normalizeTeachers(context.Background()); err != nil {
+		return fmt.Errorf("normalize teachers: %w", err)
+	}
+
+	return db.seedSubjects(context.Background())
+}
+
+// Close closes the database connection.
+func (db *DB) Close() error {
+	if db.db == nil {
+		return nil
+	}
+	return db.db.Close()
+}
+
+// setupSearch sets up the full text index of the comment texts if sqlite was built with fts5
+// (the sqlite_fts5 build tag), the index isnt a migration so that the schema doesent depend on
+// the build. Without fts5 the comment search falls back on LIKE.
+func (db *DB) setupSearch(ctx context.Context) error {
+	if err := db.db.QueryRowContext(ctx, `SELECT sqlite_compileoption_used('ENABLE_FTS5')`).Scan(&db.fts); err != nil {
 		return err
 	}
 
-	return db.populateSubjects()
+	tx, err := db.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// the triggers left by a build with fts5 would fail every write to the comments.
+	if !db.fts {
+		for _, trigger := range []string{"comments_ai", "comments_ad", "comments_au"} {
+			if _, err := tx.ExecContext(ctx, `DROP TRIGGER IF EXISTS `+trigger); err != nil {
+				return err
+			}
+		}
+		return tx.Commit()
+	}
+
+	var indexed bool
+	if err := tx.QueryRowContext(ctx, `
+		SELECT EXISTS (SELECT 1 FROM sqlite_master WHERE type = 'trigger' AND name = 'comments_ai')
+	`).Scan(&indexed); err != nil {
+		return err
+	}
+	if indexed {
+		return nil
+	}
+
+	for _, stmt := range []string{`
+		CREATE VIRTUAL TABLE IF NOT EXISTS comments_fts USING fts5 (
+			text,
+			content = 'comments',
+			content_rowid = 'id'
+		)
+	`, `
+		CREATE TRIGGER comments_ai AFTER INSERT ON comments BEGIN
+			INSERT INTO comments_fts (rowid, text) VALUES (new.id, new.text);
+		END
+	`, `
+		CREATE TRIGGER comments_ad AFTER DELETE ON comments BEGIN
+			INSERT INTO comments_fts (comments_fts, rowid, text) VALUES ('delete', old.id, old.text);
+		END
+	`, `
+		CREATE TRIGGER comments_au AFTER UPDATE ON comments BEGIN
+			INSERT INTO comments_fts (comments_fts, rowid, text) VALUES ('delete', old.id, old.text);
+			INSERT INTO comments_fts (rowid, text) VALUES (new.id, new.text);
+		END
+	`,
+		// index the comments written while the index was missing.
+		`INSERT INTO comments_fts (comments_fts) VALUES ('rebuild')`,
+	} {
+		if _, err := tx.ExecContext(ctx, stmt); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
 }
 
-func (db *DB) populateSubjects() error {
-	conn, err := db.db.Conn(context.Background())
+// normalizeTeachers links the marks migrated before the teachers existed to the same teachers
+// as the marks written since, the migration can only alias the teachers by their lower cased
+// name.
+func (db *DB) normalizeTeachers(ctx context.Context) error {
+	tx, err := db.db.BeginTx(ctx, nil)
 	if err != nil {
 		return err
 	}
-	defer conn.Close()
+	defer tx.Rollback()
+
+	if err := normalizeTeacherAliases(ctx, tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// migrate returns a migrate instance reading the migrations from MigrationsPath if set, else
+// from the embedded migrations.
+func (db *DB) migrate(driver database.Driver) (*migrate.Migrate, error) {
+	if db.MigrationsPath != "" {
+		return migrate.NewWithDatabaseInstance(db.MigrationsPath, "students", driver)
+	}
+
+	src, err := iofs.New(migrations, "migrations")
+	if err != nil {
+		return nil, err
+	}
+	return migrate.NewWithInstance("iofs", src, "students", driver)
+}
 
-	resp, err := conn.QueryContext(context.Background(), `SELECT COUNT(*) FROM subjects`)
+// seedSubjects seeds the subject catalog with the well known subjects and registers the names
+// of all the catalog subjects so that subject names resolve through the catalog.
+func (db *DB) seedSubjects(ctx context.Context) error {
+	tx, err := db.db.BeginTx(ctx, nil)
 	if err != nil {
 		return err
 	}
-	defer resp.Close()
+	defer tx.Rollback()
+
+	for code, name := range csb.WellKnownSubjects() {
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO subjects (code, name)
+			VALUES (?, ?)
+			ON CONFLICT (code) DO NOTHING
+		`, code, name); err != nil {
+			return fmt.Errorf("seed subjects: %w", err)
+		}
+	}
 
-	var n int
-	if err := resp.Scan(&n); err != nil {
+	subjects, err := findSubjects(ctx, tx, csb.SubjectFilter{})
+	if err != nil {
 		return err
 	}
+	for _, subject := range subjects {
+		csb.RegisterSubject(subject.Code, subject.Name)
+	}
 
-	if n != 0 {
+	return tx.Commit()
+}
+
+// NullTime represents a helper wrapper for time.Time. It automatically converts
+// time fields to/from RFC 3339 format. Also supports NULL for zero time.
+type NullTime time.Time
+
+// Scan reads a time value from the database.
+func (n *NullTime) Scan(value interface{}) error {
+	if value == nil {
+		*(*time.Time)(n) = time.Time{}
+		return nil
+	} else if value, ok := value.(string); ok {
+		*(*time.Time)(n), _ = time.Parse(time.RFC3339, value)
 		return nil
 	}
+	return fmt.Errorf("NullTime: cannot scan to time.Time: %T", value)
+}
 
-	_, err = conn.ExecContext(context.Background(), data)
-	return err
+// Value formats a time value for the database.
+func (n *NullTime) Value() (driver.Value, error) {
+	if n == nil || (*time.Time)(n).IsZero() {
+		return nil, nil
+	}
+	return (*time.Time)(n).UTC().Format(time.RFC3339), nil
 }
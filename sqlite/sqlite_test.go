@@ -0,0 +1,154 @@
+package sqlite_test
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"testing"
+
+	csb "github.com/Lambels/CSB-Open-API"
+	"github.com/Lambels/CSB-Open-API/engage"
+	"github.com/Lambels/CSB-Open-API/engage/engagetest"
+	"github.com/Lambels/CSB-Open-API/sqlite"
+	"github.com/golang-migrate/migrate/v4"
+	"github.com/golang-migrate/migrate/v4/database/sqlite3"
+)
+
+// MustOpenDB returns a new, open DB in a temporary directory. The DB is closed when the test
+// finishes.
+func MustOpenDB(tb testing.TB) *sqlite.DB {
+	tb.Helper()
+
+	db := sqlite.NewDB(filepath.Join(tb.TempDir(), "db"), "")
+	if err := db.Open(); err != nil {
+		tb.Fatal(err)
+	}
+	tb.Cleanup(func() {
+		if err := db.Close(); err != nil {
+			tb.Fatal(err)
+		}
+	})
+	return db
+}
+
+// MustCreateStudent creates a manual student taking mathematics.
+func MustCreateStudent(tb testing.TB, db *sqlite.DB, student *csb.Student) *csb.Student {
+	tb.Helper()
+
+	if student.Name == "" {
+		student.Name = "Student"
+	}
+	if len(student.Subjects) == 0 {
+		student.Subjects = []csb.Subject{csb.MATHEMATICS}
+	}
+	if err := sqlite.NewStudentService(db, nil, false).CreateStudent(context.Background(), student); err != nil {
+		tb.Fatal(err)
+	}
+	return student
+}
+
+// MustCreateMark creates a manual mark.
+func MustCreateMark(tb testing.TB, db *sqlite.DB, mark *csb.Mark) *csb.Mark {
+	tb.Helper()
+
+	if mark.Teacher == "" {
+		mark.Teacher = "Mr Ionescu"
+	}
+	if err := sqlite.NewMarkService(db, false, nil, nil).CreateMark(context.Background(), mark); err != nil {
+		tb.Fatal(err)
+	}
+	return mark
+}
+
+// fullPeriod returns the full period of term in academicYear with importance.
+func fullPeriod(academicYear, term int, importance string) csb.Period {
+	return csb.Period{AcademicYear: academicYear, Term: &term, Importance: &importance}
+}
+
+// MustOpenEngage returns a fake engage server seeded with the engagetest fixture and a client
+// of it without rate limiting and retries. The server is closed when the test finishes.
+func MustOpenEngage(tb testing.TB) (*engagetest.Server, *engage.Client) {
+	tb.Helper()
+
+	s := engagetest.NewServer(engagetest.Fixture())
+	tb.Cleanup(s.Close)
+
+	c := s.EngageClient("")
+	c.Limiter = nil
+	c.Retry = engage.RetryPolicy{}
+	return s, c
+}
+
+// fixtureStudent returns a copy of the engagetest fixture student with pid = pid.
+func fixtureStudent(tb testing.TB, pid int) *csb.Student {
+	tb.Helper()
+
+	for _, student := range engagetest.Fixture() {
+		if student.PID == pid {
+			return student
+		}
+	}
+	tb.Fatalf("fixture student not found: %v", pid)
+	return nil
+}
+
+// TestMigrations checks that the migrations apply up and then fully down on a fresh database.
+func TestMigrations(t *testing.T) {
+	dbSQL, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := dbSQL.Exec(`PRAGMA foreign_keys = on;`); err != nil {
+		t.Fatal(err)
+	}
+	driver, err := sqlite3.WithInstance(dbSQL, &sqlite3.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := migrate.NewWithDatabaseInstance("file://migrations", "students", driver)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+
+	files, err := filepath.Glob(filepath.Join("migrations", "*.up.sql"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// twice so that the down migrations are checked to leave a database the up migrations
+	// apply to again.
+	for i := 0; i < 2; i++ {
+		if err := m.Up(); err != nil {
+			t.Fatalf("up %v: %v", i, err)
+		}
+		if version, dirty, err := m.Version(); err != nil {
+			t.Fatal(err)
+		} else if dirty || version != uint(len(files)) {
+			t.Fatalf("up %v: got version %v (dirty %v), want %v", i, version, dirty, len(files))
+		}
+
+		if err := m.Down(); err != nil {
+			t.Fatalf("down %v: %v", i, err)
+		}
+		var tables []string
+		rows, err := dbSQL.Query(`SELECT name FROM sqlite_master WHERE type IN ('table', 'index', 'trigger') AND name NOT LIKE 'sqlite_%' AND tbl_name != 'schema_migrations' ORDER BY name`)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for rows.Next() {
+			var name string
+			if err := rows.Scan(&name); err != nil {
+				t.Fatal(err)
+			}
+			tables = append(tables, name)
+		}
+		if err := rows.Err(); err != nil {
+			t.Fatal(err)
+		}
+		rows.Close()
+		if len(tables) != 0 {
+			t.Fatalf("down %v: left %v", i, tables)
+		}
+	}
+}
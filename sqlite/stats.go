@@ -0,0 +1,281 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"math"
+	"strconv"
+	"strings"
+
+	csb "github.com/Lambels/CSB-Open-API"
+)
+
+var _ csb.StatsService = (*StatsService)(nil)
+
+// StatsService computes statistics over the stored marks, all the aggregation is done in sql.
+type StatsService struct {
+	// db for persistance.
+	db *DB
+}
+
+// NewStatsService creates a new stats service with the provided database.
+func NewStatsService(db *DB) *StatsService {
+	return &StatsService{
+		db: db,
+	}
+}
+
+// groupColumns maps the mark fields the statistics can be grouped by to their sql expression.
+var groupColumns = map[string]string{
+	csb.GROUP_STUDENT:       "m.student_id",
+	csb.GROUP_SUBJECT:       "s.code",
+	csb.GROUP_TEACHER:       "(SELECT t.name FROM teachers t WHERE t.id = m.teacher_id)",
+	csb.GROUP_ACADEMIC_YEAR: "m.academic_year",
+	csb.GROUP_TERM:          "m.term",
+	csb.GROUP_IMPORTANCE:    "m.importance",
+}
+
+// FindMarkStats returns the statistics of each group of marks.
+//
+// The median is the average of the middle percentages of the group ranked in a window.
+func (s *StatsService) FindMarkStats(ctx context.Context, filter csb.StatsFilter) ([]*csb.MarkStats, error) {
+	tx, err := s.db.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	return findMarkStats(ctx, tx, filter)
+}
+
+// FindTrends returns the trend of each student.
+//
+// The periods of each group are numbered with a dense rank and the slope is the least squares
+// fit of the percentages over that rank.
+func (s *StatsService) FindTrends(ctx context.Context, filter csb.StatsFilter) ([]*csb.Trend, error) {
+	tx, err := s.db.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	return findTrends(ctx, tx, filter)
+}
+
+func findMarkStats(ctx context.Context, tx *sql.Tx, filter csb.StatsFilter) ([]*csb.MarkStats, error) {
+	groups, exprs, err := groupExprs(filter.GroupBy)
+	if err != nil {
+		return nil, err
+	}
+
+	where, args, err := marksConditions(filter.Marks)
+	if err != nil {
+		return nil, err
+	}
+	// only numeric marks have a percentage.
+	where = append(where, "m.percentage IS NOT NULL")
+
+	rows, err := tx.QueryContext(ctx, `
+		WITH filtered AS (
+			SELECT
+				`+selectGroups(exprs)+`
+				m.percentage AS p,
+				ROW_NUMBER() OVER (`+partitionBy(exprs)+` ORDER BY m.percentage) AS rn,
+				COUNT(*) OVER (`+partitionBy(exprs)+`) AS n
+			FROM marks m
+			INNER JOIN subjects s ON s.id = m.subject_id
+			WHERE `+strings.Join(where, " AND ")+`
+		)
+		SELECT
+			`+selectGroups(groupAliases(len(exprs)))+`
+			COUNT(*),
+			AVG(p),
+			AVG(CASE WHEN rn IN ((n + 1) / 2, (n + 2) / 2) THEN p END),
+			AVG(p * p) - AVG(p) * AVG(p),
+			MIN(p),
+			MAX(p)
+		FROM filtered
+		`+groupBy(groupAliases(len(exprs)))+`
+	`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := make([]*csb.MarkStats, 0)
+	for rows.Next() {
+		var (
+			stats                  csb.MarkStats
+			mean, median, variance sql.NullFloat64
+			min, max               sql.NullInt64
+		)
+		dest := append(groupDest(&stats.Group, groups), &stats.Count, &mean, &median, &variance, &min, &max)
+		if err := rows.Scan(dest...); err != nil {
+			return nil, err
+		}
+		// aggregating no marks without a grouping still yields a row.
+		if stats.Count == 0 {
+			continue
+		}
+
+		stats.Mean, stats.Median = mean.Float64, median.Float64
+		stats.StdDev = math.Sqrt(math.Max(variance.Float64, 0))
+		stats.Min, stats.Max = int(min.Int64), int(max.Int64)
+		out = append(out, &stats)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return out, nil
+}
+
+func findTrends(ctx context.Context, tx *sql.Tx, filter csb.StatsFilter) ([]*csb.Trend, error) {
+	// trends are always per student.
+	grouping := []string{csb.GROUP_STUDENT}
+	for _, group := range filter.GroupBy {
+		if group != csb.GROUP_STUDENT {
+			grouping = append(grouping, group)
+		}
+	}
+
+	groups, exprs, err := groupExprs(grouping)
+	if err != nil {
+		return nil, err
+	}
+
+	where, args, err := marksConditions(filter.Marks)
+	if err != nil {
+		return nil, err
+	}
+	// only numeric marks have a percentage.
+	where = append(where, "m.percentage IS NOT NULL")
+
+	rows, err := tx.QueryContext(ctx, `
+		WITH filtered AS (
+			SELECT
+				`+selectGroups(exprs)+`
+				m.percentage AS y,
+				DENSE_RANK() OVER (
+					`+partitionBy(exprs)+`
+					ORDER BY m.academic_year, m.term, `+importanceRankExpr("m.importance")+`, LOWER(m.importance)
+				) AS x
+			FROM marks m
+			INNER JOIN subjects s ON s.id = m.subject_id
+			WHERE `+strings.Join(where, " AND ")+`
+		)
+		SELECT
+			`+selectGroups(groupAliases(len(exprs)))+`
+			COUNT(*),
+			COUNT(DISTINCT x),
+			(COUNT(*) * SUM(x * y) - SUM(x) * SUM(y)) * 1.0 /
+				NULLIF(COUNT(*) * SUM(x * x) - SUM(x) * SUM(x), 0)
+		FROM filtered
+		`+groupBy(groupAliases(len(exprs)))+`
+	`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := make([]*csb.Trend, 0)
+	for rows.Next() {
+		var (
+			trend csb.Trend
+			slope sql.NullFloat64
+		)
+		dest := append(groupDest(&trend.Group, groups), &trend.Count, &trend.Periods, &slope)
+		if err := rows.Scan(dest...); err != nil {
+			return nil, err
+		}
+
+		trend.Slope = slope.Float64
+		out = append(out, &trend)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return out, nil
+}
+
+// groupExprs validates the grouping and returns its sql expressions.
+//
+// returns EINVALID if a grouping field is unknown or repeated.
+func groupExprs(groupBy []string) ([]string, []string, error) {
+	seen := make(map[string]struct{}, len(groupBy))
+	exprs := make([]string, 0, len(groupBy))
+	for _, group := range groupBy {
+		expr, ok := groupColumns[group]
+		if !ok {
+			return nil, nil, csb.Errorf(csb.EINVALID, "stats: invalid grouping: %q", group)
+		}
+		if _, ok := seen[group]; ok {
+			return nil, nil, csb.Errorf(csb.EINVALID, "stats: repeated grouping: %q", group)
+		}
+		seen[group] = struct{}{}
+		exprs = append(exprs, expr)
+	}
+	return groupBy, exprs, nil
+}
+
+// groupAliases returns the aliases the group expressions are selected as.
+func groupAliases(n int) []string {
+	out := make([]string, n)
+	for i := range out {
+		out[i] = "g" + strconv.Itoa(i)
+	}
+	return out
+}
+
+// selectGroups returns the select list of the group expressions aliased by groupAliases,
+// followed by a comma.
+func selectGroups(exprs []string) string {
+	var b strings.Builder
+	for i, alias := range groupAliases(len(exprs)) {
+		if exprs[i] == alias {
+			b.WriteString(alias + ", ")
+			continue
+		}
+		b.WriteString(exprs[i] + " AS " + alias + ", ")
+	}
+	return b.String()
+}
+
+// partitionBy returns the PARTITION BY clause of the group expressions.
+func partitionBy(exprs []string) string {
+	if len(exprs) == 0 {
+		return ""
+	}
+	return "PARTITION BY " + strings.Join(exprs, ", ")
+}
+
+// groupBy returns the GROUP BY and ORDER BY clauses of the group aliases.
+func groupBy(aliases []string) string {
+	if len(aliases) == 0 {
+		return ""
+	}
+	return "GROUP BY " + strings.Join(aliases, ", ") + " ORDER BY " + strings.Join(aliases, ", ")
+}
+
+// groupDest returns the scan destinations of the group fields.
+func groupDest(group *csb.MarkGroup, groups []string) []interface{} {
+	dest := make([]interface{}, 0, len(groups))
+	for _, g := range groups {
+		switch g {
+		case csb.GROUP_STUDENT:
+			dest = append(dest, &group.StudentID)
+		case csb.GROUP_SUBJECT:
+			dest = append(dest, &group.Subject)
+		case csb.GROUP_TEACHER:
+			dest = append(dest, &group.Teacher)
+		case csb.GROUP_ACADEMIC_YEAR:
+			dest = append(dest, &group.AcademicYear)
+		case csb.GROUP_TERM:
+			dest = append(dest, &group.Term)
+		case csb.GROUP_IMPORTANCE:
+			dest = append(dest, &group.Importance)
+		}
+	}
+	return dest
+}
@@ -0,0 +1,168 @@
+package sqlite_test
+
+import (
+	"context"
+	"math"
+	"testing"
+
+	csb "github.com/Lambels/CSB-Open-API"
+	"github.com/Lambels/CSB-Open-API/sqlite"
+)
+
+// MustCreateStatsMarks creates two students with numeric maths and physics marks and a non
+// numeric mark.
+func MustCreateStatsMarks(tb testing.TB, db *sqlite.DB) {
+	tb.Helper()
+
+	MustCreateStudent(tb, db, &csb.Student{PID: 1001})
+	MustCreateStudent(tb, db, &csb.Student{PID: 1002})
+	for _, mark := range []*csb.Mark{
+		{StudentID: 1001, Subject: csb.MATHEMATICS, Percentage: 60, Period: fullPeriod(2022, 1, "Assessment")},
+		{StudentID: 1001, Subject: csb.MATHEMATICS, Percentage: 70, Period: fullPeriod(2022, 1, "Mock")},
+		{StudentID: 1001, Subject: csb.MATHEMATICS, Percentage: 80, Period: fullPeriod(2022, 2, "Mock")},
+		{StudentID: 1001, Subject: csb.PHYSICS, Percentage: 90, Period: fullPeriod(2022, 1, "Assessment")},
+		{StudentID: 1001, Subject: csb.PHYSICS, Column: csb.Column{ID: "3", Name: "Effort Grade", Type: csb.COLUMN_EFFORT}, Value: "A", Period: fullPeriod(2022, 2, "Mock")},
+		{StudentID: 1002, Subject: csb.MATHEMATICS, Percentage: 50, Period: fullPeriod(2022, 1, "Assessment")},
+		{StudentID: 1002, Subject: csb.MATHEMATICS, Percentage: 40, Period: fullPeriod(2022, 2, "Mock")},
+		{StudentID: 1002, Subject: csb.PHYSICS, Percentage: 100, Period: fullPeriod(2022, 1, "Assessment")},
+	} {
+		MustCreateMark(tb, db, mark)
+	}
+}
+
+func TestStatsService_FindMarkStats(t *testing.T) {
+	db := MustOpenDB(t)
+	s := sqlite.NewStatsService(db)
+	MustCreateStatsMarks(t, db)
+
+	tests := []struct {
+		name   string
+		filter csb.StatsFilter
+		want   []csb.MarkStats
+	}{
+		{
+			name: "all",
+			want: []csb.MarkStats{{Count: 7, Mean: 70, Median: 70, StdDev: 20, Min: 40, Max: 100}},
+		},
+		{
+			name:   "subject",
+			filter: csb.StatsFilter{GroupBy: []string{csb.GROUP_SUBJECT}},
+			want: []csb.MarkStats{
+				{Count: 5, Mean: 60, Median: 60, StdDev: math.Sqrt(200), Min: 40, Max: 80},
+				{Count: 2, Mean: 95, Median: 95, StdDev: 5, Min: 90, Max: 100},
+			},
+		},
+		{
+			name:   "student",
+			filter: csb.StatsFilter{GroupBy: []string{csb.GROUP_STUDENT}},
+			want: []csb.MarkStats{
+				{Count: 4, Mean: 75, Median: 75, StdDev: math.Sqrt(125), Min: 60, Max: 90},
+				{Count: 3, Mean: 190.0 / 3, Median: 50, StdDev: math.Sqrt(14100.0/3 - (190.0/3)*(190.0/3)), Min: 40, Max: 100},
+			},
+		},
+		{
+			name:   "filtered",
+			filter: csb.StatsFilter{Marks: csb.MarksFilter{Subjects: []csb.Subject{csb.PHYSICS}}},
+			want:   []csb.MarkStats{{Count: 2, Mean: 95, Median: 95, StdDev: 5, Min: 90, Max: 100}},
+		},
+		{
+			name:   "empty",
+			filter: csb.StatsFilter{Marks: csb.MarksFilter{Subjects: []csb.Subject{csb.CHEMISTRY}}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stats, err := s.FindMarkStats(context.Background(), tt.filter)
+			if err != nil {
+				t.Fatal(err)
+			} else if len(stats) != len(tt.want) {
+				t.Fatalf("expected %v groups, got: %v", len(tt.want), len(stats))
+			}
+
+			for i, want := range tt.want {
+				got := stats[i]
+				if got.Count != want.Count || got.Min != want.Min || got.Max != want.Max ||
+					!approx(got.Mean, want.Mean) || !approx(got.Median, want.Median) || !approx(got.StdDev, want.StdDev) {
+					t.Fatalf("group %v: expected %+v, got: %+v", i, want, *got)
+				}
+			}
+		})
+	}
+
+	// the groups are identified by their fields.
+	stats, err := s.FindMarkStats(context.Background(), csb.StatsFilter{GroupBy: []string{csb.GROUP_STUDENT, csb.GROUP_SUBJECT}})
+	if err != nil {
+		t.Fatal(err)
+	} else if len(stats) != 4 {
+		t.Fatalf("expected 4 groups, got: %v", len(stats))
+	}
+	if group := stats[1].Group; *group.StudentID != 1001 || *group.Subject != csb.PHYSICS || group.Teacher != nil {
+		t.Fatalf("unexpected group: %+v", group)
+	}
+
+	for _, groupBy := range [][]string{{"unknown"}, {csb.GROUP_TERM, csb.GROUP_TERM}} {
+		if _, err := s.FindMarkStats(context.Background(), csb.StatsFilter{GroupBy: groupBy}); csb.ErrorCode(err) != csb.EINVALID {
+			t.Fatalf("expected EINVALID for %v, got: %v", groupBy, err)
+		}
+	}
+}
+
+func TestStatsService_FindTrends(t *testing.T) {
+	db := MustOpenDB(t)
+	s := sqlite.NewStatsService(db)
+	MustCreateStatsMarks(t, db)
+
+	type trend struct {
+		pid     int
+		subject csb.Subject
+		count   int
+		periods int
+		slope   float64
+	}
+	tests := []struct {
+		name    string
+		groupBy []string
+		want    []trend
+	}{
+		{
+			// 1001: (1, 60), (1, 90), (2, 70), (3, 80).
+			name: "student",
+			want: []trend{{pid: 1001, count: 4, periods: 3, slope: 20.0 / 11}, {pid: 1002, count: 3, periods: 2, slope: -35}},
+		},
+		{
+			name:    "subject",
+			groupBy: []string{csb.GROUP_SUBJECT},
+			want: []trend{
+				{pid: 1001, subject: csb.MATHEMATICS, count: 3, periods: 3, slope: 10},
+				{pid: 1001, subject: csb.PHYSICS, count: 1, periods: 1},
+				{pid: 1002, subject: csb.MATHEMATICS, count: 2, periods: 2, slope: -10},
+				{pid: 1002, subject: csb.PHYSICS, count: 1, periods: 1},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			trends, err := s.FindTrends(context.Background(), csb.StatsFilter{GroupBy: tt.groupBy})
+			if err != nil {
+				t.Fatal(err)
+			} else if len(trends) != len(tt.want) {
+				t.Fatalf("expected %v trends, got: %v", len(tt.want), len(trends))
+			}
+
+			for i, want := range tt.want {
+				got := trends[i]
+				if *got.Group.StudentID != want.pid || (want.subject != "" && *got.Group.Subject != want.subject) {
+					t.Fatalf("trend %v: unexpected group: %+v", i, got.Group)
+				}
+				if got.Count != want.count || got.Periods != want.periods || !approx(got.Slope, want.slope) {
+					t.Fatalf("trend %v: expected %+v, got: %+v", i, want, *got)
+				}
+			}
+		})
+	}
+}
+
+// approx reports wether a and b are equal up to rounding errors.
+func approx(a, b float64) bool {
+	return math.Abs(a-b) < 1e-9
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
+	"strings"
 	"time"
 
 	csb "github.com/Lambels/CSB-Open-API"
@@ -50,20 +51,25 @@ func (s *StudentService) FindStudentByPID(ctx context.Context, pid int) (*csb.St
 	case "":
 		if err := attachStudentMarks(ctx, tx, student); err != nil {
 			return nil, err
+		} else if err := attachStudentComments(ctx, tx, student); err != nil {
+			return nil, err
 		}
 
 		return student, nil
 
 	case csb.ENOTFOUND:
 		student, err := s.findStudentByPIDEngage(ctx, pid)
-		if err != nil {
+		if csb.ErrorCode(err) == csb.EINVALID {
+			return nil, csb.Errorf(csb.ENOTFOUND, "student not found: %v", pid)
+		} else if err != nil {
 			return nil, err
 		}
 		if !s.saveNew {
 			return student, nil
 		}
 
-		if err := createStudent(ctx, tx, student); err != nil {
+		student.Source = csb.SOURCE_ENGAGE
+		if err := createStudent(ctx, tx, student, s.db.Now()); err != nil {
 			return student, nil
 		}
 		return student, tx.Commit()
@@ -73,26 +79,83 @@ func (s *StudentService) FindStudentByPID(ctx context.Context, pid int) (*csb.St
 	}
 }
 
-// FindStudents returns a range of students based on the filter.
-func (s *StudentService) FindStudents(ctx context.Context, filter csb.StudentFilter) ([]*csb.Student, error) {
+// FindStudents returns a page of students based on the filter.
+func (s *StudentService) FindStudents(ctx context.Context, filter csb.StudentFilter) ([]*csb.Student, csb.Page, error) {
+	tx, err := s.db.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, csb.Page{}, err
+	}
+	defer tx.Rollback()
+
+	students, page, err := findStudents(ctx, tx, filter)
+	if err != nil {
+		return nil, page, err
+	}
+
+	if err := attachStudentsMarks(ctx, tx, students); err != nil {
+		return nil, page, err
+	}
+
+	return students, page, nil
+}
+
+// CreateStudent creates a manual student along with its subjects.
+//
+// returns ECONFLICT if the student already exists.
+func (s *StudentService) CreateStudent(ctx context.Context, student *csb.Student) error {
+	tx, err := s.db.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	student.Source = csb.SOURCE_MANUAL
+	if err := createStudent(ctx, tx, student, s.db.Now()); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// UpdateStudent updates a student specified by pid, the student becomes manual so that
+// refreshes keep it.
+//
+// returns ENOTFOUND if the student isnt found.
+func (s *StudentService) UpdateStudent(ctx context.Context, pid int, upd csb.StudentUpdate) (*csb.Student, error) {
 	tx, err := s.db.db.BeginTx(ctx, nil)
 	if err != nil {
 		return nil, err
 	}
 	defer tx.Rollback()
 
-	students, err := findStudents(ctx, tx, filter)
+	student, err := findStudentByPID(ctx, tx, pid)
 	if err != nil {
 		return nil, err
 	}
 
-	for _, student := range students {
-		if err := attachStudentMarks(ctx, tx, student); err != nil {
-			return nil, err
-		}
+	if v := upd.Name; v != nil {
+		student.Name = *v
 	}
+	if v := upd.CurrentYear; v != nil {
+		student.CurrentYear = *v
+	}
+	if v := upd.AttendsSchool; v != nil {
+		student.AttendsSchool = *v
+	}
+	if v := upd.Subjects; v != nil {
+		student.Subjects = *v
+	}
+	student.Source = csb.SOURCE_MANUAL
 
-	return students, nil
+	if err := updateStudent(ctx, tx, pid, student, s.db.Now()); err != nil {
+		return nil, err
+	} else if err := attachStudentMarks(ctx, tx, student); err != nil {
+		return nil, err
+	} else if err := attachStudentComments(ctx, tx, student); err != nil {
+		return nil, err
+	}
+
+	return student, tx.Commit()
 }
 
 // DeleteStudent permanently deletes a student specified by pid.
@@ -104,7 +167,7 @@ func (s *StudentService) DeleteStudent(ctx context.Context, pid int) error {
 	}
 	defer tx.Rollback()
 
-	if err := deleteStudent(ctx, tx, pid); err != nil {
+	if err := deleteStudent(ctx, tx, pid, csb.REASON_MANUAL, s.db.Now()); err != nil {
 		return err
 	}
 
@@ -116,40 +179,61 @@ func (s *StudentService) DeleteStudent(ctx context.Context, pid int) error {
 //
 // If a student is in engage but not in the local copy of students then the student is added
 // to the local copy. If refresh.Purge is set to true and the student from engage is not
-// attending school then the copy from engage to local storage wont be made.
+// attending school then the copy from engage to local storage wont be made. Engage doesent
+// name its pupils so the students added are named after their pid until they are updated.
 //
 // If refresh.Purge is set to true and a student in the local database is not attending the school
 // any more in engage, then the user is deleted.
 //
 // If the student is both in engage and local storage, an update will be so that your local
-// storage has the newest data.
+// storage has the newest data, the local name and year are kept.
+//
+// Manual students are neither updated nor purged unless refresh.Overwrite is set.
 func (s *StudentService) RefreshStudents(ctx context.Context, refresh csb.RefreshStudents) error {
+	// engage copies, fetched before the transaction is opened so that the write lock isnt held
+	// while the rate limited engage requests are made.
+	engageStudents := make([]*csb.Student, refresh.N)
+	for i := range engageStudents {
+		studentEngage, err := s.findStudentByPIDEngage(ctx, refresh.StartPID+i)
+		switch csb.ErrorCode(err) {
+		case "", csb.ENOTFOUND:
+		case csb.EINVALID:
+			// engage rejected this pid, dont fail the whole refresh over it.
+			studentEngage = nil
+		default:
+			return err
+		}
+		engageStudents[i] = studentEngage
+	}
+
 	tx, err := s.db.db.BeginTx(ctx, nil)
 	if err != nil {
 		return err
 	}
 	defer tx.Rollback()
 
-	PIDCount := refresh.StartPID
-	for i := 0; i < refresh.N; i++ {
-		// engage copy.
-		studentEngage, err := s.findStudentByPIDEngage(ctx, PIDCount)
-		if err != nil && csb.ErrorCode(err) != csb.ENOTFOUND {
-			return err
-		}
+	for i, studentEngage := range engageStudents {
+		PIDCount := refresh.StartPID + i
 
 		// local copy.
 		studentLocal, err := findStudentByPID(ctx, tx, PIDCount)
 		if err != nil && csb.ErrorCode(err) != csb.ENOTFOUND {
 			return err
 		}
+		if studentEngage != nil {
+			studentEngage.Source = csb.SOURCE_ENGAGE
+		}
 
 		switch {
 		case studentEngage == nil && studentLocal == nil:
 			// no data from engage or local db.
+		case studentLocal != nil && studentLocal.Source == csb.SOURCE_MANUAL && !refresh.Overwrite:
+			// keep the manual student.
+		case studentEngage == nil:
+			// engage doesent know the local student (anymore), keep it.
 		case !studentEngage.AttendsSchool && studentLocal != nil && refresh.Purge:
 			// old student in db and willing to purge.
-			if err := deleteStudent(ctx, tx, PIDCount); err != nil {
+			if err := deleteStudent(ctx, tx, PIDCount, csb.REASON_PURGE, s.db.Now()); err != nil {
 				return err
 			}
 		case studentEngage != nil && studentLocal == nil:
@@ -160,55 +244,408 @@ func (s *StudentService) RefreshStudents(ctx context.Context, refresh csb.Refres
 				break
 			}
 
-			if err := createStudent(ctx, tx, studentEngage); err != nil {
+			// engage doesent name its pupils, the placeholder can be replaced with
+			// UpdateStudent.
+			studentEngage.Name = placeholderName(PIDCount)
+			if err := createStudent(ctx, tx, studentEngage, s.db.Now()); err != nil {
 				return err
 			}
 		case studentEngage != nil && studentLocal != nil:
-			// data from both engage and local db, update local db.
-			if err := updateStudent(ctx, tx, studentLocal.PID, studentEngage); err != nil {
+			// data from both engage and local db, update local db. The name and year
+			// arent known to engage so the local ones are kept.
+			studentEngage.Name = studentLocal.Name
+			if studentEngage.AttendsSchool {
+				studentEngage.CurrentYear = studentLocal.CurrentYear
+			}
+			if err := updateStudent(ctx, tx, studentLocal.PID, studentEngage, s.db.Now()); err != nil {
 				return err
 			}
 		}
+	}
+
+	return tx.Commit()
+}
 
-		PIDCount++
+// placeholderName returns the name given to students created from engage: 1001 -> "Pupil 1001".
+func placeholderName(pid int) string {
+	return fmt.Sprintf("Pupil %d", pid)
+}
+
+func findStudentByPID(ctx context.Context, tx *sql.Tx, id int) (*csb.Student, error) {
+	students, _, err := findStudents(ctx, tx, csb.StudentFilter{PID: &id})
+	if err != nil {
+		return nil, err
+	} else if len(students) == 0 {
+		return nil, csb.Errorf(csb.ENOTFOUND, "student not found: %v", id)
+	}
 
-		// dont spam engage.
-		select {
-		case <-ctx.Done():
-			return fmt.Errorf("refresh students: %w", ctx.Err())
-		case <-time.After(engage.RequestTimeout):
+	return students[0], nil
+}
+
+// findStudentByPIDEngage builds the student with pid = id from engage. Engage has no lookup
+// for the name or year group of a pupil so both are left empty, the subjects are the reporting
+// subjects of all the academic years. The student attends the school if their latest academic
+// year is the current one.
+//
+// returns ENOTFOUND if engage doesent know the pid.
+func (s *StudentService) findStudentByPIDEngage(ctx context.Context, id int) (*csb.Student, error) {
+	academicYears, err := s.c.GetAcademicYears(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	latest := academicYears[0]
+	for _, year := range academicYears[1:] {
+		if year > latest {
+			latest = year
 		}
 	}
 
-	return nil
+	reportingPeriods, err := s.c.GetReportingPeriods(ctx, id, academicYears)
+	if err != nil {
+		return nil, err
+	}
+	subjects, err := s.c.GetReportingSubjects(ctx, id, academicYears, reportingPeriods)
+	if err != nil {
+		return nil, err
+	}
+
+	return &csb.Student{
+		PID:           id,
+		AttendsSchool: latest >= csb.AcademicYearOf(s.db.Now()),
+		Subjects:      subjects,
+	}, nil
 }
 
-func findStudentByPID(ctx context.Context, tx *sql.Tx, id int) (*csb.Student, error) {
+func findStudents(ctx context.Context, tx *sql.Tx, filter csb.StudentFilter) (_ []*csb.Student, page csb.Page, err error) {
+	where, args := []string{"1 = 1"}, []interface{}{}
+	if v := filter.PID; v != nil {
+		where, args = append(where, "st.pid = ?"), append(args, *v)
+	}
+	if v := filter.Name; v != nil {
+		where, args = append(where, "st.name = ? COLLATE NOCASE"), append(args, *v)
+	}
+	if v := filter.CurrentYear; v != nil {
+		where, args = append(where, "st.current_year = ?"), append(args, *v)
+	}
+	if v := filter.AttendsSchool; v != nil {
+		where, args = append(where, "st.attends_school = ?"), append(args, *v)
+	}
+	if v := filter.Source; v != nil {
+		where, args = append(where, "st.source = ?"), append(args, *v)
+	}
+	if v := filter.Subjects; v != nil && len(*v) > 0 {
+		// students taking every subject of the filter.
+		where = append(where, `st.pid IN (
+			SELECT ss.student_id
+			FROM student_subjects ss
+			INNER JOIN subjects s ON s.id = ss.subject_id
+			WHERE s.code IN (`+placeholders(len(*v))+`)
+			GROUP BY ss.student_id
+			HAVING COUNT(DISTINCT s.code) = ?
+		)`)
+		for _, subject := range *v {
+			args = append(args, subject)
+		}
+		args = append(args, len(*v))
+	}
+
+	key, desc := parseSortBy(filter.SortBy)
+	exprs, err := studentSortExprs(key)
+	if err != nil {
+		return nil, page, err
+	}
+
+	// count before applying the cursor so that the total covers all pages.
+	paginated := filter.Limit > 0 || filter.Cursor != ""
+	if paginated {
+		if err := tx.QueryRowContext(ctx, `
+			SELECT COUNT(*)
+			FROM students st
+			WHERE `+strings.Join(where, " AND "),
+			args...,
+		).Scan(&page.Total); err != nil {
+			return nil, page, err
+		}
+	}
+
+	if filter.Cursor != "" {
+		values, err := decodeCursor(filter.Cursor, filter.SortBy, len(exprs))
+		if err != nil {
+			return nil, page, err
+		}
+		where, args = append(where, keysetCondition(exprs, desc, values)), append(args, values...)
+	}
 
+	students, last, err := queryStudents(ctx, tx, where, args, exprs, orderClause(exprs, desc, filter.Limit), filter.Limit)
+	if err != nil {
+		return nil, page, err
+	}
+	if last != nil {
+		page.NextCursor = encodeCursor(filter.SortBy, last)
+	}
+
+	if !paginated {
+		page.Total = len(students)
+	}
+	return students, page, nil
 }
 
-func (s *StudentService) findStudentByPIDEngage(ctx context.Context, id int) (*csb.Student, error) {
+// findStudentsByPIDs returns the students with the pids, mapped by pid. Students which dont
+// exist are left out.
+func findStudentsByPIDs(ctx context.Context, tx *sql.Tx, pids []int) (map[int]*csb.Student, error) {
+	out := make(map[int]*csb.Student, len(pids))
+	if len(pids) == 0 {
+		return out, nil
+	}
+
+	args := make([]interface{}, len(pids))
+	for i, pid := range pids {
+		args[i] = pid
+	}
+
+	students, _, err := queryStudents(ctx, tx, []string{"st.pid IN (" + placeholders(len(pids)) + ")"}, args, []string{"st.pid"}, "", 0)
+	if err != nil {
+		return nil, err
+	}
+	for _, student := range students {
+		out[student.PID] = student
+	}
+	return out, nil
+}
 
+// studentSortExprs returns the sql expressions sorting students on key, the pid is always the
+// last expression so that the order is total.
+//
+// returns EINVALID if the sort key is unknown.
+func studentSortExprs(key string) ([]string, error) {
+	switch key {
+	case "":
+		return []string{"st.pid"}, nil
+	case csb.SORT_NAME:
+		return []string{"LOWER(st.name)", "st.pid"}, nil
+	case csb.SORT_CREATED_AT:
+		return []string{"COALESCE(st.created_at, '')", "st.pid"}, nil
+	}
+	return nil, csb.Errorf(csb.EINVALID, "find students: invalid sort key: %q", key)
+}
+
+// queryStudents selects the students matching where along with the sort values exprs. If
+// limit is reached the sort values of the last student are returned to build the next cursor.
+func queryStudents(ctx context.Context, tx *sql.Tx, where []string, args []interface{}, exprs []string, order string, limit int) (_ []*csb.Student, next []interface{}, err error) {
+	rows, err := tx.QueryContext(ctx, `
+		SELECT
+			st.pid,
+			st.name,
+			st.current_year,
+			st.attends_school,
+			st.source,
+			st.created_at,
+			st.updated_at,
+			(
+				SELECT COALESCE(GROUP_CONCAT(s.code, ','), '')
+				FROM student_subjects ss
+				INNER JOIN subjects s ON s.id = ss.subject_id
+				WHERE ss.student_id = st.pid
+			),
+			`+strings.Join(exprs, ", ")+`
+		FROM students st
+		WHERE `+strings.Join(where, " AND ")+`
+		`+order+`
+	`, args...)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	var last []interface{}
+	students := make([]*csb.Student, 0)
+	for rows.Next() {
+		if limit > 0 && len(students) == limit {
+			next = last
+			break
+		}
+
+		var (
+			student  csb.Student
+			subjects string
+		)
+		values, dest := sortValues(len(exprs))
+		if err := rows.Scan(append([]interface{}{
+			&student.PID,
+			&student.Name,
+			&student.CurrentYear,
+			&student.AttendsSchool,
+			&student.Source,
+			(*NullTime)(&student.CreatedAt),
+			(*NullTime)(&student.UpdatedAt),
+			&subjects,
+		}, dest...)...); err != nil {
+			return nil, nil, err
+		}
+
+		student.Subjects = make([]csb.Subject, 0)
+		for _, code := range strings.Split(subjects, ",") {
+			if code != "" {
+				student.Subjects = append(student.Subjects, csb.Subject(code))
+			}
+		}
+
+		students, last = append(students, &student), values
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	return students, next, nil
 }
 
-func findStudents(ctx context.Context, tx *sql.Tx, filter csb.StudentFilter) ([]*csb.Student, error) {
+// createStudent creates the student along with its subjects.
+func createStudent(ctx context.Context, tx *sql.Tx, student *csb.Student, now time.Time) error {
+	if err := student.Validate(); err != nil {
+		return err
+	}
+
+	switch _, err := findStudentByPID(ctx, tx, student.PID); csb.ErrorCode(err) {
+	case "":
+		return csb.Errorf(csb.ECONFLICT, "student already exists: %v", student.PID)
+	case csb.ENOTFOUND:
+	default:
+		return err
+	}
+	student.CreatedAt, student.UpdatedAt = now, now
+
+	if _, err := tx.ExecContext(ctx, `
+		INSERT INTO students (
+			pid,
+			name,
+			current_year,
+			attends_school,
+			source,
+			created_at,
+			updated_at
+		)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+	`,
+		student.PID,
+		student.Name,
+		student.CurrentYear,
+		student.AttendsSchool,
+		student.Source,
+		(*NullTime)(&student.CreatedAt),
+		(*NullTime)(&student.UpdatedAt),
+	); err != nil {
+		return err
+	}
+
+	return replaceStudentSubjects(ctx, tx, student.PID, student.Subjects)
 }
 
-func createStudent(ctx context.Context, tx *sql.Tx, student *csb.Student) error {
+// updateStudent updates the student with pid = id with the fields of student, the subjects of
+// the student are replaced.
+func updateStudent(ctx context.Context, tx *sql.Tx, id int, student *csb.Student, now time.Time) error {
+	student.PID = id
+	if err := student.Validate(); err != nil {
+		return err
+	}
+	student.UpdatedAt = now
+
+	if _, err := tx.ExecContext(ctx, `
+		UPDATE students
+		SET name = ?,
+			current_year = ?,
+			attends_school = ?,
+			source = ?,
+			updated_at = ?
+		WHERE pid = ?
+	`,
+		student.Name,
+		student.CurrentYear,
+		student.AttendsSchool,
+		student.Source,
+		(*NullTime)(&student.UpdatedAt),
+		id,
+	); err != nil {
+		return err
+	}
 
+	return replaceStudentSubjects(ctx, tx, id, student.Subjects)
 }
 
-func updateStudent(ctx context.Context, tx *sql.Tx, id int, student *csb.Student) error {
+// replaceStudentSubjects replaces the subjects of the student with pid = pid.
+func replaceStudentSubjects(ctx context.Context, tx *sql.Tx, pid int, subjects []csb.Subject) error {
+	if _, err := tx.ExecContext(ctx, `DELETE FROM student_subjects WHERE student_id = ?`, pid); err != nil {
+		return err
+	}
+
+	seen := make(map[csb.Subject]struct{}, len(subjects))
+	for _, subject := range subjects {
+		if _, ok := seen[subject]; ok {
+			continue
+		}
+		seen[subject] = struct{}{}
 
+		subjectID, err := findSubjectID(ctx, tx, subject)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO student_subjects (student_id, subject_id)
+			VALUES (?, ?)
+		`, pid, subjectID); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
-func deleteStudent(ctx context.Context, tx *sql.Tx, pid int) error {
+// deleteStudent deletes the student with pid = pid along with its marks, the deleted marks are
+// recorded in the mark revisions with reason.
+func deleteStudent(ctx context.Context, tx *sql.Tx, pid int, reason string, now time.Time) error {
+	if _, err := findStudentByPID(ctx, tx, pid); err != nil {
+		return err
+	}
+
+	marks, err := findMarksByPID(ctx, tx, pid)
+	if err != nil {
+		return err
+	}
+	for _, mark := range marks {
+		if err := deleteMark(ctx, tx, mark.ID, reason, now); err != nil {
+			return err
+		}
+	}
 
+	if _, err := tx.ExecContext(ctx, `DELETE FROM students WHERE pid = ?`, pid); err != nil {
+		return err
+	}
+	return nil
 }
 
 func attachStudentMarks(ctx context.Context, tx *sql.Tx, student *csb.Student) (err error) {
-	if student.Marks, err = findMarksByPID(ctx, tx, student.PID); err != nil {
-		fmt.Errorf("attach student marks: %w", err)
+	return attachStudentsMarks(ctx, tx, []*csb.Student{student})
+}
+
+// attachStudentsMarks attaches the marks of students, the marks are fetched in a single query.
+func attachStudentsMarks(ctx context.Context, tx *sql.Tx, students []*csb.Student) (err error) {
+	if len(students) == 0 {
+		return nil
+	}
+
+	pids := make([]int, 0, len(students))
+	index := make(map[int]*csb.Student, len(students))
+	for _, student := range students {
+		student.Marks = make([]*csb.Mark, 0)
+		pids, index[student.PID] = append(pids, student.PID), student
+	}
+
+	marks, _, err := findMarks(ctx, tx, csb.MarksFilter{PIDs: pids})
+	if err != nil {
+		return fmt.Errorf("attach student marks: %w", err)
+	}
+	for _, mark := range marks {
+		if student, ok := index[mark.StudentID]; ok {
+			student.Marks = append(student.Marks, mark)
+		}
 	}
 	return nil
 }
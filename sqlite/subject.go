@@ -0,0 +1,176 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+
+	csb "github.com/Lambels/CSB-Open-API"
+	"github.com/Lambels/CSB-Open-API/engage"
+)
+
+var _ csb.SubjectService = (*SubjectService)(nil)
+
+// SubjectService wraps around an engage client to keep the subject catalog in sync with
+// engage.
+type SubjectService struct {
+	// db for persistance.
+	db *DB
+	// client for updates.
+	c *engage.Client
+}
+
+// NewSubjectService creates a new subject service with the provided database and engage client.
+func NewSubjectService(db *DB, client *engage.Client) *SubjectService {
+	return &SubjectService{
+		db: db,
+		c:  client,
+	}
+}
+
+// FindSubjectByCode returns the subject with the specified code.
+//
+// returns ENOTFOUND if the subject isnt found.
+func (s *SubjectService) FindSubjectByCode(ctx context.Context, code csb.Subject) (*csb.SubjectInfo, error) {
+	tx, err := s.db.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	subjects, err := findSubjects(ctx, tx, csb.SubjectFilter{Code: &code})
+	if err != nil {
+		return nil, err
+	} else if len(subjects) == 0 {
+		return nil, csb.Errorf(csb.ENOTFOUND, "subject not found: %v", code)
+	}
+
+	return subjects[0], nil
+}
+
+// FindSubjects returns a range of subjects based on the filter.
+func (s *SubjectService) FindSubjects(ctx context.Context, filter csb.SubjectFilter) ([]*csb.SubjectInfo, error) {
+	tx, err := s.db.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	return findSubjects(ctx, tx, filter)
+}
+
+// RefreshSubjects refreshes the catalog with every subject the student with pid = pid ever
+// took in engage.
+//
+// New subjects are added, known subjects get their name and last seen date updated. The
+// names are registered so that csb.Subject resolves them.
+func (s *SubjectService) RefreshSubjects(ctx context.Context, pid int) error {
+	academicYears, err := s.c.GetAcademicYears(ctx, pid)
+	if err != nil {
+		return err
+	}
+
+	reportingPeriods, err := s.c.GetReportingPeriods(ctx, pid, academicYears)
+	if err != nil {
+		return err
+	}
+
+	subjects, err := s.c.GetSubjects(ctx, pid, academicYears, reportingPeriods)
+	if err != nil {
+		return err
+	}
+
+	tx, err := s.db.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	now := s.db.Now()
+	for i := range subjects {
+		subjects[i].FirstSeen, subjects[i].LastSeen = now, now
+		if err := upsertSubject(ctx, tx, &subjects[i]); err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	for _, subject := range subjects {
+		csb.RegisterSubject(subject.Code, subject.Name)
+	}
+	return nil
+}
+
+func findSubjects(ctx context.Context, tx *sql.Tx, filter csb.SubjectFilter) ([]*csb.SubjectInfo, error) {
+	where, args := []string{"1 = 1"}, []interface{}{}
+	if v := filter.Code; v != nil {
+		where, args = append(where, "code = ?"), append(args, *v)
+	}
+	if v := filter.Name; v != nil {
+		where, args = append(where, "name = ? COLLATE NOCASE"), append(args, *v)
+	}
+	if v := filter.SeenSince; v != nil {
+		where, args = append(where, "last_seen >= ?"), append(args, (*NullTime)(v))
+	}
+
+	rows, err := tx.QueryContext(ctx, `
+		SELECT
+			id,
+			code,
+			name,
+			first_seen,
+			last_seen
+		FROM subjects
+		WHERE `+strings.Join(where, " AND ")+`
+		ORDER BY name ASC
+	`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	subjects := make([]*csb.SubjectInfo, 0)
+	for rows.Next() {
+		var subject csb.SubjectInfo
+		if err := rows.Scan(
+			&subject.ID,
+			&subject.Code,
+			&subject.Name,
+			(*NullTime)(&subject.FirstSeen),
+			(*NullTime)(&subject.LastSeen),
+		); err != nil {
+			return nil, err
+		}
+		subjects = append(subjects, &subject)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return subjects, nil
+}
+
+// upsertSubject creates the subject or updates its name and last seen date if it already
+// exists. The first seen date of an existing subject is only set if it was never seen before.
+func upsertSubject(ctx context.Context, tx *sql.Tx, subject *csb.SubjectInfo) error {
+	if err := tx.QueryRowContext(ctx, `
+		INSERT INTO subjects (code, name, first_seen, last_seen)
+		VALUES (?, ?, ?, ?)
+		ON CONFLICT (code) DO UPDATE SET
+			name = excluded.name,
+			first_seen = COALESCE(subjects.first_seen, excluded.first_seen),
+			last_seen = excluded.last_seen
+		RETURNING id
+	`,
+		subject.Code,
+		subject.Name,
+		(*NullTime)(&subject.FirstSeen),
+		(*NullTime)(&subject.LastSeen),
+	).Scan(&subject.ID); err != nil {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,374 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"strconv"
+	"strings"
+	"time"
+
+	csb "github.com/Lambels/CSB-Open-API"
+)
+
+var _ csb.TeacherService = (*TeacherService)(nil)
+
+// TeacherService keeps the teachers normalized, marks are linked to their teacher when they
+// are written.
+type TeacherService struct {
+	// db for persistance.
+	db *DB
+}
+
+// NewTeacherService creates a new teacher service with the provided database.
+func NewTeacherService(db *DB) *TeacherService {
+	return &TeacherService{
+		db: db,
+	}
+}
+
+// FindTeacherByID returns a teacher based on the passed id.
+//
+// returns ENOTFOUND if the teacher isnt found.
+func (s *TeacherService) FindTeacherByID(ctx context.Context, id int) (*csb.Teacher, error) {
+	tx, err := s.db.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	return findTeacherByID(ctx, tx, id)
+}
+
+// FindTeachers returns a range of teachers based on the filter.
+func (s *TeacherService) FindTeachers(ctx context.Context, filter csb.TeacherFilter) ([]*csb.Teacher, error) {
+	tx, err := s.db.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	return findTeachers(ctx, tx, filter)
+}
+
+// MergeTeachers merges the teacher with id = from into the teacher with id = into.
+//
+// Future marks spelled like any alias of from are linked to into.
+func (s *TeacherService) MergeTeachers(ctx context.Context, into, from int) (*csb.Teacher, error) {
+	tx, err := s.db.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if into == from {
+		return nil, csb.Errorf(csb.EINVALID, "cannot merge a teacher into itself")
+	}
+	if _, err := findTeacherByID(ctx, tx, into); err != nil {
+		return nil, err
+	}
+	if _, err := findTeacherByID(ctx, tx, from); err != nil {
+		return nil, err
+	}
+
+	if err := mergeTeachers(ctx, tx, into, from); err != nil {
+		return nil, err
+	}
+
+	teacher, err := findTeacherByID(ctx, tx, into)
+	if err != nil {
+		return nil, err
+	}
+	return teacher, tx.Commit()
+}
+
+// FindTeacherClasses returns the classes of the teacher, a class being the students marked at
+// a subject in an academic year.
+func (s *TeacherService) FindTeacherClasses(ctx context.Context, id int) ([]*csb.TeacherClass, error) {
+	tx, err := s.db.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if _, err := findTeacherByID(ctx, tx, id); err != nil {
+		return nil, err
+	}
+
+	rows, err := tx.QueryContext(ctx, `
+		SELECT
+			s.code,
+			m.academic_year,
+			GROUP_CONCAT(DISTINCT m.student_id),
+			COUNT(*)
+		FROM marks m
+		INNER JOIN subjects s ON s.id = m.subject_id
+		WHERE m.teacher_id = ?
+		GROUP BY s.code, m.academic_year
+		ORDER BY m.academic_year ASC, s.code ASC
+	`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	classes := make([]*csb.TeacherClass, 0)
+	for rows.Next() {
+		var (
+			class csb.TeacherClass
+			pids  string
+		)
+		if err := rows.Scan(
+			&class.Subject,
+			&class.AcademicYear,
+			&pids,
+			&class.Marks,
+		); err != nil {
+			return nil, err
+		}
+
+		for _, v := range strings.Split(pids, ",") {
+			pid, err := strconv.Atoi(v)
+			if err != nil {
+				return nil, err
+			}
+			class.PIDs = append(class.PIDs, pid)
+		}
+		classes = append(classes, &class)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return classes, nil
+}
+
+// FindTeacherDistribution returns the statistics of the marks given by the teacher per
+// academic year and term.
+func (s *TeacherService) FindTeacherDistribution(ctx context.Context, id int) ([]*csb.MarkStats, error) {
+	tx, err := s.db.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if _, err := findTeacherByID(ctx, tx, id); err != nil {
+		return nil, err
+	}
+
+	return findMarkStats(ctx, tx, csb.StatsFilter{
+		Marks:   csb.MarksFilter{TeacherID: &id},
+		GroupBy: []string{csb.GROUP_ACADEMIC_YEAR, csb.GROUP_TERM},
+	})
+}
+
+func findTeacherByID(ctx context.Context, tx *sql.Tx, id int) (*csb.Teacher, error) {
+	teachers, err := findTeachers(ctx, tx, csb.TeacherFilter{ID: &id})
+	if err != nil {
+		return nil, err
+	} else if len(teachers) == 0 {
+		return nil, csb.Errorf(csb.ENOTFOUND, "teacher not found: %v", id)
+	}
+
+	return teachers[0], nil
+}
+
+func findTeachers(ctx context.Context, tx *sql.Tx, filter csb.TeacherFilter) ([]*csb.Teacher, error) {
+	where, args := []string{"1 = 1"}, []interface{}{}
+	if v := filter.ID; v != nil {
+		where, args = append(where, "t.id = ?"), append(args, *v)
+	}
+	if v := filter.Name; v != nil {
+		where = append(where, "t.id IN (SELECT teacher_id FROM teacher_aliases WHERE alias = ?)")
+		args = append(args, csb.NormalizeTeacher(*v))
+	}
+	if v := filter.Subject; v != nil {
+		where = append(where, `t.id IN (
+			SELECT m.teacher_id
+			FROM marks m
+			INNER JOIN subjects s ON s.id = m.subject_id
+			WHERE s.code = ?
+		)`)
+		args = append(args, *v)
+	}
+
+	rows, err := tx.QueryContext(ctx, `
+		SELECT
+			t.id,
+			t.name,
+			t.created_at,
+			(
+				SELECT COALESCE(GROUP_CONCAT(a.alias, '|'), '')
+				FROM teacher_aliases a
+				WHERE a.teacher_id = t.id
+			),
+			(
+				SELECT COALESCE(GROUP_CONCAT(DISTINCT s.code), '')
+				FROM marks m
+				INNER JOIN subjects s ON s.id = m.subject_id
+				WHERE m.teacher_id = t.id
+			)
+		FROM teachers t
+		WHERE `+strings.Join(where, " AND ")+`
+		ORDER BY t.name ASC, t.id ASC
+	`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	teachers := make([]*csb.Teacher, 0)
+	for rows.Next() {
+		var (
+			teacher           csb.Teacher
+			aliases, subjects string
+		)
+		if err := rows.Scan(
+			&teacher.ID,
+			&teacher.Name,
+			(*NullTime)(&teacher.CreatedAt),
+			&aliases,
+			&subjects,
+		); err != nil {
+			return nil, err
+		}
+
+		teacher.Aliases, teacher.Subjects = make([]string, 0), make([]csb.Subject, 0)
+		for _, alias := range strings.Split(aliases, "|") {
+			if alias != "" {
+				teacher.Aliases = append(teacher.Aliases, alias)
+			}
+		}
+		for _, code := range strings.Split(subjects, ",") {
+			if code != "" {
+				teacher.Subjects = append(teacher.Subjects, csb.Subject(code))
+			}
+		}
+		teachers = append(teachers, &teacher)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return teachers, nil
+}
+
+// mergeTeachers moves the aliases and marks of the teacher with id = from to the teacher with
+// id = into and deletes from.
+func mergeTeachers(ctx context.Context, tx *sql.Tx, into, from int) error {
+	if _, err := tx.ExecContext(ctx, `UPDATE teacher_aliases SET teacher_id = ? WHERE teacher_id = ?`, into, from); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `UPDATE marks SET teacher_id = ? WHERE teacher_id = ?`, into, from); err != nil {
+		return err
+	}
+	_, err := tx.ExecContext(ctx, `DELETE FROM teachers WHERE id = ?`, from)
+	return err
+}
+
+// normalizeTeacherAliases rewrites the aliases which arent spelled like csb.NormalizeTeacher
+// would spell them, such as the lower cased names left by the teachers migration. Teachers
+// whose aliases end up with the same spelling are merged into the teacher already holding it.
+func normalizeTeacherAliases(ctx context.Context, tx *sql.Tx) error {
+	rows, err := tx.QueryContext(ctx, `SELECT alias FROM teacher_aliases ORDER BY teacher_id ASC, alias ASC`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	var aliases []string
+	for rows.Next() {
+		var alias string
+		if err := rows.Scan(&alias); err != nil {
+			return err
+		}
+		if norm := csb.NormalizeTeacher(alias); norm != "" && norm != alias {
+			aliases = append(aliases, alias)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	rows.Close()
+
+	for _, alias := range aliases {
+		// a previous merge may have moved the alias.
+		var from int
+		if err := tx.QueryRowContext(ctx, `
+			SELECT teacher_id
+			FROM teacher_aliases
+			WHERE alias = ?
+		`, alias).Scan(&from); err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, `DELETE FROM teacher_aliases WHERE alias = ?`, alias); err != nil {
+			return err
+		}
+
+		norm := csb.NormalizeTeacher(alias)
+		var into int
+		switch err := tx.QueryRowContext(ctx, `
+			SELECT teacher_id
+			FROM teacher_aliases
+			WHERE alias = ?
+		`, norm).Scan(&into); err {
+		case nil:
+			if into != from {
+				if err := mergeTeachers(ctx, tx, into, from); err != nil {
+					return err
+				}
+			}
+		case sql.ErrNoRows:
+			if _, err := tx.ExecContext(ctx, `
+				INSERT INTO teacher_aliases (alias, teacher_id)
+				VALUES (?, ?)
+			`, norm, from); err != nil {
+				return err
+			}
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+// findTeacherID returns the id of the teacher spelled name, a new teacher is created if no
+// teacher has the normalized spelling as an alias.
+func findTeacherID(ctx context.Context, tx *sql.Tx, name string, now time.Time) (int, error) {
+	alias := csb.NormalizeTeacher(name)
+	if alias == "" {
+		return 0, csb.Errorf(csb.EINVALID, "invalid teacher name: %q", name)
+	}
+
+	var id int
+	switch err := tx.QueryRowContext(ctx, `
+		SELECT teacher_id
+		FROM teacher_aliases
+		WHERE alias = ?
+	`, alias).Scan(&id); err {
+	case nil:
+		return id, nil
+	case sql.ErrNoRows:
+	default:
+		return 0, err
+	}
+
+	if err := tx.QueryRowContext(ctx, `
+		INSERT INTO teachers (name, created_at)
+		VALUES (?, ?)
+		RETURNING id
+	`,
+		strings.Join(strings.Fields(name), " "),
+		(*NullTime)(&now),
+	).Scan(&id); err != nil {
+		return 0, err
+	}
+
+	if _, err := tx.ExecContext(ctx, `
+		INSERT INTO teacher_aliases (alias, teacher_id)
+		VALUES (?, ?)
+	`, alias, id); err != nil {
+		return 0, err
+	}
+	return id, nil
+}
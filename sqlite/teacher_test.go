@@ -0,0 +1,105 @@
+package sqlite_test
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	csb "github.com/Lambels/CSB-Open-API"
+	"github.com/Lambels/CSB-Open-API/sqlite"
+	"github.com/golang-migrate/migrate/v4"
+	"github.com/golang-migrate/migrate/v4/database/sqlite3"
+)
+
+// TestDB_Open_NormalizeTeachers checks that the teachers of the marks written before the
+// teachers migration are normalized like the teachers of new marks.
+func TestDB_Open_NormalizeTeachers(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "db")
+
+	// a database left at the version before the teachers migration.
+	dbSQL, err := sql.Open("sqlite3", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	driver, err := sqlite3.WithInstance(dbSQL, &sqlite3.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := migrate.NewWithDatabaseInstance("file://migrations", "students", driver)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Migrate(3); err != nil {
+		t.Fatal(err)
+	}
+	for _, stmt := range []string{
+		`INSERT INTO subjects (id, code, name) VALUES (1, '` + string(csb.MATHEMATICS) + `', 'Mathematics')`,
+		`INSERT INTO students (pid, name) VALUES (1, 'Student')`,
+		`INSERT INTO marks (student_id, subject_id, teacher, percentage, academic_year, term, importance)
+		VALUES
+			(1, 1, 'Mr. Smith', 50, 2022, 1, 'Mock'),
+			(1, 1, 'smith', 60, 2022, 1, 'Mock'),
+			(1, 1, 'Ms Radu', 70, 2022, 1, 'Mock'),
+			(1, 1, 'ms radu ', 80, 2022, 1, 'Mock')`,
+	} {
+		if _, err := dbSQL.Exec(stmt); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if srcErr, dbErr := m.Close(); srcErr != nil || dbErr != nil {
+		t.Fatal(srcErr, dbErr)
+	}
+
+	// opening twice checks that the normalization is idempotent.
+	for i := 0; i < 2; i++ {
+		db := sqlite.NewDB(path, "")
+		if err := db.Open(); err != nil {
+			t.Fatal(err)
+		}
+
+		teachers, err := sqlite.NewTeacherService(db).FindTeachers(ctx, csb.TeacherFilter{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var aliases [][]string
+		for _, teacher := range teachers {
+			aliases = append(aliases, teacher.Aliases)
+		}
+		if want := [][]string{{"radu"}, {"smith"}}; !reflect.DeepEqual(aliases, want) {
+			t.Fatalf("open %v: got aliases %v, want %v", i, aliases, want)
+		}
+
+		// marks written after the migration link to the migrated teachers.
+		MustCreateMark(t, db, &csb.Mark{
+			StudentID:  1,
+			Subject:    csb.MATHEMATICS,
+			Teacher:    "Dl. Smith",
+			Percentage: 90,
+			Period:     fullPeriod(2022, 2+i, "Mock"),
+		})
+
+		for _, tt := range []struct {
+			teacher string
+			want    int
+		}{
+			{"Mr Smith", 3 + i},
+			{"RADU", 2},
+		} {
+			teacher := tt.teacher
+			marks, _, err := sqlite.NewMarkService(db, false, nil, nil).FindMarks(ctx, csb.MarksFilter{Teacher: &teacher})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(marks) != tt.want {
+				t.Errorf("open %v: got %v marks of %q, want %v", i, len(marks), tt.teacher, tt.want)
+			}
+		}
+
+		if err := db.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
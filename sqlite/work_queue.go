@@ -0,0 +1,582 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+
+	csb "github.com/Lambels/CSB-Open-API"
+)
+
+// pollInterval is the interval at which the work queue checks for queued transactions when it
+// isnt woken up by a publish.
+const pollInterval = time.Second
+
+var _ csb.WorkQueue = (*WorkQueue)(nil)
+
+// WorkQueue represents a work queue persisted in sqlite, the transactions and their status
+// transitions survive restarts.
+//
+// The transaction data is stored json encoded. The handler gets the original data of the
+// transactions published by this run, the transactions of a previous run only have their data
+// as a json.RawMessage. Transactions left processing by a previous run are queued again when the
+// work queue is created, they run with a background context since their original context is
+// lost.
+//
+// The transactions run synchronously using only one worker, highest priority first and in
+// the order they are published for the same priority. Transactions with a NotBefore time in the
+// future are scheduled, they are picked up within a poll interval of their time. The key of the
+// transactions is kept, with only one worker there is nothing to limit on it.
+//
+// Failed transactions are retried following their retry policy, scheduled after the backoff of
+// the failed attempt. The work queue doesent keep dead letters, the last failed attempt is only
+// recorded as the error of the done status.
+type WorkQueue struct {
+	db *DB
+
+	// handler handels the message synchronously.
+	handler func(*csb.Transaction) error
+
+	// mu guards pending and subs, it is held across status transitions so that subscribers
+	// see the transitions in order.
+	mu      sync.Mutex
+	pending map[int64]*pending
+	subs    map[int64]map[*WorkSubscription]struct{}
+
+	wake chan struct{}
+	done chan struct{}
+	once sync.Once // used to close done only once.
+	wg   sync.WaitGroup
+}
+
+// pending holds the context and data of a transaction published by this run.
+type pending struct {
+	ctx  context.Context
+	data interface{}
+	// finished is closed once the transaction is done or cancelled.
+	finished chan struct{}
+}
+
+// NewWorkQueue creates a new work queue persisted in db, transactions left processing by a
+// previous run are queued again.
+func NewWorkQueue(db *DB, handler func(*csb.Transaction) error) (*WorkQueue, error) {
+	w := &WorkQueue{
+		db:      db,
+		handler: handler,
+		pending: make(map[int64]*pending),
+		subs:    make(map[int64]map[*WorkSubscription]struct{}),
+		wake:    make(chan struct{}, 1),
+		done:    make(chan struct{}),
+	}
+
+	if err := w.requeue(context.Background()); err != nil {
+		return nil, err
+	}
+
+	w.wg.Add(1)
+	go w.listen()
+
+	return w, nil
+}
+
+// Publish persists the transaction as queued, the transaction id is set to the id of the
+// persisted transaction.
+//
+// returns EINVALID if the transaction data cant be json encoded. If the work queue is closed,
+// the call is no-op.
+func (w *WorkQueue) Publish(transaction *csb.Transaction) error {
+	select {
+	case <-w.done:
+		return nil
+	default:
+	}
+
+	data, err := json.Marshal(transaction.Data)
+	if err != nil {
+		return csb.Errorf(csb.EINVALID, "publish: cannot encode transaction data: %v", err)
+	}
+	retry, err := json.Marshal(transaction.Retry)
+	if err != nil {
+		return csb.Errorf(csb.EINVALID, "publish: cannot encode retry policy: %v", err)
+	}
+	if transaction.Ctx == nil {
+		transaction.Ctx = context.Background()
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	tx, err := w.db.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	now := w.db.Now()
+	status := csb.Status{State: csb.Queued}
+	if transaction.NotBefore.After(now) {
+		status = csb.Status{State: csb.Scheduled, NotBefore: transaction.NotBefore}
+	}
+
+	if err := tx.QueryRow(`
+		INSERT INTO work_transactions (data, state, priority, not_before, key, retry, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+		RETURNING id
+	`,
+		string(data),
+		status.State,
+		transaction.Priority,
+		(*NullTime)(&transaction.NotBefore),
+		transaction.Key,
+		string(retry),
+		(*NullTime)(&now),
+		(*NullTime)(&now),
+	).Scan(&transaction.Id); err != nil {
+		return err
+	}
+	if err := createWorkStatus(tx, transaction.Id, status, now); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	p := &pending{ctx: transaction.Ctx, data: transaction.Data, finished: make(chan struct{})}
+	w.pending[transaction.Id] = p
+	go w.watch(transaction.Id, p)
+
+	select {
+	case w.wake <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// Subscribe subscribes to the transaction with id = id. The subscription recieves the current
+// status straight away, the subscription to a finished transaction is closed after it.
+//
+// If the work queue is closed the call is no-op.
+//
+// If the transcation doesent exist ENOTFOUND is returned.
+func (w *WorkQueue) Subscribe(ctx context.Context, id int64) (csb.Subscription, error) {
+	select {
+	case <-w.done:
+		return nil, nil
+	default:
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	status, err := findWorkStatus(ctx, w.db.db, id)
+	if err != nil {
+		return nil, err
+	}
+
+	sub := &WorkSubscription{
+		w:  w,
+		id: id,
+		c:  make(chan csb.Status, 1),
+	}
+	sub.c <- status
+
+	if finished(status) {
+		sub.closed = true
+		close(sub.c)
+		return sub, nil
+	}
+
+	if w.subs[id] == nil {
+		w.subs[id] = make(map[*WorkSubscription]struct{})
+	}
+	w.subs[id][sub] = struct{}{}
+	return sub, nil
+}
+
+// FindStatuses returns every status the transaction with id = id went through, oldest first.
+//
+// returns ENOTFOUND if the transaction doesnt exist.
+func (w *WorkQueue) FindStatuses(ctx context.Context, id int64) ([]csb.Status, error) {
+	if _, err := findWorkStatus(ctx, w.db.db, id); err != nil {
+		return nil, err
+	}
+
+	rows, err := w.db.db.QueryContext(ctx, `
+		SELECT state, error, attempt
+		FROM work_transaction_statuses
+		WHERE transaction_id = ?
+		ORDER BY id ASC
+	`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	statuses := make([]csb.Status, 0)
+	for rows.Next() {
+		status, err := scanWorkStatus(rows)
+		if err != nil {
+			return nil, err
+		}
+		statuses = append(statuses, status)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return statuses, nil
+}
+
+// Close closes the work queue and waits for the current transaction to finish, it is the
+// callers responsability to cancel the context of the current transaction.
+//
+// Queued transactions stay queued for the next run.
+func (w *WorkQueue) Close() error {
+	w.once.Do(func() { close(w.done) })
+	w.wg.Wait()
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	for id := range w.subs {
+		w.closeSubscriptions(id)
+	}
+	return nil
+}
+
+// listen pulls the oldest queued transaction and hands it in to the handler.
+func (w *WorkQueue) listen() {
+	defer w.wg.Done()
+
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-w.done:
+			return
+		default:
+		}
+
+		// on errors wait for the next tick, the transaction stays queued.
+		ran, err := w.runNext()
+		if ran && err == nil {
+			continue
+		}
+
+		select {
+		case <-w.done:
+			return
+		case <-w.wake:
+		case <-ticker.C:
+		}
+	}
+}
+
+// runNext runs the queued transaction with the highest priority, scheduled transactions which
+// are due count as queued. It reports wether a transaction was found.
+func (w *WorkQueue) runNext() (bool, error) {
+	var (
+		transaction csb.Transaction
+		data        string
+		retry       string
+		state       int
+		attempt     int
+		now         = w.db.Now()
+	)
+	switch err := w.db.db.QueryRow(`
+		SELECT id, data, priority, key, retry, state, attempt
+		FROM work_transactions
+		WHERE state = ? OR (state = ? AND not_before <= ?)
+		ORDER BY priority DESC, id ASC
+		LIMIT 1
+	`, csb.Queued, csb.Scheduled, (*NullTime)(&now)).Scan(
+		&transaction.Id,
+		&data,
+		&transaction.Priority,
+		&transaction.Key,
+		&retry,
+		&state,
+		&attempt,
+	); err {
+	case nil:
+	case sql.ErrNoRows:
+		return false, nil
+	default:
+		return false, err
+	}
+	id := transaction.Id
+	transaction.Data = json.RawMessage(data)
+	if err := json.Unmarshal([]byte(retry), &transaction.Retry); err != nil {
+		return false, err
+	}
+
+	transaction.Ctx = context.Background()
+	w.mu.Lock()
+	if p, ok := w.pending[id]; ok {
+		transaction.Ctx, transaction.Data = p.ctx, p.data
+	}
+	w.mu.Unlock()
+
+	if err := transaction.Ctx.Err(); err != nil {
+		_, err := w.setStatus(id, csb.Status{State: csb.Cancelled, Error: err}, csb.Queued, csb.Scheduled)
+		return true, err
+	}
+
+	if state == csb.Scheduled {
+		if ok, err := w.setStatus(id, csb.Status{State: csb.Queued}, csb.Scheduled); err != nil || !ok {
+			return true, err
+		}
+	}
+
+	// the transaction got cancelled in the mean time.
+	if ok, err := w.setStatus(id, csb.Status{State: csb.Processing}, csb.Queued); err != nil || !ok {
+		return true, err
+	}
+	attempt++
+
+	err := w.handler(&transaction)
+
+	status := csb.Status{State: csb.Done, Error: err}
+	policy := transaction.Retry
+	// a cancelled transaction isnt retried.
+	if policy.Retryable(err) && transaction.Ctx.Err() == nil && attempt < policy.MaxAttempts {
+		status = csb.Status{State: csb.Scheduled, Error: err, NotBefore: w.db.Now().Add(policy.Delay(attempt))}
+	}
+
+	_, err = w.setStatus(id, status, csb.Processing)
+	return true, err
+}
+
+// watch cancels the transaction if its context is cancelled while its queued or scheduled,
+// processing transactions see the cancellation through their context.
+func (w *WorkQueue) watch(id int64, p *pending) {
+	select {
+	case <-p.ctx.Done():
+		w.setStatus(id, csb.Status{State: csb.Cancelled, Error: p.ctx.Err()}, csb.Queued, csb.Scheduled)
+	case <-p.finished:
+	case <-w.done:
+	}
+}
+
+// setStatus transitions the transaction with id = id to status if its current state is one of
+// from and broadcasts the status to the subscribers. It reports wether the transition happened.
+//
+// The attempt of the status is set by setStatus, a transition to processing starts a new
+// attempt.
+func (w *WorkQueue) setStatus(id int64, status csb.Status, from ...int) (bool, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	tx, err := w.db.db.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	var next int
+	if status.State == csb.Processing {
+		next = 1
+	}
+
+	now := w.db.Now()
+	args := []interface{}{
+		status.State,
+		errorText(status.Error),
+		(*NullTime)(&status.NotBefore),
+		next,
+		(*NullTime)(&now),
+		id,
+	}
+	for _, state := range from {
+		args = append(args, state)
+	}
+
+	switch err := tx.QueryRow(`
+		UPDATE work_transactions
+		SET state = ?,
+			error = ?,
+			not_before = ?,
+			attempt = attempt + ?,
+			updated_at = ?
+		WHERE id = ? AND state IN (`+placeholders(len(from))+`)
+		RETURNING attempt
+	`, args...).Scan(&status.Attempt); err {
+	case nil:
+	case sql.ErrNoRows:
+		return false, nil
+	default:
+		return false, err
+	}
+
+	if err := createWorkStatus(tx, id, status, now); err != nil {
+		return false, err
+	}
+	if err := tx.Commit(); err != nil {
+		return false, err
+	}
+
+	w.broadcast(id, status)
+	if finished(status) {
+		w.closeSubscriptions(id)
+		if p, ok := w.pending[id]; ok {
+			close(p.finished)
+			delete(w.pending, id)
+		}
+	}
+	return true, nil
+}
+
+// requeue queues the transactions left processing by a previous run.
+func (w *WorkQueue) requeue(ctx context.Context) error {
+	tx, err := w.db.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	now := w.db.Now()
+	if _, err := tx.ExecContext(ctx, `
+		INSERT INTO work_transaction_statuses (transaction_id, state, attempt, created_at)
+		SELECT id, ?, attempt, ?
+		FROM work_transactions
+		WHERE state = ?
+	`, csb.Queued, (*NullTime)(&now), csb.Processing); err != nil {
+		return err
+	}
+
+	if _, err := tx.ExecContext(ctx, `
+		UPDATE work_transactions
+		SET state = ?,
+			updated_at = ?
+		WHERE state = ?
+	`, csb.Queued, (*NullTime)(&now), csb.Processing); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// broadcast sends the status to the subscribers of the transaction with id = id, a subscriber
+// which didnt read the previous status only gets the latest one. w.mu must be held.
+func (w *WorkQueue) broadcast(id int64, status csb.Status) {
+	for sub := range w.subs[id] {
+		select {
+		case <-sub.c:
+		default:
+		}
+		sub.c <- status
+	}
+}
+
+// closeSubscriptions closes the subscribers of the transaction with id = id. w.mu must be
+// held.
+func (w *WorkQueue) closeSubscriptions(id int64) {
+	for sub := range w.subs[id] {
+		sub.closed = true
+		close(sub.c)
+	}
+	delete(w.subs, id)
+}
+
+// WorkSubscription represents a subscription to a transaction of the sqlite work queue.
+type WorkSubscription struct {
+	w  *WorkQueue // parent work queue.
+	id int64
+	c  chan csb.Status
+
+	// closed is guarded by the work queue mutex.
+	closed bool
+}
+
+// C returns a stream of status updates, the channel always has a status update
+// when C is called indicating the current status of the transaction.
+//
+// When the channel is closed the previous status will indicate why.
+func (s *WorkSubscription) C() <-chan csb.Status {
+	return s.c
+}
+
+// Close closes the subscription.
+func (s *WorkSubscription) Close() error {
+	s.w.mu.Lock()
+	defer s.w.mu.Unlock()
+
+	if !s.closed {
+		s.closed = true
+		delete(s.w.subs[s.id], s)
+		close(s.c)
+	}
+	return nil
+}
+
+// findWorkStatus returns the current status of the transaction with id = id.
+func findWorkStatus(ctx context.Context, db *sql.DB, id int64) (csb.Status, error) {
+	rows, err := db.QueryContext(ctx, `
+		SELECT state, error, attempt, not_before
+		FROM work_transactions
+		WHERE id = ?
+	`, id)
+	if err != nil {
+		return csb.Status{}, err
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		if err := rows.Err(); err != nil {
+			return csb.Status{}, err
+		}
+		return csb.Status{}, csb.Errorf(csb.ENOTFOUND, "subscribe: no transaction was found with id: %v", id)
+	}
+
+	var notBefore time.Time
+	status, err := scanWorkStatus(rows, (*NullTime)(&notBefore))
+	if err != nil {
+		return status, err
+	}
+	if status.State == csb.Scheduled {
+		status.NotBefore = notBefore
+	}
+	return status, nil
+}
+
+// scanWorkStatus scans a status row, the columns following the state, error and attempt are
+// scanned into extra.
+func scanWorkStatus(rows *sql.Rows, extra ...interface{}) (csb.Status, error) {
+	var (
+		status csb.Status
+		text   sql.NullString
+	)
+	if err := rows.Scan(append([]interface{}{&status.State, &text, &status.Attempt}, extra...)...); err != nil {
+		return status, err
+	}
+	if text.Valid {
+		status.Error = errors.New(text.String)
+	}
+	return status, nil
+}
+
+func createWorkStatus(tx *sql.Tx, id int64, status csb.Status, now time.Time) error {
+	_, err := tx.Exec(`
+		INSERT INTO work_transaction_statuses (transaction_id, state, error, attempt, created_at)
+		VALUES (?, ?, ?, ?, ?)
+	`, id, status.State, errorText(status.Error), status.Attempt, (*NullTime)(&now))
+	return err
+}
+
+// errorText returns the text of err to store, nil for no error.
+func errorText(err error) *string {
+	if err == nil {
+		return nil
+	}
+	text := err.Error()
+	return &text
+}
+
+// finished reports wether the status is final.
+func finished(status csb.Status) bool {
+	return status.State == csb.Done || status.State == csb.Cancelled
+}
@@ -0,0 +1,385 @@
+package sqlite_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	csb "github.com/Lambels/CSB-Open-API"
+	"github.com/Lambels/CSB-Open-API/sqlite"
+)
+
+// timeout bounds every wait of the work queue tests.
+const timeout = 5 * time.Second
+
+// refresh is the data of the published transactions.
+type refresh struct {
+	PID int `json:"pid"`
+}
+
+// recorder is a handler recording the transactions it runs, it blocks until released if
+// release is set.
+type recorder struct {
+	release chan struct{}
+	started chan *csb.Transaction
+}
+
+func newRecorder(block bool) *recorder {
+	r := &recorder{started: make(chan *csb.Transaction, 100)}
+	if block {
+		r.release = make(chan struct{})
+	}
+	return r
+}
+
+func (r *recorder) handle(transaction *csb.Transaction) error {
+	r.started <- transaction
+	if r.release != nil {
+		<-r.release
+	}
+	return nil
+}
+
+// wait waits for the next transaction to start.
+func (r *recorder) wait(t *testing.T) *csb.Transaction {
+	t.Helper()
+
+	select {
+	case transaction := <-r.started:
+		return transaction
+	case <-time.After(timeout):
+		t.Fatal("expected a transaction to start")
+		return nil
+	}
+}
+
+// MustOpenWorkQueue returns a new work queue persisted in db, the work queue is closed when the
+// test finishes.
+func MustOpenWorkQueue(tb testing.TB, db *sqlite.DB, handler func(*csb.Transaction) error) *sqlite.WorkQueue {
+	tb.Helper()
+
+	w, err := sqlite.NewWorkQueue(db, handler)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	tb.Cleanup(func() { w.Close() })
+	return w
+}
+
+// waitState reads the statuses of the subscription until one has the state, the statuses in
+// between may be dropped by the work queue.
+func waitState(t *testing.T, sub csb.Subscription, state int) csb.Status {
+	t.Helper()
+
+	for {
+		select {
+		case status, ok := <-sub.C():
+			if !ok {
+				t.Fatalf("expected state %v, got closed subscription", state)
+			} else if status.State == state {
+				return status
+			}
+		case <-time.After(timeout):
+			t.Fatalf("expected state %v, got nothing", state)
+		}
+	}
+}
+
+// states returns the states the transaction with id = id went through.
+func states(t *testing.T, w *sqlite.WorkQueue, id int64) []int {
+	t.Helper()
+
+	statuses, err := w.FindStatuses(context.Background(), id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := make([]int, 0, len(statuses))
+	for _, status := range statuses {
+		out = append(out, status.State)
+	}
+	return out
+}
+
+func TestWorkQueue_Data(t *testing.T) {
+	r := newRecorder(false)
+	w := MustOpenWorkQueue(t, MustOpenDB(t), r.handle)
+
+	if err := w.Publish(&csb.Transaction{Data: refresh{PID: 1001}}); err != nil {
+		t.Fatal(err)
+	}
+	// the transactions published by the run keep their data.
+	if data, ok := r.wait(t).Data.(refresh); !ok || data.PID != 1001 {
+		t.Fatalf("expected the published data, got: %#v", data)
+	}
+}
+
+func TestWorkQueue_Requeue(t *testing.T) {
+	db := MustOpenDB(t)
+	first := newRecorder(true)
+	w1 := MustOpenWorkQueue(t, db, first.handle)
+	defer close(first.release)
+
+	transaction := &csb.Transaction{Data: refresh{PID: 1001}}
+	if err := w1.Publish(transaction); err != nil {
+		t.Fatal(err)
+	}
+	first.wait(t)
+
+	// a second run finds the transaction processing, as if the first run crashed.
+	second := newRecorder(false)
+	w2 := MustOpenWorkQueue(t, db, second.handle)
+
+	got := second.wait(t)
+	if got.Id != transaction.Id {
+		t.Fatalf("expected transaction %v, got: %v", transaction.Id, got.Id)
+	}
+	// the data of a previous run is only known encoded.
+	if data, ok := got.Data.(json.RawMessage); !ok || string(data) != `{"pid":1001}` {
+		t.Fatalf("expected the encoded data, got: %#v", got.Data)
+	}
+
+	sub, err := w2.Subscribe(context.Background(), transaction.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status := waitState(t, sub, csb.Done); status.Attempt != 2 {
+		t.Fatalf("expected attempt 2, got: %v", status.Attempt)
+	}
+
+	want := []int{csb.Queued, csb.Processing, csb.Queued, csb.Processing, csb.Done}
+	if got := states(t, w2, transaction.Id); !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected states %v, got: %v", want, got)
+	}
+}
+
+func TestWorkQueue_Subscribe(t *testing.T) {
+	r := newRecorder(false)
+	w := MustOpenWorkQueue(t, MustOpenDB(t), r.handle)
+	ctx := context.Background()
+
+	if _, err := w.Subscribe(ctx, 1); csb.ErrorCode(err) != csb.ENOTFOUND {
+		t.Fatalf("expected ENOTFOUND for an unknown transaction, got: %v", err)
+	}
+
+	transaction := &csb.Transaction{}
+	if err := w.Publish(transaction); err != nil {
+		t.Fatal(err)
+	}
+	sub, err := w.Subscribe(ctx, transaction.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitState(t, sub, csb.Done)
+
+	// a finished transaction sends its final status and closes the subscription.
+	sub, err = w.Subscribe(ctx, transaction.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status, ok := <-sub.C(); !ok || status.State != csb.Done {
+		t.Fatalf("expected done status, got: %+v", status)
+	}
+	if _, ok := <-sub.C(); ok {
+		t.Fatal("expected subscription to be closed")
+	}
+}
+
+func TestWorkQueue_CancelQueued(t *testing.T) {
+	r := newRecorder(true)
+	w := MustOpenWorkQueue(t, MustOpenDB(t), r.handle)
+
+	if err := w.Publish(&csb.Transaction{}); err != nil {
+		t.Fatal(err)
+	}
+	r.wait(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	transaction := &csb.Transaction{Ctx: ctx}
+	if err := w.Publish(transaction); err != nil {
+		t.Fatal(err)
+	}
+	sub, err := w.Subscribe(context.Background(), transaction.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cancel()
+	if status := waitState(t, sub, csb.Cancelled); status.Error == nil || status.Error.Error() != context.Canceled.Error() {
+		t.Fatalf("expected the context error, got: %v", status.Error)
+	}
+
+	close(r.release)
+	w.Close()
+	select {
+	case transaction := <-r.started:
+		t.Fatalf("cancelled transaction ran: %v", transaction.Id)
+	default:
+	}
+
+	want := []int{csb.Queued, csb.Cancelled}
+	if got := states(t, w, transaction.Id); !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected states %v, got: %v", want, got)
+	}
+}
+
+func TestWorkQueue_Retry(t *testing.T) {
+	boom := errors.New("boom")
+
+	tests := []struct {
+		name string
+		// errs are the errors of the attempts, the attempts after succeed.
+		errs    []error
+		policy  csb.RetryPolicy
+		err     error
+		attempt int
+		states  []int
+	}{
+		{
+			name:    "recovers",
+			errs:    []error{boom},
+			policy:  csb.RetryPolicy{MaxAttempts: 3},
+			attempt: 2,
+			states:  []int{csb.Queued, csb.Processing, csb.Scheduled, csb.Queued, csb.Processing, csb.Done},
+		},
+		{
+			name:    "exhausted",
+			errs:    []error{boom, boom, boom},
+			policy:  csb.RetryPolicy{MaxAttempts: 2},
+			err:     boom,
+			attempt: 2,
+			states:  []int{csb.Queued, csb.Processing, csb.Scheduled, csb.Queued, csb.Processing, csb.Done},
+		},
+		{
+			name:    "not retryable",
+			errs:    []error{csb.Errorf(csb.EINVALID, "invalid")},
+			policy:  csb.RetryPolicy{MaxAttempts: 3},
+			err:     csb.Errorf(csb.EINVALID, "invalid"),
+			attempt: 1,
+			states:  []int{csb.Queued, csb.Processing, csb.Done},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var (
+				mu       sync.Mutex
+				attempts int
+			)
+			w := MustOpenWorkQueue(t, MustOpenDB(t), func(transaction *csb.Transaction) error {
+				mu.Lock()
+				defer mu.Unlock()
+
+				attempts++
+				if attempts <= len(tt.errs) {
+					return tt.errs[attempts-1]
+				}
+				return nil
+			})
+
+			transaction := &csb.Transaction{Retry: tt.policy}
+			if err := w.Publish(transaction); err != nil {
+				t.Fatal(err)
+			}
+			sub, err := w.Subscribe(context.Background(), transaction.Id)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			status := waitState(t, sub, csb.Done)
+			if (status.Error == nil) != (tt.err == nil) || (status.Error != nil && status.Error.Error() != tt.err.Error()) {
+				t.Errorf("expected error %v, got: %v", tt.err, status.Error)
+			}
+			if status.Attempt != tt.attempt {
+				t.Errorf("expected attempt %v, got: %v", tt.attempt, status.Attempt)
+			}
+			if got := states(t, w, transaction.Id); !reflect.DeepEqual(got, tt.states) {
+				t.Errorf("expected states %v, got: %v", tt.states, got)
+			}
+		})
+	}
+}
+
+func TestWorkQueue_Priority(t *testing.T) {
+	r := newRecorder(true)
+	w := MustOpenWorkQueue(t, MustOpenDB(t), r.handle)
+
+	// the first transaction keeps the worker busy while the others queue up.
+	if err := w.Publish(&csb.Transaction{}); err != nil {
+		t.Fatal(err)
+	}
+	r.wait(t)
+
+	for _, transaction := range []*csb.Transaction{
+		{Data: "low", Priority: 0},
+		{Data: "mid", Priority: 1},
+		{Data: "high", Priority: 2},
+		{Data: "mid again", Priority: 1},
+	} {
+		if err := w.Publish(transaction); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// higher priorities run first, the same priority runs in publish order.
+	for _, want := range []string{"high", "mid", "mid again", "low"} {
+		r.release <- struct{}{}
+		if got := r.wait(t).Data; got != want {
+			t.Fatalf("expected %q to run, got: %v", want, got)
+		}
+	}
+	r.release <- struct{}{}
+}
+
+func TestWorkQueue_NotBefore(t *testing.T) {
+	start := time.Date(2022, 5, 2, 10, 0, 0, 0, time.UTC)
+	var (
+		mu  sync.Mutex
+		now = start
+	)
+	advance := func(d time.Duration) {
+		mu.Lock()
+		defer mu.Unlock()
+		now = now.Add(d)
+	}
+
+	db := MustOpenDB(t)
+	db.Now = func() time.Time {
+		mu.Lock()
+		defer mu.Unlock()
+		return now
+	}
+	r := newRecorder(false)
+	w := MustOpenWorkQueue(t, db, r.handle)
+
+	transaction := &csb.Transaction{NotBefore: start.Add(time.Hour)}
+	if err := w.Publish(transaction); err != nil {
+		t.Fatal(err)
+	}
+	sub, err := w.Subscribe(context.Background(), transaction.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sub.Close()
+
+	if status := waitState(t, sub, csb.Scheduled); !status.NotBefore.Equal(start.Add(time.Hour)) {
+		t.Fatalf("expected transaction scheduled at %v, got: %+v", start.Add(time.Hour), status)
+	}
+
+	// the transaction stays scheduled until the time is reached, the work queue polls for it
+	// every second.
+	advance(59 * time.Minute)
+	select {
+	case transaction := <-r.started:
+		t.Fatalf("unexpected transaction started: %v", transaction.Id)
+	case status := <-sub.C():
+		t.Fatalf("expected transaction to stay scheduled, got: %+v", status)
+	case <-time.After(1500 * time.Millisecond):
+	}
+
+	advance(time.Minute)
+	r.wait(t)
+	waitState(t, sub, csb.Done)
+}
@@ -0,0 +1,76 @@
+package csb
+
+import "context"
+
+// Mark fields the statistics can be grouped by.
+const (
+	GROUP_STUDENT       = "student"
+	GROUP_SUBJECT       = "subject"
+	GROUP_TEACHER       = "teacher"
+	GROUP_ACADEMIC_YEAR = "academic_year"
+	GROUP_TERM          = "term"
+	GROUP_IMPORTANCE    = "importance"
+)
+
+// StatsFilter represents a request to the stats service.
+type StatsFilter struct {
+	// Marks filters the marks the statistics are computed over, the sorting and pagination
+	// fields are ignored.
+	Marks MarksFilter `json:"marks"`
+	// GroupBy holds the mark fields the marks are grouped by, either: GROUP_STUDENT,
+	// GROUP_SUBJECT, GROUP_TEACHER, GROUP_ACADEMIC_YEAR, GROUP_TERM or GROUP_IMPORTANCE.
+	//
+	// No grouping computes the statistics over all the marks.
+	GroupBy []string `json:"group_by"`
+}
+
+// MarkGroup identifies a group of marks, only the fields grouped by are set.
+type MarkGroup struct {
+	StudentID    *int     `json:"student_id,omitempty"`
+	Subject      *Subject `json:"subject,omitempty"`
+	Teacher      *string  `json:"teacher,omitempty"`
+	AcademicYear *int     `json:"academic_year,omitempty"`
+	Term         *int     `json:"term,omitempty"`
+	Importance   *string  `json:"importance,omitempty"`
+}
+
+// MarkStats represents the statistics of the percentages of a group of marks.
+type MarkStats struct {
+	Group MarkGroup `json:"group"`
+
+	Count  int     `json:"count"`
+	Mean   float64 `json:"mean"`
+	Median float64 `json:"median"`
+	// StdDev is the population standard deviation.
+	StdDev float64 `json:"std_dev"`
+	Min    int     `json:"min"`
+	Max    int     `json:"max"`
+}
+
+// Trend represents the trend of the percentages of a student over ordered periods.
+type Trend struct {
+	// Group always holds the student.
+	Group MarkGroup `json:"group"`
+
+	// Count is the amount of marks of the trend.
+	Count int `json:"count"`
+	// Periods is the amount of distinct periods of the trend.
+	Periods int `json:"periods"`
+	// Slope is the least squares slope of the percentages, in percentage points per period.
+	// It is 0 with less than 2 periods.
+	Slope float64 `json:"slope"`
+}
+
+// StatsService represents a service computing statistics over marks.
+type StatsService interface {
+	// FindMarkStats returns the statistics of each group of marks, ordered by group.
+	//
+	// returns EINVALID if the grouping is invalid.
+	FindMarkStats(ctx context.Context, filter StatsFilter) ([]*MarkStats, error)
+
+	// FindTrends returns the trend of each student, further grouped by the other fields of the
+	// grouping. The periods of a trend are ordered like Period.Compare does.
+	//
+	// returns EINVALID if the grouping is invalid.
+	FindTrends(ctx context.Context, filter StatsFilter) ([]*Trend, error)
+}
@@ -20,12 +20,19 @@ type Student struct {
 	Subjects []Subject `json:"subjects"`
 	// Marks are all the marks the student ever took.
 	Marks []*Mark `json:"marks"`
+	// Comments are all the report comments the student ever recieved.
+	Comments []*Comment `json:"comments"`
+	// Source of the student, either: SOURCE_ENGAGE or SOURCE_MANUAL.
+	Source string `json:"source"`
 	// Timestamps.
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
 }
 
 func (s *Student) Validate() error {
+	if s.PID == 0 {
+		return Errorf(EINVALID, "validate: student missing pid field")
+	}
 	if s.Name == "" {
 		return Errorf(EINVALID, "validate: student missing name field")
 	}
@@ -33,7 +40,7 @@ func (s *Student) Validate() error {
 		return Errorf(EINVALID, "validate: student has no subjects")
 	}
 
-	return nil
+	return validateSource(s.Source)
 }
 
 // StudentService represents a student service.
@@ -43,8 +50,20 @@ type StudentService interface {
 	// returns ENOTFOUND if the student doesent exist.
 	FindStudentByPID(ctx context.Context, pid int) (*Student, error)
 
-	// FindStudents finds the marks with the appropiate filter.
-	FindStudents(ctx context.Context, filter StudentFilter) ([]*Student, error)
+	// FindStudents finds the students with the appropiate filter, a page at a time.
+	//
+	// returns EINVALID if the sort key or the cursor are invalid.
+	FindStudents(ctx context.Context, filter StudentFilter) ([]*Student, Page, error)
+
+	// CreateStudent creates a manual student, useful for students missing from engage.
+	//
+	// returns ECONFLICT if a student with the same pid already exists.
+	CreateStudent(ctx context.Context, student *Student) error
+
+	// UpdateStudent updates the student with pid = pid, the student becomes manual.
+	//
+	// returns ENOTFOUND if the student doesnt exist.
+	UpdateStudent(ctx context.Context, pid int, upd StudentUpdate) (*Student, error)
 
 	// DeleteStudent permanently deletes the student with pid = pid.
 	//
@@ -74,6 +93,27 @@ type StudentFilter struct {
 
 	// Subjects filters on the subjects each student takes.
 	Subjects *[]Subject `json:"subjects"`
+
+	// Source filters on the source of the students.
+	Source *string `json:"source"`
+
+	// SortBy sorts the students, either: SORT_NAME or SORT_CREATED_AT. Defaults to sorting on
+	// the pid.
+	SortBy string `json:"sort_by"`
+	// Limit caps the amount of students returned, 0 for no limit.
+	Limit int `json:"limit"`
+	// Cursor resumes the students after a previous page, it must be used with the filter of
+	// the previous page.
+	Cursor string `json:"cursor"`
+}
+
+// StudentUpdate represents a set of fields to update on a student, nil fields are left
+// unchanged.
+type StudentUpdate struct {
+	Name          *string    `json:"name"`
+	CurrentYear   *int       `json:"current_year"`
+	AttendsSchool *bool      `json:"attends_school"`
+	Subjects      *[]Subject `json:"subjects"`
 }
 
 // RefreshStudents represents an request to the RefreshStudents serivce.
@@ -84,4 +124,7 @@ type RefreshStudents struct {
 	N int `json:"n"`
 	// Purge indicates wether removed users should be deleted or not.
 	Purge bool `json:"purge"`
+	// Overwrite indicates wether manual students may be updated or purged, the students
+	// updated become engage students.
+	Overwrite bool `json:"overwrite"`
 }
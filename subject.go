@@ -1,18 +1,121 @@
 package csb
 
-import "strings"
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+)
 
 // Subject is the engage identifier of a subject.
 type Subject string
 
+// String returns the name of the subject as registered in the subject catalog.
 func (s Subject) String() string {
-	v, ok := subjectToString[s]
+	catalogMu.RLock()
+	defer catalogMu.RUnlock()
+
+	v, ok := catalog[s]
 	if !ok {
 		return "Unknown Subject"
 	}
 	return v
 }
 
+// Known reports wether the subject is registered in the subject catalog.
+func (s Subject) Known() bool {
+	catalogMu.RLock()
+	defer catalogMu.RUnlock()
+
+	_, ok := catalog[s]
+	return ok
+}
+
+// ParseSubject parses s as either an engage subject code or a subject name, as displayed by
+// engage, from the subject catalog.
+//
+// The name comparison is case insensitive.
+func ParseSubject(s string) (Subject, bool) {
+	s = strings.TrimSpace(s)
+
+	catalogMu.RLock()
+	defer catalogMu.RUnlock()
+
+	if _, ok := catalog[Subject(s)]; ok {
+		return Subject(s), true
+	}
+
+	for k, v := range catalog {
+		if strings.EqualFold(v, s) {
+			return k, true
+		}
+	}
+	return "", false
+}
+
+// RegisterSubject registers the name of a subject in the subject catalog used to resolve
+// subject names. Registering an existing subject renames it.
+//
+// The catalog is seeded with the well known subjects and is kept in sync with engage by the
+// SubjectService.
+func RegisterSubject(s Subject, name string) {
+	catalogMu.Lock()
+	defer catalogMu.Unlock()
+
+	catalog[s] = name
+}
+
+// WellKnownSubjects returns the well known subjects and their names, as hard coded in the
+// subject constants.
+func WellKnownSubjects() map[Subject]string {
+	out := make(map[Subject]string, len(subjectToString))
+	for k, v := range subjectToString {
+		out[k] = v
+	}
+	return out
+}
+
+// SubjectInfo represents a subject in the subject catalog.
+type SubjectInfo struct {
+	// PK of the subject.
+	ID int `json:"id"`
+	// Code is the engage identifier of the subject.
+	Code Subject `json:"code"`
+	// Name is the name engage displays for the subject.
+	Name string `json:"name"`
+	// FirstSeen and LastSeen are the first and last time the subject was seen in engage,
+	// zero if the subject was never seen in engage.
+	FirstSeen time.Time `json:"first_seen"`
+	LastSeen  time.Time `json:"last_seen"`
+}
+
+// SubjectService represents a subject catalog service.
+type SubjectService interface {
+	// FindSubjectByCode returns the subject with code = code.
+	//
+	// returns ENOTFOUND if the subject doesnt exist.
+	FindSubjectByCode(ctx context.Context, code Subject) (*SubjectInfo, error)
+
+	// FindSubjects finds the subjects with the appropiate filter.
+	FindSubjects(ctx context.Context, filter SubjectFilter) ([]*SubjectInfo, error)
+
+	// RefreshSubjects refreshes the catalog with the subjects the student with pid = pid
+	// ever took in engage, updating the names and last seen dates of known subjects.
+	//
+	// returns any error in the exchange.
+	RefreshSubjects(ctx context.Context, pid int) error
+}
+
+// SubjectFilter represents a filter to bulk get subjects.
+type SubjectFilter struct {
+	// Code filters on the subject code.
+	Code *Subject `json:"code"`
+	// Name filters on the subject name.
+	Name *string `json:"name"`
+	// SeenSince filters on the subjects seen in engage since the time provided.
+	SeenSince *time.Time `json:"seen_since"`
+}
+
 // Concat is used to concatonate a list of subjects in a format usable as a parameter
 // for an engage request.
 func Concat(elems []Subject) string {
@@ -38,6 +141,8 @@ func Concat(elems []Subject) string {
 	return b.String()
 }
 
+// Well known subjects, their names are resolved through the subject catalog like any
+// other subject.
 const (
 	BIOLOGY                  Subject = "CL1-106"
 	CHEMISTRY                Subject = "CL1-108"
@@ -63,6 +168,7 @@ const (
 	GLOBAL_PERSPECTIVES      Subject = "CL1-117"
 )
 
+// subjectToString holds the well known subjects, they seed the subject catalog.
 var subjectToString = map[Subject]string{
 	BIOLOGY:                  "Biology",
 	CHEMISTRY:                "Chemistry",
@@ -87,3 +193,8 @@ var subjectToString = map[Subject]string{
 	ENGLISH_SECOND:           "English 2nd Language",
 	GLOBAL_PERSPECTIVES:      "Global Perspectives (GP)",
 }
+
+var (
+	catalogMu sync.RWMutex
+	catalog   = WellKnownSubjects()
+)
@@ -0,0 +1,103 @@
+package csb
+
+import (
+	"context"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Teacher represents a teacher, marks link to their teacher by id.
+//
+// Engage spells the name of the same teacher in different ways, every spelling seen is kept as
+// an alias of the teacher.
+type Teacher struct {
+	// PK of the teacher.
+	ID int `json:"id"`
+	// Name is the display name of the teacher, the first spelling seen.
+	Name string `json:"name"`
+	// Aliases holds the normalized spellings of the teacher name.
+	Aliases []string `json:"aliases"`
+	// Subjects are all the subjects the teacher ever marked.
+	Subjects []Subject `json:"subjects"`
+	// Timestamp.
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// TeacherClass represents the students a teacher marked at a subject in an academic year.
+type TeacherClass struct {
+	Subject      Subject `json:"subject"`
+	AcademicYear int     `json:"academic_year"`
+	// PIDs of the students of the class.
+	PIDs []int `json:"pids"`
+	// Marks is the amount of marks given to the class.
+	Marks int `json:"marks"`
+}
+
+// TeacherService represents a teacher service.
+type TeacherService interface {
+	// FindTeacherByID returns the teacher with id = id.
+	//
+	// returns ENOTFOUND if the teacher doesnt exist.
+	FindTeacherByID(ctx context.Context, id int) (*Teacher, error)
+
+	// FindTeachers finds the teachers with the appropiate filter.
+	FindTeachers(ctx context.Context, filter TeacherFilter) ([]*Teacher, error)
+
+	// MergeTeachers merges the teacher with id = from into the teacher with id = into: the
+	// aliases and marks of from are moved to into and from is deleted.
+	//
+	// returns ENOTFOUND if either teacher doesnt exist.
+	MergeTeachers(ctx context.Context, into, from int) (*Teacher, error)
+
+	// FindTeacherClasses returns the classes of the teacher with id = id, oldest first.
+	//
+	// returns ENOTFOUND if the teacher doesnt exist.
+	FindTeacherClasses(ctx context.Context, id int) ([]*TeacherClass, error)
+
+	// FindTeacherDistribution returns the statistics of the marks given by the teacher with
+	// id = id per academic year and term, oldest first.
+	//
+	// returns ENOTFOUND if the teacher doesnt exist.
+	FindTeacherDistribution(ctx context.Context, id int) ([]*MarkStats, error)
+}
+
+// TeacherFilter represents a filter to bulk get teachers.
+type TeacherFilter struct {
+	// ID filters on the teacher id.
+	ID *int `json:"id"`
+	// Name filters on any spelling of the teacher name, see NormalizeTeacher.
+	Name *string `json:"name"`
+	// Subject filters on the teachers who marked the subject.
+	Subject *Subject `json:"subject"`
+}
+
+// teacherTitles are the titles stripped from teacher names when normalizing them.
+var teacherTitles = map[string]struct{}{
+	"mr": {}, "mrs": {}, "ms": {}, "miss": {}, "mx": {}, "dr": {}, "prof": {}, "sir": {},
+	"dl": {}, "dna": {}, "domnul": {}, "doamna": {},
+}
+
+// NormalizeTeacher returns the normalized spelling of a teacher name: lower case, without
+// punctuation, titles or repeated whitespace. "Mr. Popescu " normalizes to "popescu".
+func NormalizeTeacher(name string) string {
+	name = strings.Map(func(r rune) rune {
+		switch {
+		case unicode.IsLetter(r) || unicode.IsDigit(r) || r == '-' || r == '\'':
+			return unicode.ToLower(r)
+		case unicode.IsSpace(r) || unicode.IsPunct(r):
+			return ' '
+		}
+		return -1
+	}, name)
+
+	words := strings.Fields(name)
+	// keep the title if it is the whole name.
+	for len(words) > 1 {
+		if _, ok := teacherTitles[words[0]]; !ok {
+			break
+		}
+		words = words[1:]
+	}
+	return strings.Join(words, " ")
+}
@@ -1,16 +1,27 @@
 package csb
 
-import "context"
+import (
+	"context"
+	"time"
+)
 
 // Status represents the status of a transaction in the work queue.
 type Status struct {
 	// State of the transaction.
 	//
-	// Either: Queued, Processing, Done or Cancelled.
+	// Either: Scheduled, Queued, Processing, Done or Cancelled.
 	State int `json:"state"`
 	// Any error associated with the state. Should check for any error when the state is either
 	// Done or Cancelled.
 	Error error `json:"error"`
+	// NotBefore is the time a scheduled transaction gets queued at, only set when the state
+	// is Scheduled.
+	NotBefore time.Time `json:"not_before,omitempty"`
+	// Attempt is the number of the current or last run of the transaction starting from 1, 0
+	// if the transaction didnt run yet.
+	//
+	// A transaction scheduled for a retry has the error of the failed attempt.
+	Attempt int `json:"attempt"`
 }
 
 const (
@@ -24,6 +35,15 @@ const (
 	Done
 	// Cancelled means that the transaction was cancelled before it got a chance to run.
 	Cancelled
+	// Scheduled means the transaction waits for its NotBefore time to be queued.
+	Scheduled
+)
+
+// Transaction priorities, any int is a valid priority.
+const (
+	PRIORITY_LOW    = -10
+	PRIORITY_NORMAL = 0
+	PRIORITY_HIGH   = 10
 )
 
 // Transcation represents a transaction working through the work queue.
@@ -32,6 +52,17 @@ type Transaction struct {
 	Id int64 `json:"id"`
 	// Data of the transaction.
 	Data interface{} `json:"data"`
+	// Priority of the transaction, queued transactions with a higher priority run first and
+	// transactions with the same priority run in the order they were published.
+	Priority int `json:"priority"`
+	// NotBefore delays the transaction until the time, the zero time runs the transaction as
+	// soon as possible.
+	NotBefore time.Time `json:"not_before"`
+	// Retry is the retry policy of the transaction, the zero policy runs the transaction once.
+	Retry RetryPolicy `json:"retry"`
+	// Key groups related transactions, ie: the refreshes of a student. Work queues may limit
+	// how many transactions with the same key run at once.
+	Key string `json:"key"`
 	// Ctx of the transaction, used to cancel the transaction.
 	Ctx context.Context
 }
@@ -61,3 +92,99 @@ type WorkQueue interface {
 	// Close closes the work queue.
 	Close() error
 }
+
+// RetryPolicy represents the policy used to retry the failed runs of a transaction.
+type RetryPolicy struct {
+	// MaxAttempts is the maximum amount of runs of the transaction, 0 or 1 for no retries.
+	MaxAttempts int `json:"max_attempts"`
+	// Backoff is the delay before the first retry, doubled on every retry after.
+	Backoff time.Duration `json:"backoff"`
+	// MaxBackoff caps the delay between retries, 0 for no cap.
+	MaxBackoff time.Duration `json:"max_backoff"`
+	// Codes are the error codes which are retried, ie: EINTERNAL. Defaults to EINTERNAL, which
+	// includes all the errors which arent csb errors.
+	//
+	// Failures with any other code end the transaction on the attempt, they arent retried.
+	Codes []string `json:"codes"`
+}
+
+// Retryable reports wether the error is worth retrying under the policy, regardless of the
+// attempts left.
+func (p RetryPolicy) Retryable(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	codes := p.Codes
+	if len(codes) == 0 {
+		codes = []string{EINTERNAL}
+	}
+	code := ErrorCode(err)
+	for _, c := range codes {
+		if c == code {
+			return true
+		}
+	}
+	return false
+}
+
+// Delay returns the delay before the retry following the attempt.
+func (p RetryPolicy) Delay(attempt int) time.Duration {
+	delay := p.Backoff
+	for i := 1; i < attempt; i++ {
+		if p.MaxBackoff > 0 && delay >= p.MaxBackoff {
+			break
+		}
+		delay *= 2
+	}
+	if p.MaxBackoff > 0 && delay > p.MaxBackoff {
+		delay = p.MaxBackoff
+	}
+	return delay
+}
+
+// DeadLetter represents a failed transaction kept around to be inspected and re-queued, either
+// out of attempts or failed with an error which isnt retried. Cancelled transactions arent
+// kept as dead letters.
+type DeadLetter struct {
+	// Id is the id of the failed transaction.
+	Id int64 `json:"id"`
+	// Transaction is the failed transaction, without its context.
+	Transaction *Transaction `json:"transaction"`
+	// Error is the error of the last attempt.
+	Error error `json:"error"`
+	// Attempts is the amount of runs of the transaction.
+	Attempts int `json:"attempts"`
+
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// DeadLetterService represents a service for managing the dead letters of a work queue.
+type DeadLetterService interface {
+	// FindDeadLetterByID returns the dead letter of the transaction with id = id.
+	//
+	// returns ENOTFOUND if the dead letter doesent exist.
+	FindDeadLetterByID(ctx context.Context, id int64) (*DeadLetter, error)
+
+	// FindDeadLetters finds the dead letters with the appropiate filter, oldest first.
+	FindDeadLetters(ctx context.Context, filter DeadLetterFilter) ([]*DeadLetter, error)
+
+	// RequeueDeadLetter publishes the transaction of the dead letter again with a fresh set
+	// of attempts and removes the dead letter, it returns the published transaction.
+	//
+	// returns ENOTFOUND if the dead letter doesent exist.
+	RequeueDeadLetter(ctx context.Context, id int64) (*Transaction, error)
+
+	// DeleteDeadLetter removes the dead letter without re-queueing it.
+	//
+	// returns ENOTFOUND if the dead letter doesent exist.
+	DeleteDeadLetter(ctx context.Context, id int64) error
+}
+
+// DeadLetterFilter represents a filter to bulk get dead letters.
+type DeadLetterFilter struct {
+	// Key filters on the key of the transactions.
+	Key *string `json:"key"`
+	// Limit caps the amount of dead letters returned, 0 for no limit.
+	Limit int `json:"limit"`
+}